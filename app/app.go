@@ -1,9 +1,8 @@
 package app
 
 import (
-	"fmt"
-
 	"github.com/bvisness/flowshell/clay"
+	"github.com/bvisness/flowshell/core"
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
@@ -26,6 +25,7 @@ func Main() {
 	rl.SetTargetFPS(int32(rl.GetMonitorRefreshRate(rl.GetCurrentMonitor())))
 
 	initImages()
+	core.ResultCache = core.OpenCache(core.DefaultCacheDir())
 
 	clay.SetMaxElementCount(1 << 18)
 	arena := clay.CreateArenaWithCapacity(uintptr(clay.MinMemorySize()))
@@ -81,5 +81,5 @@ func frame() {
 }
 
 func handleClayErrors(errorData clay.ErrorData) {
-	fmt.Printf("CLAY ERROR: %s\n", errorData.ErrorText)
+	core.Log.Error("Clay error", "err", errorData.ErrorText)
 }
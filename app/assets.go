@@ -13,6 +13,7 @@ var assets embed.FS
 
 var ImgPlay rl.Texture2D
 var ImgRetry rl.Texture2D
+var ImgStop rl.Texture2D
 var ImgPushpin rl.Texture2D
 var ImgPushpinOutline rl.Texture2D
 var ImgDropdownDown rl.Texture2D
@@ -24,6 +25,7 @@ var ImgToggleDown rl.Texture2D
 func initImages() {
 	ImgPlay = LoadAssetTexture("assets/play-white.png")
 	ImgRetry = LoadAssetTexture("assets/retry-white.png")
+	ImgStop = LoadAssetTexture("assets/stop-white.png")
 	ImgPushpin = LoadAssetTexture("assets/pushpin-white.png")
 	ImgPushpinOutline = LoadAssetTexture("assets/pushpin-outline-white.png")
 	ImgDropdownDown = LoadAssetTexture("assets/dropdown-down.png")
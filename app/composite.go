@@ -0,0 +1,276 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/bvisness/flowshell/clay"
+	"github.com/bvisness/flowshell/core"
+	"github.com/bvisness/flowshell/util"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// Nodes added to the selection with Shift+click, for collapsing into a
+// composite node along with the selected node.
+var groupSelection = make(map[*core.Node]bool)
+
+// A node's subgraph opened for editing, e.g. a composite node's, and where to
+// go back to.
+type openSubgraph struct {
+	Outer    *core.Graph
+	Node     *core.Node
+	OuterPan V2
+}
+
+// The subgraphs being edited, outermost first. The graph being edited is the
+// last one's inner graph.
+var subgraphStack []openSubgraph
+
+// The graph that is saved to disk, even while editing a subgraph inside it.
+func RootGraph() *core.Graph {
+	if len(subgraphStack) > 0 {
+		return subgraphStack[0].Outer
+	}
+	return graph
+}
+
+func IsGroupSelected(g *core.Graph, n *core.Node) bool {
+	return groupSelection[n] || g.IsSelected(n)
+}
+
+// The nodes to collapse, in graph order.
+func GroupSelection(g *core.Graph) []*core.Node {
+	var res []*core.Node
+	for _, n := range g.Nodes() {
+		if IsGroupSelected(g, n) {
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+func ClearGroupSelection() {
+	groupSelection = make(map[*core.Node]bool)
+}
+
+// Selects a node that was clicked. With Shift held, the node is added to or
+// removed from the group selection instead.
+func ClickSelect(g *core.Graph, n *core.Node) {
+	if !rl.IsKeyDown(rl.KeyLeftShift) && !rl.IsKeyDown(rl.KeyRightShift) {
+		ClearGroupSelection()
+		g.Select(n)
+		return
+	}
+	if g.IsSelected(n) {
+		g.Select(nil)
+	} else {
+		groupSelection[n] = !groupSelection[n]
+	}
+}
+
+// Replaces the group selection with a composite node.
+func CollapseSelection() {
+	ns := GroupSelection(graph)
+	if len(ns) == 0 {
+		return
+	}
+	composite, err := graph.Collapse(ns, "Composite")
+	if err != nil {
+		setFileStatus(true, "Failed to collapse: %v", err)
+		return
+	}
+	ClearGroupSelection()
+	graph.Select(composite)
+}
+
+func OpenSubgraph(n *core.Node) {
+	sg := n.Action.(core.SubgraphAction).InnerGraph()
+	subgraphStack = append(subgraphStack, openSubgraph{Outer: graph, Node: n, OuterPan: Pan})
+	graph = sg.Inner
+	Pan = V2(sg.Pan)
+	ClearGroupSelection()
+}
+
+// Goes back to the graph containing the node whose subgraph is being edited,
+// if any.
+func CloseSubgraph() {
+	if len(subgraphStack) == 0 {
+		return
+	}
+	top := subgraphStack[len(subgraphStack)-1]
+	subgraphStack = subgraphStack[:len(subgraphStack)-1]
+	top.Node.Action.(core.SubgraphAction).InnerGraph().Pan = core.V2(Pan)
+	graph = top.Outer
+	Pan = top.OuterPan
+	ClearGroupSelection()
+
+	// Whatever was edited inside may change the node's result.
+	top.Node.MarkChanged(graph)
+}
+
+// Handles Ctrl+G (collapse) and Escape (leave the subgraph being edited).
+func handleCompositeShortcuts() {
+	if UIFocus != nil || filePromptMode != FilePromptNone {
+		return
+	}
+	if rl.IsKeyPressed(rl.KeyG) && (rl.IsKeyDown(rl.KeyLeftControl) || rl.IsKeyDown(rl.KeyRightControl)) {
+		CollapseSelection()
+	}
+	// Escape also cancels drags, which happen with the mouse held down.
+	if rl.IsKeyPressed(rl.KeyEscape) && !rl.IsMouseButtonDown(rl.MouseLeftButton) {
+		CloseSubgraph()
+	}
+}
+
+// Composite nodes anywhere in the file, by name, so they can be added again
+// from the new node menu.
+func compositeNodeTypes() []NodeType {
+	var res []NodeType
+	seen := make(map[string]bool)
+	var visit func(g *core.Graph)
+	visit = func(g *core.Graph) {
+		for _, n := range g.Nodes() {
+			sg, ok := n.Action.(core.SubgraphAction)
+			if !ok {
+				continue
+			}
+			if _, isComposite := sg.(*core.CompositeAction); isComposite && !seen[n.Name] {
+				seen[n.Name] = true
+				res = append(res, NodeType{n.Name, func() *core.Node {
+					clone, err := core.CloneNode(n)
+					if err != nil {
+						core.Log.Error("Failed to copy composite node", "err", err)
+						return core.NewCompositeNode(n.Name, core.NewGraph())
+					}
+					return clone
+				}})
+			}
+			visit(sg.InnerGraph().Inner)
+		}
+	}
+	visit(RootGraph())
+	return res
+}
+
+// Shows which subgraph is being edited, and offers to collapse the group
+// selection.
+func UICompositeBar() {
+	group := GroupSelection(graph)
+	if len(subgraphStack) == 0 && len(group) < 2 {
+		return
+	}
+
+	clay.CLAY_AUTO_ID(clay.EL{
+		Layout: clay.LAY{Padding: PA3, ChildGap: S2, ChildAlignment: YCENTER},
+		Floating: clay.FLOAT{
+			AttachTo: clay.AttachToParent,
+			Offset:   clay.Vector2{Y: 40},
+			AttachPoints: clay.FloatingAttachPoints{
+				Element: clay.AttachPointLeftTop,
+				Parent:  clay.AttachPointLeftTop,
+			},
+		},
+	}, func() {
+		buttonStyle := clay.EL{
+			Layout: clay.LAY{Padding: PVH(S1, S2)},
+			Border: clay.B{Width: BA, Color: Gray},
+		}
+		buttonTextConfig := clay.T{FontID: InterSemibold, TextColor: White}
+
+		if len(subgraphStack) > 0 {
+			UIButton(clay.ID("CompositeBack"), UIButtonConfig{
+				El: buttonStyle,
+				OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+					CloseSubgraph()
+				},
+			}, func() {
+				clay.TEXT("Back", buttonTextConfig)
+				if clay.Hovered() {
+					UITooltip("Back to the containing graph (Esc)")
+				}
+			})
+			clay.TEXT("Graph", clay.T{TextColor: LightGray})
+			for i, open := range subgraphStack {
+				clay.TEXT(fmt.Sprintf("> %s", open.Node.Name), clay.T{TextColor: util.Tern(i == len(subgraphStack)-1, White, LightGray)})
+			}
+		}
+
+		if len(group) >= 2 {
+			UIButton(clay.ID("CollapseGroup"), UIButtonConfig{
+				El: buttonStyle,
+				OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+					CollapseSelection()
+				},
+			}, func() {
+				clay.TEXT(fmt.Sprintf("Collapse %d nodes", len(group)), buttonTextConfig)
+				if clay.Hovered() {
+					UITooltip("Replace the selected nodes with a composite node (Ctrl+G). Shift+click to select more.")
+				}
+			})
+		}
+	})
+}
+
+func UICompositeNode(g *core.Graph, n *core.Node, c *core.CompositeAction) {
+	clay.CLAY_AUTO_ID(clay.EL{
+		Layout: clay.LAY{LayoutDirection: clay.TopToBottom, Sizing: GROWH, ChildGap: S2},
+	}, func() {
+		clay.CLAY_AUTO_ID(clay.EL{
+			Layout: clay.LAY{Sizing: GROWH, ChildGap: S2, ChildAlignment: YCENTER},
+		}, func() {
+			UITextBox(clay.IDI("CompositeName", n.ID), &n.Name, UITextBoxConfig{
+				El: clay.EL{Layout: clay.LAY{Sizing: GROWH}},
+			})
+			UIOpenSubgraphButton(n)
+		})
+		UIPortColumns(n)
+	})
+}
+
+// Opens the node's subgraph for editing.
+func UIOpenSubgraphButton(n *core.Node) {
+	UIButton(clay.AUTO_ID, UIButtonConfig{
+		El: clay.EL{Layout: clay.LAY{Padding: PVH(S1, S2)}, Border: clay.B{Width: BA, Color: Gray}},
+		OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+			OpenSubgraph(n)
+		},
+	}, func() {
+		clay.TEXT("Open", clay.T{FontID: InterSemibold, TextColor: White})
+		if clay.Hovered() {
+			UITooltip(fmt.Sprintf("Edit the %d nodes inside", len(n.Action.(core.SubgraphAction).InnerGraph().Inner.Nodes())-2))
+		}
+	})
+}
+
+func UISubgraphInputsNode(g *core.Graph, n *core.Node, a *core.SubgraphInputsAction) {
+	UIPortColumns(n)
+}
+
+func UISubgraphOutputsNode(g *core.Graph, n *core.Node, a *core.SubgraphOutputsAction) {
+	UIPortColumns(n)
+}
+
+// Lists a node's input ports on the left and its output ports on the right.
+func UIPortColumns(n *core.Node) {
+	clay.CLAY_AUTO_ID(clay.EL{
+		Layout: clay.LAY{Sizing: GROWH, ChildGap: S2},
+	}, func() {
+		clay.CLAY_AUTO_ID(clay.EL{ // inputs
+			Layout: clay.LAY{LayoutDirection: clay.TopToBottom, Sizing: GROWH},
+		}, func() {
+			for i := range n.InputPorts {
+				UIInputPort(n, i)
+			}
+		})
+		clay.CLAY_AUTO_ID(clay.EL{ // outputs
+			Layout: clay.LAY{
+				LayoutDirection: clay.TopToBottom,
+				Sizing:          GROWH,
+				ChildAlignment:  clay.ChildAlignment{X: clay.AlignXRight},
+			},
+		}, func() {
+			for i := range n.OutputPorts {
+				UIOutputPort(n, i)
+			}
+		})
+	})
+}
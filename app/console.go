@@ -0,0 +1,175 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/bvisness/flowshell/clay"
+	"github.com/bvisness/flowshell/core"
+	"github.com/bvisness/flowshell/util"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+type ConsoleDock int
+
+const (
+	ConsoleDockPanel  ConsoleDock = iota // A tab in the output panel
+	ConsoleDockBottom                    // Below the node canvas, so it can be seen alongside outputs
+)
+
+var consoleDock ConsoleDock
+
+const ConsoleHeight = 220
+
+// Only the most recent matching entries are shown, to keep layout fast.
+const ConsoleMaxEntries = 500
+
+var consoleMinLevel = slog.LevelInfo
+var consoleSelectedOnly bool
+
+var consoleLevels = []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError}
+
+func handleConsoleShortcuts() {
+	if rl.IsKeyPressed(rl.KeyGrave) && (rl.IsKeyDown(rl.KeyLeftControl) || rl.IsKeyDown(rl.KeyRightControl)) {
+		DockConsole(util.Tern(consoleDock == ConsoleDockBottom, ConsoleDockPanel, ConsoleDockBottom))
+	}
+}
+
+func DockConsole(dock ConsoleDock) {
+	consoleDock = dock
+	switch {
+	case dock == ConsoleDockPanel:
+		outputTab = OutputTabConsole
+	case outputTab == OutputTabConsole:
+		outputTab = OutputTabResult
+	}
+}
+
+// The console docked below the node canvas, if it is docked there.
+func UIConsolePane(g *core.Graph) {
+	if consoleDock != ConsoleDockBottom {
+		return
+	}
+	clay.CLAY_LATE(clay.ID("Console"), func() clay.EL {
+		return clay.EL{
+			Layout: clay.LAY{
+				LayoutDirection: clay.TopToBottom,
+				Sizing:          clay.Sizing{Width: clay.SizingGrow(1, 0), Height: clay.SizingFixed(ConsoleHeight)},
+				Padding:         PA2,
+			},
+			Clip: clay.ClipElementConfig{
+				Vertical:    true,
+				Horizontal:  true,
+				ChildOffset: clay.GetScrollOffset(),
+			},
+		}
+	}, func() {
+		UIConsole(g)
+	})
+}
+
+// Shows recent log messages, most recent first, filtered by level and
+// optionally by the selected node.
+func UIConsole(g *core.Graph) {
+	clay.CLAY_AUTO_ID(clay.EL{
+		Layout: clay.LAY{Sizing: GROWH, ChildGap: S1, ChildAlignment: YCENTER},
+	}, func() {
+		for _, level := range consoleLevels {
+			selected := consoleMinLevel == level
+			UIButton(clay.AUTO_ID, UIButtonConfig{
+				El: clay.EL{
+					Layout:          clay.LAY{Padding: PVH(S1, S2)},
+					BackgroundColor: util.Tern(selected, Gray, clay.Color{}),
+					CornerRadius:    RA1,
+				},
+				OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+					consoleMinLevel = level
+				},
+			}, func() {
+				clay.TEXT(level.String(), clay.TextElementConfig{
+					FontID:    util.Tern(selected, InterSemibold, InterRegular),
+					TextColor: util.Tern(selected, White, LightGray),
+				})
+				if clay.Hovered() {
+					UITooltip(fmt.Sprintf("Show %s messages and above", level))
+				}
+			})
+		}
+		UIToggle(clay.ID("ConsoleSelectedOnly"), "Selected node only", &consoleSelectedOnly, "Only show messages about the selected node")
+		UISpacer(clay.AUTO_ID, GROWH)
+		UIButton(clay.AUTO_ID, UIButtonConfig{
+			El: clay.EL{Layout: clay.LAY{Padding: PVH(S1, S2)}, Border: clay.B{Width: BA, Color: Gray}},
+			OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+				core.Logs.Clear()
+			},
+		}, func() {
+			clay.TEXT("Clear", clay.TextElementConfig{FontID: InterSemibold, TextColor: White})
+		})
+		UIButton(clay.AUTO_ID, UIButtonConfig{
+			El: clay.EL{Layout: clay.LAY{Padding: PVH(S1, S2)}, Border: clay.B{Width: BA, Color: Gray}},
+			OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+				DockConsole(util.Tern(consoleDock == ConsoleDockBottom, ConsoleDockPanel, ConsoleDockBottom))
+			},
+		}, func() {
+			clay.TEXT(util.Tern(consoleDock == ConsoleDockBottom, "Move to Panel", "Dock at Bottom"), clay.TextElementConfig{FontID: InterSemibold, TextColor: White})
+			if clay.Hovered() {
+				UITooltip("Move the console (Ctrl+`)")
+			}
+		})
+	})
+	UISpacer(clay.AUTO_ID, WH(1, S2))
+
+	selected, hasSelected := g.Selected()
+	if consoleSelectedOnly && !hasSelected {
+		clay.TEXT("Select a node to see its messages.", clay.TextElementConfig{TextColor: LightGray})
+		return
+	}
+
+	entries := core.Logs.Entries()
+	shown := 0
+	clay.CLAY_AUTO_ID(clay.EL{
+		Layout: clay.LAY{LayoutDirection: clay.TopToBottom, Sizing: GROWH, ChildGap: S1},
+	}, func() {
+		for i := len(entries) - 1; i >= 0 && shown < ConsoleMaxEntries; i-- {
+			e := entries[i]
+			if e.Level < consoleMinLevel || consoleSelectedOnly && e.NodeID != selected.ID {
+				continue
+			}
+			UILogEntry(e)
+			shown++
+		}
+	})
+	if shown == 0 {
+		clay.TEXT("No messages.", clay.TextElementConfig{TextColor: LightGray})
+	}
+}
+
+func UILogEntry(e core.LogEntry) {
+	clay.CLAY_AUTO_ID(clay.EL{
+		Layout: clay.LAY{Sizing: GROWH, ChildGap: S2},
+	}, func() {
+		clay.TEXT(e.Time.Format(time.TimeOnly), clay.TextElementConfig{TextColor: LightGray})
+		clay.TEXT(e.Level.String(), clay.TextElementConfig{FontID: InterSemibold, TextColor: logLevelColor(e.Level)})
+		if e.NodeID != 0 {
+			clay.TEXT(fmt.Sprintf("%s (#%d)", e.NodeName, e.NodeID), clay.TextElementConfig{FontID: InterSemibold, TextColor: White})
+		}
+		clay.TEXT(e.Message, clay.TextElementConfig{TextColor: White})
+		if e.Attrs != "" {
+			clay.TEXT(e.Attrs, clay.TextElementConfig{TextColor: LightGray})
+		}
+	})
+}
+
+func logLevelColor(level slog.Level) clay.Color {
+	switch {
+	case level >= slog.LevelError:
+		return Red
+	case level >= slog.LevelWarn:
+		return Orange
+	case level >= slog.LevelInfo:
+		return Blue
+	default:
+		return LightGray
+	}
+}
@@ -0,0 +1,279 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/bvisness/flowshell/clay"
+	"github.com/bvisness/flowshell/core"
+	"github.com/bvisness/flowshell/util"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// The graph file currently being edited, if it has been saved or opened.
+var CurrentFilePath string
+
+type FilePromptMode int
+
+const (
+	FilePromptNone FilePromptMode = iota
+	FilePromptOpen
+	FilePromptSaveAs
+	FilePromptExportTrace
+)
+
+var filePromptMode FilePromptMode
+var filePromptPath string
+
+// The result of the last save or open, shown next to the file buttons.
+var fileStatus string
+var fileStatusIsError bool
+
+var filePromptTextboxID = clay.ID("FilePromptPath")
+
+func OpenFilePrompt(mode FilePromptMode) {
+	filePromptMode = mode
+	filePromptPath = CurrentFilePath
+	if filePromptPath == "" && mode == FilePromptSaveAs {
+		filePromptPath = "untitled.flow"
+	}
+	if mode == FilePromptExportTrace {
+		filePromptPath = "flowshell.trace.json"
+		if CurrentFilePath != "" {
+			filePromptPath = strings.TrimSuffix(CurrentFilePath, filepath.Ext(CurrentFilePath)) + ".trace.json"
+		}
+	}
+	UIFocus = &filePromptTextboxID
+}
+
+func CloseFilePrompt() {
+	filePromptMode = FilePromptNone
+	if IsFocused(filePromptTextboxID) {
+		UIFocus = nil
+	}
+}
+
+func SaveGraph() {
+	if CurrentFilePath == "" {
+		OpenFilePrompt(FilePromptSaveAs)
+		return
+	}
+	SaveGraphAs(CurrentFilePath)
+}
+
+func SaveGraphAs(path string) {
+	if err := core.WriteGraphFile(path, CurrentGraphFile()); err != nil {
+		setFileStatus(true, "Failed to save: %v", err)
+		return
+	}
+	setCurrentFilePath(path)
+	setFileStatus(false, "Saved %s", filepath.Base(path))
+}
+
+// Writes everything the graph has run so far as a Chrome trace, for viewing in
+// Perfetto.
+func ExportTrace(path string) {
+	if err := core.WriteChromeTraceFile(path, RootGraph().TraceEvents()); err != nil {
+		setFileStatus(true, "Failed to export trace: %v", err)
+		return
+	}
+	setFileStatus(false, "Exported trace to %s", filepath.Base(path))
+}
+
+// Deletes every cached node result, so that everything runs fresh.
+func ClearCache() {
+	if core.ResultCache == nil {
+		setFileStatus(false, "The result cache is turned off")
+		return
+	}
+	if err := core.ResultCache.Clear(); err != nil {
+		setFileStatus(true, "Failed to clear cache: %v", err)
+		return
+	}
+	setFileStatus(false, "Cleared the result cache")
+}
+
+func OpenGraph(path string) {
+	g, err := core.ReadGraphFile(path)
+	if err != nil {
+		setFileStatus(true, "%v", err)
+		return
+	}
+	LoadGraph(g)
+	setCurrentFilePath(path)
+	setFileStatus(false, "Opened %s", filepath.Base(path))
+}
+
+// Replaces the graph being edited with the contents of the file.
+func LoadGraph(f *core.GraphFile) {
+	for len(subgraphStack) > 0 {
+		CloseSubgraph()
+	}
+	for _, n := range graph.Nodes() {
+		n.Stop(graph)
+	}
+
+	graph = core.NewGraphFromFile(f)
+	ClearGroupSelection()
+	nodeUIStates = make(map[*core.Node]*NodeUIState)
+	expandedRuns = make(map[int]bool)
+	expandedNodeRuns = make(map[expandedNodeRunKey]bool)
+	Pan = V2(f.Pan)
+}
+
+// Captures the graph being edited for saving, including any subgraph open for
+// editing.
+func CurrentGraphFile() *core.GraphFile {
+	if len(subgraphStack) == 0 {
+		f := graph.File()
+		f.Pan = core.V2(Pan)
+		return f
+	}
+	subgraphStack[len(subgraphStack)-1].Node.Action.(core.SubgraphAction).InnerGraph().Pan = core.V2(Pan)
+	f := RootGraph().File()
+	f.Pan = core.V2(subgraphStack[0].OuterPan)
+	return f
+}
+
+func setCurrentFilePath(path string) {
+	CurrentFilePath = path
+	rl.SetWindowTitle(fmt.Sprintf("%s - Flowshell", filepath.Base(path)))
+}
+
+func setFileStatus(isError bool, format string, args ...any) {
+	fileStatus = fmt.Sprintf(format, args...)
+	fileStatusIsError = isError
+}
+
+// Handles Ctrl+S (save), Ctrl+Shift+S (save as), and Ctrl+O (open).
+func handleFileShortcuts() {
+	if filePromptMode != FilePromptNone && rl.IsKeyPressed(rl.KeyEscape) {
+		CloseFilePrompt()
+		return
+	}
+
+	ctrl := rl.IsKeyDown(rl.KeyLeftControl) || rl.IsKeyDown(rl.KeyRightControl)
+	shift := rl.IsKeyDown(rl.KeyLeftShift) || rl.IsKeyDown(rl.KeyRightShift)
+	if !ctrl {
+		return
+	}
+
+	if rl.IsKeyPressed(rl.KeyS) {
+		if shift {
+			OpenFilePrompt(FilePromptSaveAs)
+		} else {
+			SaveGraph()
+		}
+	} else if rl.IsKeyPressed(rl.KeyO) {
+		OpenFilePrompt(FilePromptOpen)
+	}
+}
+
+func UIFileMenu() {
+	clay.CLAY_AUTO_ID(clay.EL{
+		Layout: clay.LAY{
+			Padding:        PA3,
+			ChildGap:       S2,
+			ChildAlignment: YCENTER,
+		},
+		Floating: clay.FLOAT{
+			AttachTo: clay.AttachToParent,
+			AttachPoints: clay.FloatingAttachPoints{
+				Element: clay.AttachPointLeftTop,
+				Parent:  clay.AttachPointLeftTop,
+			},
+		},
+	}, func() {
+		buttonStyle := clay.EL{
+			Layout: clay.LAY{Padding: PVH(S1, S2)},
+			Border: clay.B{Width: BA, Color: Gray},
+		}
+		buttonTextConfig := clay.T{FontID: InterSemibold, TextColor: White}
+
+		UIButton(clay.ID("FileOpen"), UIButtonConfig{
+			El: buttonStyle,
+			OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+				OpenFilePrompt(FilePromptOpen)
+			},
+		}, func() {
+			clay.TEXT("Open", buttonTextConfig)
+			if clay.Hovered() {
+				UITooltip("Open graph (Ctrl+O)")
+			}
+		})
+		UIButton(clay.ID("FileSave"), UIButtonConfig{
+			El: buttonStyle,
+			OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+				SaveGraph()
+			},
+		}, func() {
+			clay.TEXT("Save", buttonTextConfig)
+			if clay.Hovered() {
+				UITooltip("Save graph (Ctrl+S)")
+			}
+		})
+		UIButton(clay.ID("FileSaveAs"), UIButtonConfig{
+			El: buttonStyle,
+			OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+				OpenFilePrompt(FilePromptSaveAs)
+			},
+		}, func() {
+			clay.TEXT("Save As", buttonTextConfig)
+			if clay.Hovered() {
+				UITooltip("Save graph to a new file (Ctrl+Shift+S). Names ending in .json are saved as text.")
+			}
+		})
+		UIButton(clay.ID("FileExportTrace"), UIButtonConfig{
+			El: buttonStyle,
+			OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+				OpenFilePrompt(FilePromptExportTrace)
+			},
+		}, func() {
+			clay.TEXT("Export Trace", buttonTextConfig)
+			if clay.Hovered() {
+				UITooltip("Save a trace of when each node ran, for viewing in Perfetto (ui.perfetto.dev)")
+			}
+		})
+		UIButton(clay.ID("FileClearCache"), UIButtonConfig{
+			El: buttonStyle,
+			OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+				ClearCache()
+			},
+		}, func() {
+			clay.TEXT("Clear Cache", buttonTextConfig)
+			if clay.Hovered() {
+				UITooltip("Delete saved node results, so that every node runs fresh")
+			}
+		})
+
+		if filePromptMode != FilePromptNone {
+			clay.TEXT(map[FilePromptMode]string{
+				FilePromptOpen:        "Open:",
+				FilePromptSaveAs:      "Save as:",
+				FilePromptExportTrace: "Export trace:",
+			}[filePromptMode], clay.T{TextColor: LightGray})
+			UITextBox(filePromptTextboxID, &filePromptPath, UITextBoxConfig{
+				El: clay.EL{Layout: clay.LAY{Sizing: clay.Sizing{Width: PX(400)}}},
+				OnSubmit: func(path string) {
+					mode := filePromptMode
+					CloseFilePrompt()
+					switch mode {
+					case FilePromptOpen:
+						OpenGraph(path)
+					case FilePromptSaveAs:
+						SaveGraphAs(path)
+					case FilePromptExportTrace:
+						ExportTrace(path)
+					}
+				},
+			})
+		} else if CurrentFilePath != "" {
+			clay.TEXT(CurrentFilePath, clay.T{TextColor: LightGray})
+		}
+
+		if fileStatus != "" {
+			clay.TEXT(fileStatus, clay.T{TextColor: util.Tern(fileStatusIsError, Red, LightGray)})
+		}
+	})
+}
@@ -0,0 +1,307 @@
+package app
+
+import (
+	"cmp"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bvisness/flowshell/clay"
+	"github.com/bvisness/flowshell/core"
+	"github.com/bvisness/flowshell/util"
+)
+
+type OutputTab int
+
+const (
+	OutputTabResult  OutputTab = iota // The selected node's latest result
+	OutputTabHistory                  // Recent runs of the graph
+	OutputTabConsole                  // Log messages, unless the console is docked elsewhere
+)
+
+var outputTab OutputTab
+
+// Runs expanded in the history panel, by run ID.
+var expandedRuns = make(map[int]bool)
+
+// Node entries expanded in the history panel to show their outputs.
+var expandedNodeRuns = make(map[expandedNodeRunKey]bool)
+
+type expandedNodeRunKey struct {
+	RunID  int
+	NodeID int
+}
+
+func UIOutputTabs() {
+	clay.CLAY_AUTO_ID(clay.EL{
+		Layout: clay.LAY{Sizing: GROWH, ChildGap: S1, Padding: PD(0, 0, S2, 0, clay.Padding{})},
+		Border: clay.B{Width: BB, Color: Gray},
+	}, func() {
+		for _, tab := range []struct {
+			Tab  OutputTab
+			Name string
+		}{
+			{OutputTabResult, "Output"},
+			{OutputTabHistory, "History"},
+			{OutputTabConsole, "Console"},
+		} {
+			if tab.Tab == OutputTabConsole && consoleDock != ConsoleDockPanel {
+				continue
+			}
+			selected := outputTab == tab.Tab
+			UIButton(clay.AUTO_ID, UIButtonConfig{
+				El: clay.EL{
+					Layout:          clay.LAY{Padding: PVH(S1, S2)},
+					BackgroundColor: util.Tern(selected, Gray, clay.Color{}),
+					CornerRadius:    RA1,
+				},
+				OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+					outputTab = tab.Tab
+				},
+			}, func() {
+				clay.TEXT(tab.Name, clay.TextElementConfig{
+					FontID:    util.Tern(selected, InterSemibold, InterRegular),
+					TextColor: util.Tern(selected, White, LightGray),
+				})
+			})
+		}
+	})
+	UISpacer(clay.AUTO_ID, WH(1, S2))
+}
+
+// Lists the graph's recent runs, most recent first, along with a comparison of
+// the selected node's last two runs.
+func UIRunHistory(g *core.Graph) {
+	if selected, ok := g.Selected(); ok {
+		UINodeRunComparison(g, selected)
+	}
+
+	history := g.History()
+	if len(history) == 0 {
+		clay.TEXT("Nothing has run yet.", clay.TextElementConfig{TextColor: LightGray})
+		return
+	}
+	clay.CLAY_AUTO_ID(clay.EL{
+		Layout: clay.LAY{LayoutDirection: clay.TopToBottom, Sizing: GROWH, ChildGap: S1},
+	}, func() {
+		for i := len(history) - 1; i >= 0; i-- {
+			UIRunRecord(history[i])
+		}
+	})
+}
+
+func UIRunRecord(run core.RunRecord) {
+	clay.CLAY_AUTO_ID(clay.EL{
+		Layout: clay.LAY{Sizing: GROWH, ChildGap: S1, ChildAlignment: YCENTER},
+	}, func() {
+		UIButton(clay.AUTO_ID, UIButtonConfig{
+			OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+				expandedRuns[run.ID] = !expandedRuns[run.ID]
+			},
+		}, func() {
+			UIImage(clay.AUTO_ID, util.Tern(expandedRuns[run.ID], ImgToggleDown, ImgToggleRight), clay.EL{})
+		})
+		clay.TEXT(fmt.Sprintf("#%d %s", run.ID, run.Target.Name), clay.TextElementConfig{FontID: InterSemibold, TextColor: White})
+		clay.TEXT(run.Start.Format(time.TimeOnly), clay.TextElementConfig{TextColor: LightGray})
+		UISpacer(clay.AUTO_ID, GROWH)
+		if run.Done() {
+			clay.TEXT(FormatDuration(run.Duration()), clay.TextElementConfig{TextColor: White})
+		} else {
+			clay.TEXT("Running...", clay.TextElementConfig{TextColor: White})
+		}
+	})
+
+	failed := slices.ContainsFunc(run.Nodes, func(nr core.NodeRunRecord) bool {
+		return nr.Status == core.NodeRunExecuted && nr.Err != nil
+	})
+	clay.CLAY_AUTO_ID(clay.EL{
+		Layout: clay.LAY{Padding: PD(0, 0, 0, S3+S1, clay.Padding{})},
+	}, func() {
+		clay.TEXT(summarizeRun(run), clay.TextElementConfig{TextColor: util.Tern(failed, Red, LightGray)})
+	})
+
+	if !expandedRuns[run.ID] {
+		return
+	}
+
+	// Slowest first, to show where the time went.
+	nodes := slices.Clone(run.Nodes)
+	slices.SortStableFunc(nodes, func(a, b core.NodeRunRecord) int {
+		return cmp.Compare(b.Duration(), a.Duration())
+	})
+	var slowest time.Duration
+	if len(nodes) > 0 {
+		slowest = nodes[0].Duration()
+	}
+
+	clay.CLAY_AUTO_ID(clay.EL{
+		Layout: clay.LAY{
+			LayoutDirection: clay.TopToBottom,
+			Sizing:          GROWH,
+			ChildGap:        S1,
+			Padding:         PD(0, 0, S2, S3+S1, clay.Padding{}),
+		},
+	}, func() {
+		for _, nr := range nodes {
+			UINodeRunRecord(nr, slowest)
+		}
+	})
+}
+
+// Counts what happened to the nodes in a run, e.g. "2 executed, 1 reused".
+func summarizeRun(run core.RunRecord) string {
+	var counts [core.NodeRunSkipped + 1]int
+	failures := 0
+	for _, nr := range run.Nodes {
+		counts[nr.Status]++
+		if nr.Status == core.NodeRunExecuted && nr.Err != nil {
+			failures++
+		}
+	}
+
+	var bits []string
+	for status, count := range counts {
+		if count > 0 {
+			bits = append(bits, fmt.Sprintf("%d %s", count, strings.ToLower(core.NodeRunStatus(status).String())))
+		}
+	}
+	if failures > 0 {
+		bits = append(bits, fmt.Sprintf("%d failed", failures))
+	}
+	return strings.Join(bits, ", ")
+}
+
+func UINodeRunRecord(nr core.NodeRunRecord, slowest time.Duration) {
+	key := expandedNodeRunKey{RunID: nr.RunID, NodeID: nr.Node.ID}
+	clay.CLAY_AUTO_ID(clay.EL{
+		Layout: clay.LAY{LayoutDirection: clay.TopToBottom, Sizing: GROWH},
+	}, func() {
+		UIButton(clay.AUTO_ID, UIButtonConfig{
+			El: clay.EL{
+				Layout: clay.LAY{Sizing: GROWH, ChildGap: S2, ChildAlignment: YCENTER},
+			},
+			OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+				expandedNodeRuns[key] = !expandedNodeRuns[key]
+			},
+		}, func() {
+			clay.TEXT(fmt.Sprintf("%s (#%d)", nr.Node.Name, nr.Node.ID), clay.TextElementConfig{TextColor: White})
+			clay.TEXT(nr.Status.String(), clay.TextElementConfig{TextColor: nodeRunStatusColor(nr)})
+			UISpacer(clay.AUTO_ID, GROWH)
+			if !nr.Start.IsZero() {
+				clay.TEXT(FormatDuration(nr.Duration()), clay.TextElementConfig{TextColor: LightGray})
+			}
+		})
+
+		// A bar showing the node's share of the slowest node's time
+		if slowest > 0 && nr.Duration() > 0 {
+			clay.CLAY_AUTO_ID(clay.EL{
+				Layout: clay.LAY{Sizing: clay.Sizing{
+					Width:  clay.SizingPercent(float32(nr.Duration()) / float32(slowest)),
+					Height: clay.SizingFixed(2),
+				}},
+				BackgroundColor: Blue,
+			})
+		}
+
+		if expandedNodeRuns[key] {
+			clay.CLAY_AUTO_ID(clay.EL{
+				Layout: clay.LAY{LayoutDirection: clay.TopToBottom, ChildGap: S1, Padding: PD(S1, 0, S1, S2, clay.Padding{})},
+			}, func() {
+				if nr.Err != nil {
+					clay.TEXT(nr.Err.Error(), clay.TextElementConfig{TextColor: Red})
+				}
+				for i, output := range nr.Outputs {
+					if i < len(nr.Node.OutputPorts) {
+						clay.TEXT(nr.Node.OutputPorts[i].Name, clay.TextElementConfig{FontID: InterSemibold, TextColor: White})
+					}
+					UIFlowValue(output)
+				}
+				if nr.OutputsDiscarded {
+					clay.TEXT("Outputs are only kept for recent runs.", clay.TextElementConfig{TextColor: LightGray})
+				}
+			})
+		}
+	})
+}
+
+func nodeRunStatusColor(nr core.NodeRunRecord) clay.Color {
+	switch {
+	case nr.Err != nil && nr.Status == core.NodeRunExecuted:
+		return Red
+	case nr.Status == core.NodeRunExecuted:
+		return PlayButtonGreen
+	case nr.Status == core.NodeRunCached:
+		return Blue
+	default:
+		return LightGray
+	}
+}
+
+// Compares the node's latest run with the one before, so you can see what
+// changed.
+func UINodeRunComparison(g *core.Graph, n *core.Node) {
+	// Only runs where the node actually produced a result are interesting.
+	var runs []core.NodeRunRecord
+	for _, nr := range g.NodeHistory(n) {
+		if (nr.Status == core.NodeRunExecuted || nr.Status == core.NodeRunCached) && !nr.End.IsZero() {
+			runs = append(runs, nr)
+		}
+	}
+
+	clay.CLAY_AUTO_ID(clay.EL{
+		Layout: clay.LAY{
+			LayoutDirection: clay.TopToBottom,
+			Sizing:          GROWH,
+			ChildGap:        S1,
+			Padding:         PD(0, 0, S2, 0, PA2),
+		},
+		BackgroundColor: DarkGray,
+		CornerRadius:    RA2,
+	}, func() {
+		clay.TEXT(fmt.Sprintf("%s: this run vs last run", n.Name), clay.TextElementConfig{FontID: InterSemibold, TextColor: White})
+		if len(runs) == 0 {
+			clay.TEXT("This node hasn't run yet.", clay.TextElementConfig{TextColor: LightGray})
+			return
+		}
+
+		latest := runs[0]
+		clay.TEXT(fmt.Sprintf("This run (#%d): %s in %s", latest.RunID, strings.ToLower(latest.Status.String()), FormatDuration(latest.Duration())),
+			clay.TextElementConfig{TextColor: White})
+		if len(runs) == 1 {
+			clay.TEXT("No earlier run to compare with.", clay.TextElementConfig{TextColor: LightGray})
+			return
+		}
+
+		last := runs[1]
+		clay.TEXT(fmt.Sprintf("Last run (#%d): %s in %s", last.RunID, strings.ToLower(last.Status.String()), FormatDuration(last.Duration())),
+			clay.TextElementConfig{TextColor: LightGray})
+
+		delta := latest.Duration() - last.Duration()
+		clay.TEXT(fmt.Sprintf("%s %s", util.Tern(delta < 0, "Faster by", "Slower by"), FormatDuration(delta.Abs())),
+			clay.TextElementConfig{TextColor: LightGray})
+
+		switch {
+		case (latest.Err == nil) != (last.Err == nil):
+			clay.TEXT(util.Tern(latest.Err != nil, "Failed this time", "Succeeded this time"), clay.TextElementConfig{TextColor: util.Tern(latest.Err != nil, Red, White)})
+		case reflect.DeepEqual(latest.Outputs, last.Outputs):
+			clay.TEXT("Outputs unchanged", clay.TextElementConfig{TextColor: LightGray})
+		default:
+			clay.TEXT("Outputs changed", clay.TextElementConfig{TextColor: White})
+		}
+	})
+}
+
+func FormatDuration(d time.Duration) string {
+	switch {
+	case d < time.Millisecond:
+		return fmt.Sprintf("%d us", d.Microseconds())
+	case d < time.Second:
+		return fmt.Sprintf("%.1f ms", float64(d)/float64(time.Millisecond))
+	case d < time.Minute:
+		return fmt.Sprintf("%.2f s", d.Seconds())
+	default:
+		return d.Round(time.Second).String()
+	}
+}
@@ -0,0 +1,89 @@
+package app
+
+import (
+	"github.com/bvisness/flowshell/clay"
+	"github.com/bvisness/flowshell/core"
+)
+
+func UIFilterNode(g *core.Graph, n *core.Node, a *core.FilterAction) {
+	clay.CLAY_AUTO_ID(clay.EL{
+		Layout: clay.LAY{
+			LayoutDirection: clay.TopToBottom,
+			Sizing:          GROWH,
+			ChildGap:        S2,
+		},
+	}, func() {
+		clay.CLAY_AUTO_ID(clay.EL{
+			Layout: clay.LAY{
+				Sizing:         GROWH,
+				ChildAlignment: YCENTER,
+			},
+		}, func() {
+			UIInputPort(n, 0)
+			UISpacer(clay.AUTO_ID, GROWH)
+			UIOutputPort(n, 0)
+		})
+
+		UIDropdown(clay.AUTO_ID, &a.Mode, UIDropdownConfig{
+			El: clay.EL{
+				Layout: clay.LAY{Sizing: GROWH},
+			},
+			OnChange: func(before, after any) {
+				a.ModeChanged(n, before.(string))
+				n.MarkChanged(g)
+			},
+		})
+
+		mode := a.Mode.GetSelectedOption().Value
+		if mode == core.FilterExpression {
+			UITextBox(clay.IDI("FilterExpr", n.ID), &a.Expr, UITextBoxConfig{
+				El:       clay.EL{Layout: clay.LAY{Sizing: GROWH}},
+				OnChange: func(string) { n.MarkStale(g) },
+				OnSubmit: func(string) { n.MarkChanged(g) },
+			})
+		} else {
+			clay.CLAY_AUTO_ID(clay.EL{
+				Layout: clay.LAY{
+					Sizing:         GROWH,
+					ChildGap:       S2,
+					ChildAlignment: YCENTER,
+				},
+			}, func() {
+				// Lists of plain values have no columns; the item itself is
+				// checked.
+				if len(a.Columns.Options) > 0 {
+					UIDropdown(clay.AUTO_ID, &a.Columns, UIDropdownConfig{
+						El: clay.EL{
+							Layout: clay.LAY{Sizing: GROWH},
+						},
+						OnChange: func(before, after any) {
+							a.Column = after.(string)
+							n.MarkChanged(g)
+						},
+					})
+				}
+				if mode == core.FilterCompare {
+					UIDropdown(clay.AUTO_ID, &a.Op, UIDropdownConfig{
+						El: clay.EL{
+							Layout: clay.LAY{Sizing: GROWH},
+						},
+						OnChange: func(before, after any) {
+							n.MarkChanged(g)
+						},
+					})
+				}
+			})
+			if mode == core.FilterCompare {
+				UITextBox(clay.IDI("FilterValue", n.ID), &a.Value, UITextBoxConfig{
+					El:       clay.EL{Layout: clay.LAY{Sizing: GROWH}},
+					OnChange: func(string) { n.MarkStale(g) },
+					OnSubmit: func(string) { n.MarkChanged(g) },
+				})
+			}
+		}
+
+		if a.Err != nil {
+			clay.TEXT(a.Err.Error(), clay.TextElementConfig{TextColor: Red})
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/bvisness/flowshell/clay"
+	"github.com/bvisness/flowshell/core"
+)
+
+func UIForEachNode(g *core.Graph, n *core.Node, a *core.ForEachAction) {
+	clay.CLAY_AUTO_ID(clay.EL{
+		Layout: clay.LAY{
+			LayoutDirection: clay.TopToBottom,
+			Sizing:          GROWH,
+			ChildGap:        S2,
+		},
+	}, func() {
+		clay.CLAY_AUTO_ID(clay.EL{
+			Layout: clay.LAY{
+				Sizing:         GROWH,
+				ChildGap:       S2,
+				ChildAlignment: YCENTER,
+			},
+		}, func() {
+			UIOpenSubgraphButton(n)
+			UISpacer(clay.AUTO_ID, GROWH)
+
+			buttonStyle := clay.EL{
+				Layout: clay.LAY{
+					Sizing:         WH(24, 24),
+					ChildAlignment: ALLCENTER,
+				},
+				Border: clay.B{Width: BA, Color: Gray},
+			}
+			buttonTextConfig := clay.T{FontID: InterSemibold, FontSize: F2, TextColor: White}
+
+			clay.TEXT(fmt.Sprintf("%d at a time", max(a.Concurrency, 1)), clay.T{TextColor: White})
+			if clay.Hovered() {
+				UITooltip("How many items to run at once")
+			}
+			UIButton(clay.AUTO_ID, UIButtonConfig{ // -
+				El: buttonStyle,
+				OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+					a.SetConcurrency(a.Concurrency - 1)
+				},
+			}, func() {
+				clay.TEXT("-", buttonTextConfig)
+			})
+			UIButton(clay.AUTO_ID, UIButtonConfig{ // +
+				El: buttonStyle,
+				OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+					a.SetConcurrency(a.Concurrency + 1)
+				},
+			}, func() {
+				clay.TEXT("+", buttonTextConfig)
+			})
+		})
+		UIPortColumns(n)
+	})
+}
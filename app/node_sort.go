@@ -0,0 +1,100 @@
+package app
+
+import (
+	"github.com/bvisness/flowshell/clay"
+	"github.com/bvisness/flowshell/core"
+	"github.com/bvisness/flowshell/util"
+)
+
+func UISortNode(g *core.Graph, n *core.Node, a *core.SortAction) {
+	clay.CLAY_AUTO_ID(clay.EL{
+		Layout: clay.LAY{
+			LayoutDirection: clay.TopToBottom,
+			Sizing:          GROWH,
+			ChildGap:        S2,
+		},
+	}, func() {
+		clay.CLAY_AUTO_ID(clay.EL{
+			Layout: clay.LAY{
+				Sizing:         GROWH,
+				ChildAlignment: YCENTER,
+			},
+		}, func() {
+			UIInputPort(n, 0)
+			UISpacer(clay.AUTO_ID, GROWH)
+			UIOutputPort(n, 0)
+		})
+
+		for i := range a.Keys {
+			key := &a.Keys[i]
+			clay.CLAY_AUTO_ID(clay.EL{
+				Layout: clay.LAY{
+					Sizing:         GROWH,
+					ChildGap:       S2,
+					ChildAlignment: YCENTER,
+				},
+			}, func() {
+				clay.TEXT(util.Tern(i == 0, "By", "Then"), clay.T{TextColor: White})
+				// Lists of plain values have no columns; the items themselves
+				// are sorted.
+				if len(key.Columns.Options) > 0 {
+					UIDropdown(clay.AUTO_ID, &key.Columns, UIDropdownConfig{
+						El: clay.EL{
+							Layout: clay.LAY{Sizing: GROWH},
+						},
+						OnChange: func(before, after any) {
+							key.Column = after.(string)
+							n.MarkChanged(g)
+						},
+					})
+				}
+				UIDropdown(clay.AUTO_ID, &key.Order, UIDropdownConfig{
+					El: clay.EL{
+						Layout: clay.LAY{Sizing: GROWH},
+					},
+					OnChange: func(before, after any) {
+						n.MarkChanged(g)
+					},
+				})
+			})
+		}
+
+		clay.CLAY_AUTO_ID(clay.EL{
+			Layout: clay.LAY{
+				Sizing:         GROWH,
+				ChildAlignment: YCENTER,
+			},
+		}, func() {
+			buttonStyle := clay.EL{
+				Layout: clay.LAY{
+					Sizing:         WH(24, 24),
+					ChildAlignment: ALLCENTER,
+				},
+				Border: clay.B{Width: BA, Color: Gray},
+			}
+			buttonTextConfig := clay.T{FontID: InterSemibold, FontSize: F2, TextColor: White}
+
+			UIButton(clay.AUTO_ID, UIButtonConfig{ // -
+				El: buttonStyle,
+				OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+					a.RemoveKey(g, n)
+				},
+			}, func() {
+				clay.TEXT("-", buttonTextConfig)
+			})
+			UISpacer(clay.AUTO_ID, W1)
+			UIButton(clay.AUTO_ID, UIButtonConfig{ // +
+				El: buttonStyle,
+				OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+					a.AddKey(g, n)
+				},
+			}, func() {
+				clay.TEXT("+", buttonTextConfig)
+			})
+		})
+
+		if a.Err != nil {
+			clay.TEXT(a.Err.Error(), clay.TextElementConfig{TextColor: Red})
+		}
+	})
+}
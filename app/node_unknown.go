@@ -0,0 +1,38 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/bvisness/flowshell/clay"
+	"github.com/bvisness/flowshell/core"
+)
+
+func UIUnknownNode(g *core.Graph, n *core.Node, a *core.UnknownAction) {
+	clay.CLAY_AUTO_ID(clay.EL{
+		Layout: clay.LAY{
+			LayoutDirection: clay.TopToBottom,
+			Sizing:          GROWH,
+			ChildGap:        S2,
+		},
+	}, func() {
+		clay.TEXT(fmt.Sprintf("Unknown node: %s", a.Tag()), clay.T{TextColor: Red})
+
+		// Keep the ports around so that wires still have somewhere to attach.
+		for i := range max(len(n.InputPorts), len(n.OutputPorts)) {
+			clay.CLAY_AUTO_ID(clay.EL{
+				Layout: clay.LAY{
+					Sizing:         GROWH,
+					ChildAlignment: YCENTER,
+				},
+			}, func() {
+				if i < len(n.InputPorts) {
+					UIInputPort(n, i)
+				}
+				UISpacer(clay.AUTO_ID, GROWH)
+				if i < len(n.OutputPorts) {
+					UIOutputPort(n, i)
+				}
+			})
+		}
+	})
+}
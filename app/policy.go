@@ -0,0 +1,132 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bvisness/flowshell/clay"
+	"github.com/bvisness/flowshell/core"
+	"github.com/bvisness/flowshell/util"
+)
+
+// Text being edited in a node's run policy settings. It is applied to the node
+// whenever it is valid.
+type policyEditState struct {
+	Timeout, Attempts, Backoff string
+	Err                        error
+}
+
+func newPolicyEditState(p core.RunPolicy) *policyEditState {
+	formatDuration := func(d time.Duration) string {
+		return util.Tern(d == 0, "", d.String())
+	}
+	return &policyEditState{
+		Timeout:  formatDuration(p.Timeout),
+		Attempts: util.Tern(p.MaxAttempts == 0, "", strconv.Itoa(p.MaxAttempts)),
+		Backoff:  formatDuration(p.Backoff),
+	}
+}
+
+// Parses the settings. Blank fields mean the default: no timeout, one attempt,
+// and no backoff.
+func (e *policyEditState) Parse() (core.RunPolicy, error) {
+	var p core.RunPolicy
+	parseDuration := func(name, str string) (time.Duration, error) {
+		if strings.TrimSpace(str) == "" {
+			return 0, nil
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(str))
+		if err != nil || d < 0 {
+			return 0, fmt.Errorf("%s must be a duration like 30s or 2m", name)
+		}
+		return d, nil
+	}
+
+	var errs []error
+	var err error
+	p.Timeout, err = parseDuration("Timeout", e.Timeout)
+	errs = append(errs, err)
+	p.Backoff, err = parseDuration("Backoff", e.Backoff)
+	errs = append(errs, err)
+	if str := strings.TrimSpace(e.Attempts); str != "" {
+		p.MaxAttempts, err = strconv.Atoi(str)
+		if err != nil || p.MaxAttempts < 1 {
+			errs = append(errs, errors.New("Attempts must be a whole number of at least 1"))
+		}
+	}
+	return p, errors.Join(errs...)
+}
+
+// The header button that opens a node's run policy settings.
+func UIRunPolicyButton(n *core.Node) {
+	nodeUI := NodeUI(n)
+	isDefault := n.Policy == core.RunPolicy{}
+	UIButton(clay.AUTO_ID, UIButtonConfig{
+		El: clay.EL{Layout: clay.LAY{Padding: PA1}},
+		OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+			if nodeUI.policyEdit == nil {
+				nodeUI.policyEdit = newPolicyEditState(n.Policy)
+			} else {
+				nodeUI.policyEdit = nil
+			}
+		},
+	}, func() {
+		clay.TEXT(util.Tern(isDefault, "Limits", n.Policy.String()), clay.TextElementConfig{TextColor: util.Tern(isDefault, LightGray, White)})
+		if clay.Hovered() {
+			UITooltip("Time limit and retries")
+		}
+	})
+}
+
+// Edits a node's timeout and retries, below its header.
+func UIRunPolicy(n *core.Node) {
+	edit := NodeUI(n).policyEdit
+	if edit == nil {
+		return
+	}
+	apply := func(string) {
+		var p core.RunPolicy
+		p, edit.Err = edit.Parse()
+		if edit.Err == nil {
+			n.SetPolicy(p)
+		}
+	}
+
+	clay.CLAY_AUTO_ID(clay.EL{
+		Layout:          clay.LAY{LayoutDirection: clay.TopToBottom, Sizing: GROWH, ChildGap: S1, Padding: PA2},
+		BackgroundColor: Charcoal,
+		Border:          clay.B{Width: BT, Color: Gray},
+	}, func() {
+		for _, field := range []struct {
+			Name, Placeholder string
+			Str               *string
+		}{
+			{"Timeout", "none", &edit.Timeout},
+			{"Attempts", "1", &edit.Attempts},
+			{"Backoff", "0s", &edit.Backoff},
+		} {
+			clay.CLAY_AUTO_ID(clay.EL{
+				Layout: clay.LAY{Sizing: GROWH, ChildGap: S2, ChildAlignment: YCENTER},
+			}, func() {
+				clay.CLAY_AUTO_ID(clay.EL{Layout: clay.LAY{Sizing: clay.Sizing{Width: PX(70)}}}, func() {
+					clay.TEXT(field.Name, clay.TextElementConfig{TextColor: LightGray})
+				})
+				UITextBox(clay.IDI("RunPolicy"+field.Name, n.ID), field.Str, UITextBoxConfig{
+					El:       clay.EL{Layout: clay.LAY{Sizing: GROWH}},
+					OnChange: apply,
+				})
+				if *field.Str == "" {
+					clay.TEXT(field.Placeholder, clay.TextElementConfig{TextColor: Gray})
+				}
+			})
+		}
+		if edit.Err != nil {
+			clay.TEXT(edit.Err.Error(), clay.TextElementConfig{TextColor: Red})
+		} else {
+			clay.TEXT("Each attempt gets the full timeout. Backoff doubles after each retry.", clay.TextElementConfig{TextColor: LightGray})
+		}
+	})
+}
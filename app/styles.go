@@ -14,6 +14,7 @@ var LightGray = clay.Color{157, 161, 170, 255}
 var White = clay.Color{250, 250, 252, 255}
 var Red = clay.Color{214, 25, 50, 255}
 var Blue = clay.Color{11, 88, 183, 255}
+var Orange = clay.Color{225, 138, 50, 255}
 
 var PlayButtonGreen = clay.Color{61, 159, 72, 255}
 var HoverWhite = clay.Color{255, 255, 255, 20}
@@ -1,12 +1,14 @@
 package app
 
 import (
+	"errors"
 	"fmt"
 	"runtime"
 	"slices"
 	"time"
 
 	"github.com/bvisness/flowshell/clay"
+	"github.com/bvisness/flowshell/core"
 	"github.com/bvisness/flowshell/util"
 	rl "github.com/gen2brain/raylib-go/raylib"
 	"github.com/lithammer/fuzzysearch/fuzzy"
@@ -17,34 +19,41 @@ const MenuMaxWidth = 0 // no max
 
 const NodeMinWidth = 360
 
-var nodes []*Node
+// The graph being edited.
+var graph = core.NewGraph()
 
 type NodeType struct {
 	Name   string
-	Create func() *Node
+	Create func() *core.Node
 }
 
 var nodeTypes = []NodeType{
-	{"Run Process", func() *Node { return NewRunProcessNode(util.Tern(runtime.GOOS == "Windows", "dir", "ls")) }},
-	{"List Files", func() *Node { return NewListFilesNode(".") }},
-	{"Lines", func() *Node { return NewLinesNode() }},
-	{"Load File", func() *Node { return NewLoadFileNode("") }},
-	{"Save File", func() *Node { return NewSaveFileNode("") }},
-	{"Trim Spaces", func() *Node { return NewTrimSpacesNode() }},
-	{"Min", func() *Node { return NewAggregateNode("Min") }},
-	{"Max", func() *Node { return NewAggregateNode("Max") }},
-	{"Mean (Average)", func() *Node { return NewAggregateNode("Mean") }},
-	{"Concatenate Tables (Combine Rows)", func() *Node { return NewConcatTablesNode() }},
+	{"Run Process", func() *core.Node { return core.NewRunProcessNode(util.Tern(runtime.GOOS == "Windows", "dir", "ls")) }},
+	{"List Files", func() *core.Node { return core.NewListFilesNode(".") }},
+	{"Lines", func() *core.Node { return core.NewLinesNode() }},
+	{"Load File", func() *core.Node { return core.NewLoadFileNode("") }},
+	{"Save File", func() *core.Node { return core.NewSaveFileNode("") }},
+	{"Trim Spaces", func() *core.Node { return core.NewTrimSpacesNode() }},
+	{"Min", func() *core.Node { return core.NewAggregateNode("Min") }},
+	{"Max", func() *core.Node { return core.NewAggregateNode("Max") }},
+	{"Mean (Average)", func() *core.Node { return core.NewAggregateNode("Mean") }},
+	{"Concatenate Tables (Combine Rows)", func() *core.Node { return core.NewConcatTablesNode() }},
+	{"Filter (Not Empty)", func() *core.Node { return core.NewFilterNode(core.FilterNonEmpty) }},
+	{"Filter (Compare)", func() *core.Node { return core.NewFilterNode(core.FilterCompare) }},
+	{"Filter (Expression)", func() *core.Node { return core.NewFilterNode(core.FilterExpression) }},
+	{"Sort", func() *core.Node { return core.NewSortNode() }},
+	{"For Each", func() *core.Node { return core.NewForEachNode() }},
 }
 
 func SearchNodeTypes(search string) []NodeType {
 	var names []string
-	for _, t := range nodeTypes {
+	types := append(slices.Clone(nodeTypes), compositeNodeTypes()...)
+	for _, t := range types {
 		names = append(names, t.Name)
 	}
 
 	if search == "" || search == "?" || search == "*" {
-		return nodeTypes
+		return types
 	}
 
 	ranks := fuzzy.RankFindFold(search, names)
@@ -54,7 +63,7 @@ func SearchNodeTypes(search string) []NodeType {
 	var res []NodeType
 nextrank:
 	for _, rank := range ranks {
-		for _, t := range nodeTypes {
+		for _, t := range types {
 			if t.Name == rank.Target {
 				res = append(res, t)
 				continue nextrank
@@ -64,32 +73,14 @@ nextrank:
 	return res
 }
 
-var wires []*Wire
-
-var selectedNodeID = 0
-
-func GetSelectedNode() (*Node, bool) {
-	for _, node := range nodes {
-		if node.ID == selectedNodeID {
-			return node, true
-		}
-	}
-	return nil, false
-}
-
-func NodeInputs(n *Node) []*Node {
-	var res []*Node
-	for _, wire := range wires {
-		if wire.EndNode == n && !slices.Contains(res, wire.StartNode) {
-			res = append(res, wire.StartNode)
-		}
+func DeleteNode(g *core.Graph, n *core.Node) {
+	switch n.Action.(type) {
+	case *core.SubgraphInputsAction, *core.SubgraphOutputsAction:
+		return // the node containing the subgraph needs these
 	}
-	return res
-}
-
-func DeleteNode(id int) {
-	nodes = slices.DeleteFunc(nodes, func(node *Node) bool { return node.ID == id })
-	wires = slices.DeleteFunc(wires, func(wire *Wire) bool { return wire.StartNode.ID == id || wire.EndNode.ID == id })
+	n.MarkStale(g) // everything downstream just lost an input
+	g.RemoveNode(n)
+	delete(nodeUIStates, n)
 }
 
 var UICursor rl.MouseCursor
@@ -100,41 +91,46 @@ func IsFocused(id clay.ElementID) bool {
 }
 
 func beforeLayout() {
-	if rl.IsKeyPressed(rl.KeyDelete) && UIFocus == nil && selectedNodeID != 0 {
-		DeleteNode(selectedNodeID)
-		selectedNodeID = 0
+	handleCompositeShortcuts() // before the file prompt sees Escape
+	handleFileShortcuts()
+	handleConsoleShortcuts()
+	pollWatchedFiles()
+
+	if selected, ok := graph.Selected(); ok && rl.IsKeyPressed(rl.KeyDelete) && UIFocus == nil {
+		DeleteNode(graph, selected)
 	}
 
 	if rl.IsFileDropped() {
 		for i, filename := range rl.LoadDroppedFiles() {
-			n := NewLoadFileNode(filename)
-			n.Pos = V2(clay.V2(rl.GetMousePosition()).Plus(clay.V2{20, 20}.Times(float32(i))))
-			nodes = append(nodes, n)
-			selectedNodeID = n.ID
+			n := core.NewLoadFileNode(filename)
+			n.Pos = core.V2(rl.Vector2Subtract(V2(clay.V2(rl.GetMousePosition()).Plus(clay.V2{20, 20}.Times(float32(i)))), Pan))
+			graph.AddNode(n)
+			graph.Select(n)
 		}
 	}
 
-	for _, n := range nodes {
+	for _, n := range graph.Nodes() {
 		// Node drag and drop
-		drag.TryStartDrag(n, n.DragRect, n.Pos)
-		if draggingThisNode, done, canceled := drag.State(n); draggingThisNode {
-			n.Pos = drag.NewObjPosition()
+		nodeUI := NodeUI(n)
+		drag.TryStartDrag(NodeDragKey(n), nodeUI.DragRect, V2(n.Pos))
+		if draggingThisNode, done, canceled := drag.State(NodeDragKey(n)); draggingThisNode {
+			n.Pos = core.V2(drag.NewObjPosition())
 			if done {
 				if canceled {
-					n.Pos = drag.ObjStart
+					n.Pos = core.V2(drag.ObjStart)
 				}
 			}
 		}
 
 		// Selected node keyboard shortcuts
-		if selectedNodeID == n.ID {
+		if graph.IsSelected(n) {
 			if rl.IsKeyPressed(rl.KeyR) && (rl.IsKeyDown(rl.KeyLeftControl) || rl.IsKeyDown(rl.KeyRightControl)) {
-				n.Run(rl.IsKeyDown(rl.KeyLeftShift) || rl.IsKeyDown(rl.KeyRightShift))
+				n.Run(graph, rl.IsKeyDown(rl.KeyLeftShift) || rl.IsKeyDown(rl.KeyRightShift))
 			}
 		}
 
 		// Starting new wires
-		for i, portPos := range n.OutputPortPositions {
+		for i, portPos := range nodeUI.OutputPortPositions {
 			portRect := rl.Rectangle{
 				X:      portPos.X - PortDragRadius,
 				Y:      portPos.Y - PortDragRadius,
@@ -146,16 +142,17 @@ func beforeLayout() {
 				NewWireSourcePort = i
 			}
 		}
-		for i, portPos := range n.InputPortPositions {
+		for i, portPos := range nodeUI.InputPortPositions {
 			portRect := rl.Rectangle{
 				X:      portPos.X - PortDragRadius,
 				Y:      portPos.Y - PortDragRadius,
 				Width:  PortDragRadius * 2,
 				Height: PortDragRadius * 2,
 			}
-			if wire, hasWire := n.GetInputWire(i); hasWire {
+			if wire, hasWire := n.GetInputWire(graph, i); hasWire {
 				if drag.TryStartDrag(NewWireDragKey, portRect, V2{}) {
-					wires = slices.DeleteFunc(wires, func(w *Wire) bool { return w == wire })
+					graph.Disconnect(wire)
+					n.MarkChanged(graph)
 					NewWireSourceNode = wire.StartNode
 					NewWireSourcePort = wire.StartPort
 				}
@@ -167,8 +164,8 @@ func beforeLayout() {
 	if draggingNewWire, done, canceled := drag.State(NewWireDragKey); draggingNewWire {
 		if done && !canceled {
 			// Loop over nodes to find any you may have dropped on
-			for _, node := range nodes {
-				for port, portPos := range node.InputPortPositions {
+			for _, node := range graph.Nodes() {
+				for port, portPos := range NodeUI(node).InputPortPositions {
 					portRect := rl.Rectangle{
 						X:      portPos.X - PortDragRadius,
 						Y:      portPos.Y - PortDragRadius,
@@ -176,15 +173,12 @@ func beforeLayout() {
 						Height: PortDragRadius * 2,
 					}
 
-					if rl.CheckCollisionPointRec(rl.GetMousePosition(), portRect) && node != NewWireSourceNode {
-						// Delete existing wires into that port
-						wires = slices.DeleteFunc(wires, func(wire *Wire) bool {
-							return wire.EndNode == node && wire.EndPort == port
-						})
-						wires = append(wires, &Wire{
-							StartNode: NewWireSourceNode, EndNode: node,
-							StartPort: NewWireSourcePort, EndPort: port,
-						})
+					if rl.CheckCollisionPointRec(rl.GetMousePosition(), portRect) {
+						// The graph refuses wires that would form a cycle (including
+						// wiring a node to itself) or whose types don't match.
+						if _, err := graph.Connect(NewWireSourceNode, NewWireSourcePort, node, port); err == nil {
+							node.MarkChanged(graph)
+						}
 					}
 				}
 			}
@@ -226,9 +220,7 @@ func beforeLayout() {
 			if panning, _, _ := drag.State(PanDragKey); panning {
 				mousePos := rl.GetMousePosition()
 				delta := rl.Vector2Subtract(mousePos, LastPanMousePosition)
-				for _, n := range nodes {
-					n.Pos = rl.Vector2Add(n.Pos, delta)
-				}
+				Pan = rl.Vector2Add(Pan, delta)
 				LastPanMousePosition = mousePos
 			}
 		}
@@ -242,10 +234,13 @@ const PanDragKey = "PAN"
 
 var LastPanMousePosition V2
 
+// The offset of the node canvas. Node positions are relative to this.
+var Pan V2
+
 const NewWireDragKey = "NEW_WIRE"
 const PortDragRadius = 5
 
-var NewWireSourceNode *Node
+var NewWireSourceNode *core.Node
 var NewWireSourcePort int
 
 var NewNodeName string
@@ -253,205 +248,172 @@ var NewNodeName string
 var OutputWindowWidth float32 = windowWidth * 0.30
 
 func ui() {
-	// Sweep the graph, validating all nodes
-	// TODO: TOPOSORT
-	for _, node := range nodes {
-		node.Action.UpdateAndValidate(node)
-	}
+	RootGraph().Validate() // nodes with subgraphs validate the graphs inside them
 
 	clay.CLAY(clay.ID("Background"), clay.EL{
-		Layout:          clay.LAY{Sizing: GROWALL},
+		Layout:          clay.LAY{LayoutDirection: clay.TopToBottom, Sizing: GROWALL},
 		BackgroundColor: Night,
 		Border:          clay.BorderElementConfig{Width: BTW, Color: LightGray},
 	}, func() {
-		clay.CLAY(clay.ID("NodeCanvas"), clay.EL{
+		clay.CLAY(clay.ID("Main"), clay.EL{
 			Layout: clay.LAY{Sizing: GROWALL},
-			Clip:   clay.CLIP{Horizontal: true, Vertical: true},
+			Border: clay.BorderElementConfig{Width: BTW, Color: LightGray},
 		}, func() {
-			for _, node := range nodes {
-				UINode(node)
-			}
-
-			clay.CLAY_AUTO_ID(clay.EL{
-				Layout: clay.LAY{
-					Sizing:  GROWH,
-					Padding: PA3,
-				},
-				Floating: clay.FLOAT{
-					AttachTo: clay.AttachToParent,
-					AttachPoints: clay.FloatingAttachPoints{
-						Element: clay.AttachPointLeftBottom,
-						Parent:  clay.AttachPointLeftBottom,
-					},
-				},
+			clay.CLAY(clay.ID("NodeCanvas"), clay.EL{
+				Layout: clay.LAY{Sizing: GROWALL},
+				Clip:   clay.CLIP{Horizontal: true, Vertical: true},
 			}, func() {
+				for _, node := range graph.Nodes() {
+					UINode(graph, node)
+				}
+
+				UIFileMenu()
+				UICompositeBar()
+				UIRunOptions()
+
 				clay.CLAY_AUTO_ID(clay.EL{
 					Layout: clay.LAY{
-						Sizing:   GROWH,
-						ChildGap: S2,
+						Sizing:  GROWH,
+						Padding: PA3,
 					},
-				}, func() {
-					textboxID := clay.ID("NewNodeName")
-					shortcut := rl.IsKeyPressed(rl.KeySpace) && (rl.IsKeyDown(rl.KeyLeftControl) || rl.IsKeyDown(rl.KeyRightControl))
-
-					// Before UI: defocus textbox
-					if shortcut && IsFocused(textboxID) {
-						UIFocus = nil
-						shortcut = false
-					}
-
-					UIButton(clay.ID("NewNode"), UIButtonConfig{
-						El: clay.EL{
-							Layout: clay.LAY{
-								Sizing:         WH(36, 36),
-								ChildAlignment: ALLCENTER,
-							},
-							Border: clay.B{Width: BA, Color: Gray},
+					Floating: clay.FLOAT{
+						AttachTo: clay.AttachToParent,
+						AttachPoints: clay.FloatingAttachPoints{
+							Element: clay.AttachPointLeftBottom,
+							Parent:  clay.AttachPointLeftBottom,
 						},
-						OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
-							NewNodeName = ""
-							id := textboxID
-							UIFocus = &id
+					},
+				}, func() {
+					clay.CLAY_AUTO_ID(clay.EL{
+						Layout: clay.LAY{
+							Sizing:   GROWH,
+							ChildGap: S2,
 						},
 					}, func() {
-						clay.TEXT("+", clay.T{FontID: InterBold, FontSize: 36, TextColor: White})
-					})
-					if IsFocused(textboxID) {
-						addNodeFromMatch := func(nt NodeType) {
-							newNode := nt.Create()
-							newNode.Pos = V2{200, 200}
-							nodes = append(nodes, newNode)
-							selectedNodeID = newNode.ID
+						textboxID := clay.ID("NewNodeName")
+						shortcut := rl.IsKeyPressed(rl.KeySpace) && (rl.IsKeyDown(rl.KeyLeftControl) || rl.IsKeyDown(rl.KeyRightControl))
+
+						// Before UI: defocus textbox
+						if shortcut && IsFocused(textboxID) {
+							UIFocus = nil
+							shortcut = false
 						}
 
-						UITextBox(textboxID, &NewNodeName, UITextBoxConfig{
-							El: clay.ElementDeclaration{
+						UIButton(clay.ID("NewNode"), UIButtonConfig{
+							El: clay.EL{
 								Layout: clay.LAY{
-									Sizing: GROWALL,
+									Sizing:         WH(36, 36),
+									ChildAlignment: ALLCENTER,
 								},
+								Border: clay.B{Width: BA, Color: Gray},
 							},
-							OnSubmit: func(val string) {
-								matches := SearchNodeTypes(val)
-								if len(matches) > 0 {
-									addNodeFromMatch(matches[0])
-								}
-								UIFocus = nil
+							OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+								NewNodeName = ""
+								id := textboxID
+								UIFocus = &id
 							},
 						}, func() {
-							clay.CLAY(clay.ID("NewNodeMatches"), clay.EL{
-								Layout: clay.LAY{
-									LayoutDirection: clay.TopToBottom,
-									Sizing:          GROWH,
-								},
-								BackgroundColor: DarkGray,
-								Border:          clay.B{Width: BA_BTW, Color: Gray},
-								Floating: clay.FLOAT{
-									AttachTo: clay.AttachToParent,
-									AttachPoints: clay.FloatingAttachPoints{
-										Parent:  clay.AttachPointLeftTop,
-										Element: clay.AttachPointLeftBottom,
-									},
-								},
-							}, func() {
-								matches := SearchNodeTypes(NewNodeName)
-								for i := len(matches) - 1; i >= 0; i-- {
-									UIButton(clay.AUTO_ID, UIButtonConfig{
-										El: clay.EL{
-											Layout: clay.LAY{
-												Padding: PVH(S2, S3),
-												Sizing:  GROWH,
-											},
-										},
-										OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
-											addNodeFromMatch(matches[i])
-											UIFocus = nil
-										},
-									}, func() {
-										clay.TEXT(matches[i].Name, clay.T{
-											FontID:    util.Tern(i == 0, InterBold, InterRegular),
-											FontSize:  F3,
-											TextColor: White,
-										})
-									})
-								}
-							})
+							clay.TEXT("+", clay.T{FontID: InterBold, FontSize: 36, TextColor: White})
 						})
-					}
-
-					// After UI: focus textbox
-					if shortcut && !IsFocused(textboxID) {
-						UIFocus = &textboxID
-						NewNodeName = ""
-						shortcut = false
-					}
-				})
-			})
-		})
-		clay.CLAY_LATE(clay.ID("Output"), func() clay.EL {
-			return clay.EL{
-				Layout: clay.LAY{
-					LayoutDirection: clay.TopToBottom,
-					Sizing:          clay.Sizing{Width: clay.SizingFixed(OutputWindowWidth), Height: clay.SizingGrow(1, 0)},
-					Padding:         PA2,
-				},
-				Clip: clay.ClipElementConfig{
-					Vertical:    true,
-					Horizontal:  true,
-					ChildOffset: clay.GetScrollOffset(),
-				},
-			}
-		}, func() {
-			if selectedNode, ok := GetSelectedNode(); ok {
-				if selectedNode.ResultAvailable {
-					result := selectedNode.Result
-					if result.Err == nil {
-						for outputIndex, output := range result.Outputs {
-							port := selectedNode.OutputPorts[outputIndex]
-							if err := Typecheck(*output.Type, port.Type); err != nil {
-								panic(err)
+						if IsFocused(textboxID) {
+							addNodeFromMatch := func(nt NodeType) {
+								newNode := nt.Create()
+								newNode.Pos = core.V2(rl.Vector2Subtract(V2{200, 200}, Pan))
+								graph.AddNode(newNode)
+								graph.Select(newNode)
 							}
 
-							outputState := selectedNode.GetOutputState(port.Name)
-
-							clay.CLAY_AUTO_ID(clay.EL{
-								Layout: clay.LAY{ChildGap: S1, ChildAlignment: YCENTER},
+							UITextBox(textboxID, &NewNodeName, UITextBoxConfig{
+								El: clay.ElementDeclaration{
+									Layout: clay.LAY{
+										Sizing: GROWALL,
+									},
+								},
+								OnSubmit: func(val string) {
+									matches := SearchNodeTypes(val)
+									if len(matches) > 0 {
+										addNodeFromMatch(matches[0])
+									}
+									UIFocus = nil
+								},
 							}, func() {
-								UIButton(clay.AUTO_ID, UIButtonConfig{
-									OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
-										outputState.Collapsed = !outputState.Collapsed
+								clay.CLAY(clay.ID("NewNodeMatches"), clay.EL{
+									Layout: clay.LAY{
+										LayoutDirection: clay.TopToBottom,
+										Sizing:          GROWH,
 									},
-								}, func() {
-									UIImage(clay.AUTO_ID, util.Tern(outputState.Collapsed, ImgToggleRight, ImgToggleDown), clay.EL{})
-								})
-								clay.TEXT(port.Name, clay.TextElementConfig{FontID: InterSemibold, TextColor: White})
-							})
-							if !outputState.Collapsed {
-								clay.CLAY_AUTO_ID(clay.EL{
-									Layout: clay.LAY{ChildGap: S1},
-								}, func() {
-									clay.CLAY_AUTO_ID(clay.EL{
-										Layout: clay.LAY{
-											Sizing:         clay.Sizing{Width: PX(float32(ImgToggleDown.Width)), Height: GROWV.Height},
-											ChildAlignment: XCENTER,
+									BackgroundColor: DarkGray,
+									Border:          clay.B{Width: BA_BTW, Color: Gray},
+									Floating: clay.FLOAT{
+										AttachTo: clay.AttachToParent,
+										AttachPoints: clay.FloatingAttachPoints{
+											Parent:  clay.AttachPointLeftTop,
+											Element: clay.AttachPointLeftBottom,
 										},
-									}, func() {
-										clay.CLAY_AUTO_ID(clay.EL{
-											Layout: clay.LAY{
-												Sizing: clay.Sizing{Width: PX(1), Height: GROWV.Height},
+									},
+								}, func() {
+									matches := SearchNodeTypes(NewNodeName)
+									for i := len(matches) - 1; i >= 0; i-- {
+										UIButton(clay.AUTO_ID, UIButtonConfig{
+											El: clay.EL{
+												Layout: clay.LAY{
+													Padding: PVH(S2, S3),
+													Sizing:  GROWH,
+												},
 											},
-											Border: clay.B{Color: Gray, Width: BR},
+											OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+												addNodeFromMatch(matches[i])
+												UIFocus = nil
+											},
+										}, func() {
+											clay.TEXT(matches[i].Name, clay.T{
+												FontID:    util.Tern(i == 0, InterBold, InterRegular),
+												FontSize:  F3,
+												TextColor: White,
+											})
 										})
-									})
-									UIFlowValue(output)
+									}
 								})
-							}
+							})
+						}
+
+						// After UI: focus textbox
+						if shortcut && !IsFocused(textboxID) {
+							UIFocus = &textboxID
+							NewNodeName = ""
+							shortcut = false
 						}
-					} else {
-						clay.TEXT(result.Err.Error(), clay.TextElementConfig{TextColor: Red})
+					})
+				})
+			})
+			clay.CLAY_LATE(clay.ID("Output"), func() clay.EL {
+				return clay.EL{
+					Layout: clay.LAY{
+						LayoutDirection: clay.TopToBottom,
+						Sizing:          clay.Sizing{Width: clay.SizingFixed(OutputWindowWidth), Height: clay.SizingGrow(1, 0)},
+						Padding:         PA2,
+					},
+					Clip: clay.ClipElementConfig{
+						Vertical:    true,
+						Horizontal:  true,
+						ChildOffset: clay.GetScrollOffset(),
+					},
+				}
+			}, func() {
+				UIOutputTabs()
+				switch outputTab {
+				case OutputTabResult:
+					if selectedNode, ok := graph.Selected(); ok {
+						UINodeOutputs(selectedNode)
 					}
+				case OutputTabHistory:
+					UIRunHistory(graph)
+				case OutputTabConsole:
+					UIConsole(graph)
 				}
-			}
+			})
 		})
+		UIConsolePane(graph)
 	})
 
 	rl.SetMouseCursor(UICursor)
@@ -459,59 +421,124 @@ func ui() {
 }
 
 func afterLayout() {
-	for _, node := range nodes {
-		node.UpdateLayoutInfo()
+	for _, node := range graph.Nodes() {
+		UpdateLayoutInfo(node)
 	}
 }
 
 func renderOverlays() {
 	// Render wires
-	for _, wire := range wires {
-		color := util.Tern(wire.StartNode.ResultAvailable && wire.StartNode.Result.Err != nil, Red, LightGray)
+	for _, wire := range graph.Wires() {
+		start := wire.StartNode.State()
+		color := util.Tern(start.ResultAvailable && start.Result.Err != nil, Red, LightGray)
 		rl.DrawLineBezier(
-			rl.Vector2(wire.StartNode.OutputPortPositions[wire.StartPort]),
-			rl.Vector2(wire.EndNode.InputPortPositions[wire.EndPort]),
+			NodeUI(wire.StartNode).OutputPortPositions[wire.StartPort],
+			NodeUI(wire.EndNode).InputPortPositions[wire.EndPort],
 			1,
 			color.RGBA(),
 		)
 	}
 	if draggingNewWire, _, _ := drag.State(NewWireDragKey); draggingNewWire {
 		rl.DrawLineBezier(
-			rl.Vector2(NewWireSourceNode.OutputPortPositions[NewWireSourcePort]),
+			NodeUI(NewWireSourceNode).OutputPortPositions[NewWireSourcePort],
 			rl.GetMousePosition(),
 			1,
 			LightGray.RGBA(),
 		)
 	}
 
-	for _, node := range nodes {
-		for _, portPos := range append(node.InputPortPositions, node.OutputPortPositions...) {
+	for _, node := range graph.Nodes() {
+		nodeUI := NodeUI(node)
+		for _, portPos := range append(nodeUI.InputPortPositions, nodeUI.OutputPortPositions...) {
 			rl.DrawCircle(int32(portPos.X), int32(portPos.Y), 4, White.RGBA())
 		}
 	}
 }
 
-func UINode(node *Node) {
+// If set, nodes that read files are re-run, along with everything downstream
+// of them, when those files change.
+var WatchFiles bool
+
+var watcher core.Watcher
+
+// Called every frame to re-run nodes whose files have changed.
+func pollWatchedFiles() {
+	if !WatchFiles {
+		watcher = core.Watcher{}
+		return
+	}
+	if changed := watcher.Poll(RootGraph()); len(changed) > 0 {
+		core.RerunAffected(RootGraph(), changed)
+	}
+}
+
+// Toggles for re-running nodes automatically, in the top right of the node
+// canvas.
+func UIRunOptions() {
+	clay.CLAY_AUTO_ID(clay.EL{
+		Layout: clay.LAY{Padding: PA3, ChildGap: S2},
+		Floating: clay.FLOAT{
+			AttachTo: clay.AttachToParent,
+			AttachPoints: clay.FloatingAttachPoints{
+				Element: clay.AttachPointRightTop,
+				Parent:  clay.AttachPointRightTop,
+			},
+		},
+	}, func() {
+		UIToggle(clay.ID("WatchFiles"), "Watch files", &WatchFiles,
+			"Re-run Load File and List Files nodes, and everything after them, when their files change (except pinned nodes)")
+		autoRun := core.AutoRun()
+		UIToggle(clay.ID("AutoRun"), "Auto-run", &autoRun,
+			"Re-run out-of-date nodes automatically when their inputs or settings change (except pinned nodes)")
+		if autoRun != core.AutoRun() {
+			core.SetAutoRun(autoRun)
+		}
+	})
+}
+
+func UIToggle(id clay.ElementID, label string, on *bool, tooltip string) {
+	UIButton(id, UIButtonConfig{
+		El: clay.EL{
+			Layout:          clay.LAY{Padding: PVH(S1, S2)},
+			Border:          clay.B{Width: BA, Color: util.Tern(*on, PlayButtonGreen, Gray)},
+			BackgroundColor: util.Tern(*on, PlayButtonGreen, clay.Color{}),
+		},
+		OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+			*on = !*on
+		},
+	}, func() {
+		clay.TEXT(fmt.Sprintf("%s: %s", label, util.Tern(*on, "On", "Off")), clay.T{FontID: InterSemibold, TextColor: White})
+		if clay.Hovered() {
+			UITooltip(tooltip)
+		}
+	})
+}
+
+func UINode(g *core.Graph, node *core.Node) {
+	// Read once, so that the node is drawn consistently even if its run
+	// finishes partway through the frame.
+	state := node.State()
+
 	border := clay.B{
 		Color: Gray,
 		Width: BA,
 	}
-	if node.Result.Err != nil {
+	if state.Result.Err != nil {
 		border = clay.B{
 			Color: Red,
 			Width: BA2,
 		}
-	} else if selectedNodeID == node.ID {
+	} else if IsGroupSelected(g, node) {
 		border = clay.B{
 			Color: Blue,
 			Width: BA2,
 		}
 	}
 
-	clay.CLAY(node.ClayID(), clay.EL{
+	clay.CLAY(NodeClayID(node), clay.EL{
 		Floating: clay.FloatingElementConfig{
 			AttachTo: clay.AttachToParent,
-			Offset:   clay.Vector2(node.Pos),
+			Offset:   clay.Vector2(rl.Vector2Add(V2(node.Pos), Pan)),
 			ClipTo:   clay.ClipToAttachedParent,
 		},
 
@@ -534,23 +561,43 @@ func UINode(node *Node) {
 			clay.OnHover(func(elementID clay.ElementID, pointerData clay.PointerData, _ any) {
 				// TODO: Hook into global system for mouse events
 				if pointerData.State == clay.PointerDataReleasedThisFrame {
-					selectedNodeID = node.ID
+					ClickSelect(g, node)
 				}
 			}, nil)
 
 			clay.TEXT(node.Name, clay.TextElementConfig{FontID: InterSemibold, FontSize: F3, TextColor: White})
-			UISpacer(node.DragHandleClayID(), GROWALL)
-			if node.Running {
+			UISpacer(NodeDragHandleClayID(node), GROWALL)
+			if state.Running {
 				clay.TEXT("Running...", clay.TextElementConfig{TextColor: White})
+			} else if state.ResultAvailable && state.Stale {
+				clay.TEXT("Out of date", clay.TextElementConfig{TextColor: LightGray})
+			} else if state.ResultAvailable && errors.As(state.Result.Err, new(core.PanicError)) {
+				clay.TEXT("Crashed", clay.TextElementConfig{TextColor: Red})
 			}
 
-			playButtonDisabled := !node.Valid || node.Running
+			playButtonDisabled := !node.Valid || state.Running
 
+			UIRunPolicyButton(node)
+			UIButton(clay.AUTO_ID, // Cache toggle
+				UIButtonConfig{
+					El: clay.EL{Layout: clay.LAY{Padding: PA1}},
+					OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+						node.SetNoCache(!node.NoCache)
+					},
+				},
+				func() {
+					clay.TEXT(util.Tern(node.NoCache, "No cache", "Cache"), clay.TextElementConfig{TextColor: util.Tern(node.NoCache, White, LightGray)})
+
+					if clay.Hovered() {
+						UITooltip(util.Tern(node.NoCache, "Never reuse cached results (click to allow)", "Reuse cached results (click to always rerun)"))
+					}
+				},
+			)
 			UIButton(clay.AUTO_ID, // Pin button
 				UIButtonConfig{
 					El: clay.EL{Layout: clay.LAY{Padding: PA1}},
 					OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
-						node.Pinned = !node.Pinned
+						node.SetPinned(!node.Pinned)
 					},
 				},
 				func() {
@@ -563,12 +610,30 @@ func UINode(node *Node) {
 					}
 				},
 			)
+			UIButton(clay.AUTO_ID, // Stop button
+				UIButtonConfig{
+					El:       clay.EL{Layout: clay.LAY{Padding: PA1}},
+					Disabled: !state.Running,
+					OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+						node.Stop(g)
+					},
+				},
+				func() {
+					UIImage(clay.AUTO_ID, ImgStop, clay.EL{
+						BackgroundColor: util.Tern(state.Running, Red, LightGray),
+					})
+
+					if clay.Hovered() {
+						UITooltip("Stop command and everything waiting on it")
+					}
+				},
+			)
 			UIButton(clay.AUTO_ID, // Retry / play-all button
 				UIButtonConfig{
 					El:       clay.EL{Layout: clay.LAY{Padding: PA1}},
 					Disabled: playButtonDisabled,
 					OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
-						node.Run(true)
+						node.Run(g, true)
 					},
 				},
 				func() {
@@ -586,7 +651,7 @@ func UINode(node *Node) {
 					El:       clay.EL{Layout: clay.LAY{Padding: PA1}},
 					Disabled: playButtonDisabled,
 					OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
-						node.Run(false)
+						node.Run(g, false)
 					},
 				},
 				func() {
@@ -600,15 +665,114 @@ func UINode(node *Node) {
 				},
 			)
 		})
+		UIRunPolicy(node)
 		clay.CLAY_AUTO_ID(clay.EL{ // Node body
 			Layout: clay.LAY{Sizing: GROWH, Padding: PA2},
 		}, func() {
-			node.Action.UI(node)
+			UINodeBody(g, node)
 		})
 	})
 }
 
-func UIInputPort(n *Node, port int) {
+// Shows the latest result of a node in the output panel.
+func UINodeOutputs(n *core.Node) {
+	if state := n.State(); state.ResultAvailable {
+		result := state.Result
+		if state.Stale {
+			clay.TEXT("Inputs or settings have changed since this ran.", clay.TextElementConfig{TextColor: LightGray})
+		}
+		if result.Err == nil {
+			for outputIndex, output := range result.Outputs {
+				// Changing a node's settings can change its output types
+				// before it runs again.
+				if outputIndex >= len(n.OutputPorts) || core.Typecheck(*output.Type, n.OutputPorts[outputIndex].Type) != nil {
+					if !state.Stale {
+						clay.TEXT("Inputs or settings have changed since this ran.", clay.TextElementConfig{TextColor: LightGray})
+					}
+					break
+				}
+				port := n.OutputPorts[outputIndex]
+
+				outputState := NodeUI(n).GetOutputState(port.Name)
+
+				clay.CLAY_AUTO_ID(clay.EL{
+					Layout: clay.LAY{ChildGap: S1, ChildAlignment: YCENTER},
+				}, func() {
+					UIButton(clay.AUTO_ID, UIButtonConfig{
+						OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+							outputState.Collapsed = !outputState.Collapsed
+						},
+					}, func() {
+						UIImage(clay.AUTO_ID, util.Tern(outputState.Collapsed, ImgToggleRight, ImgToggleDown), clay.EL{})
+					})
+					clay.TEXT(port.Name, clay.TextElementConfig{FontID: InterSemibold, TextColor: White})
+				})
+				if !outputState.Collapsed {
+					clay.CLAY_AUTO_ID(clay.EL{
+						Layout: clay.LAY{ChildGap: S1},
+					}, func() {
+						clay.CLAY_AUTO_ID(clay.EL{
+							Layout: clay.LAY{
+								Sizing:         clay.Sizing{Width: PX(float32(ImgToggleDown.Width)), Height: GROWV.Height},
+								ChildAlignment: XCENTER,
+							},
+						}, func() {
+							clay.CLAY_AUTO_ID(clay.EL{
+								Layout: clay.LAY{
+									Sizing: clay.Sizing{Width: PX(1), Height: GROWV.Height},
+								},
+								Border: clay.B{Color: Gray, Width: BR},
+							})
+						})
+						UIFlowValue(output)
+					})
+				}
+			}
+		} else {
+			UINodeError(n, result.Err)
+		}
+	}
+}
+
+// Shows a node's error in the output panel. Panics come with an expandable
+// stack trace, to help track down the bug.
+func UINodeError(n *core.Node, err error) {
+	clay.TEXT(err.Error(), clay.TextElementConfig{TextColor: Red})
+
+	var panicErr core.PanicError
+	if !errors.As(err, &panicErr) {
+		return
+	}
+	nodeUI := NodeUI(n)
+	clay.CLAY_AUTO_ID(clay.EL{
+		Layout: clay.LAY{ChildGap: S1, ChildAlignment: YCENTER, Padding: PD(S2, 0, 0, 0, clay.Padding{})},
+	}, func() {
+		UIButton(clay.AUTO_ID, UIButtonConfig{
+			OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
+				nodeUI.showStack = !nodeUI.showStack
+			},
+		}, func() {
+			UIImage(clay.AUTO_ID, util.Tern(nodeUI.showStack, ImgToggleDown, ImgToggleRight), clay.EL{})
+		})
+		clay.TEXT("Stack trace", clay.TextElementConfig{FontID: InterSemibold, TextColor: White})
+	})
+	if nodeUI.showStack {
+		clay.CLAY_AUTO_ID(clay.EL{
+			Layout: clay.LAY{LayoutDirection: clay.TopToBottom, ChildGap: S1, Padding: PD(0, 0, 0, S3, clay.Padding{})},
+		}, func() {
+			for _, frame := range panicErr.Stack {
+				clay.CLAY_AUTO_ID(clay.EL{
+					Layout: clay.LAY{LayoutDirection: clay.TopToBottom},
+				}, func() {
+					clay.TEXT(frame.Function, clay.TextElementConfig{TextColor: White})
+					clay.TEXT(fmt.Sprintf("%s:%d", frame.File, frame.Line), clay.TextElementConfig{TextColor: LightGray})
+				})
+			}
+		})
+	}
+}
+
+func UIInputPort(n *core.Node, port int) {
 	clay.CLAY_AUTO_ID(clay.EL{
 		Layout: clay.LAY{ChildAlignment: YCENTER},
 	}, func() {
@@ -617,7 +781,7 @@ func UIInputPort(n *Node, port int) {
 	})
 }
 
-func UIOutputPort(n *Node, port int) {
+func UIOutputPort(n *core.Node, port int) {
 	clay.CLAY_AUTO_ID(clay.EL{
 		Layout: clay.LAY{ChildAlignment: YCENTER},
 	}, func() {
@@ -626,29 +790,37 @@ func UIOutputPort(n *Node, port int) {
 	})
 }
 
-func UIFlowValue(v FlowValue) {
+func UIFlowValue(v core.FlowValue) {
+	if v.Type == nil {
+		// e.g. a composite input that isn't wired
+		clay.TEXT("<no value>", clay.TextElementConfig{FontID: JetBrainsMono, TextColor: LightGray})
+		return
+	}
+
 	switch v.Type.Kind {
-	case FSKindBytes:
+	case core.FSKindBytes:
 		if len(v.BytesValue) == 0 {
 			clay.TEXT("<no data>", clay.TextElementConfig{FontID: JetBrainsMono, TextColor: LightGray})
 		} else {
 			clay.TEXT(string(v.BytesValue), clay.TextElementConfig{FontID: JetBrainsMono, TextColor: White})
 		}
-	case FSKindInt64:
+	case core.FSKindInt64:
 		var str string
-		if v.Type.WellKnownType == FSWKTTimestamp {
+		if v.Type.WellKnownType == core.FSWKTTimestamp {
 			str = time.Unix(v.Int64Value, 0).Format(time.RFC1123)
-		} else if v.Type.Unit == FSUnitBytes {
+		} else if v.Type.WellKnownType == core.FSWKTBool {
+			str = util.Tern(v.Int64Value != 0, "true", "false")
+		} else if v.Type.Unit == core.FSUnitBytes {
 			str = FormatBytes(v.Int64Value)
 		} else {
 			str = fmt.Sprintf("%d", v.Int64Value)
 		}
 		clay.TEXT(str, clay.TextElementConfig{TextColor: White})
-	case FSKindFloat64:
+	case core.FSKindFloat64:
 		var str string
 		str = fmt.Sprintf("%v", v.Float64Value)
 		clay.TEXT(str, clay.TextElementConfig{TextColor: White})
-	case FSKindList:
+	case core.FSKindList:
 		clay.CLAY_AUTO_ID(clay.EL{ // list items
 			Layout: clay.LAY{LayoutDirection: clay.TopToBottom, ChildGap: S1},
 		}, func() {
@@ -661,7 +833,7 @@ func UIFlowValue(v FlowValue) {
 				})
 			}
 		})
-	case FSKindTable:
+	case core.FSKindTable:
 		clay.CLAY_AUTO_ID(clay.EL{ // Table
 			Border: clay.B{Width: BA_BTW, Color: Gray},
 		}, func() {
@@ -736,7 +908,8 @@ type UITextBoxConfig struct {
 	El       clay.EL
 	Disabled bool
 
-	OnSubmit func(val string)
+	OnChange func(val string) // called on every edit
+	OnSubmit func(val string) // called when Enter is pressed
 }
 
 func UITextBox(id clay.ElementID, str *string, config UITextBoxConfig, children ...func()) {
@@ -751,6 +924,7 @@ func UITextBox(id clay.ElementID, str *string, config UITextBoxConfig, children
 
 				UIFocus = nil
 			} else {
+				before := *str
 				for r := rl.GetCharPressed(); r != 0; r = rl.GetCharPressed() {
 					*str = *str + string(rune(r))
 				}
@@ -759,6 +933,9 @@ func UITextBox(id clay.ElementID, str *string, config UITextBoxConfig, children
 						*str = (*str)[:len(*str)-1]
 					}
 				}
+				if *str != before && config.OnChange != nil {
+					config.OnChange(*str)
+				}
 			}
 		}
 	}
@@ -799,56 +976,18 @@ func UITextBox(id clay.ElementID, str *string, config UITextBoxConfig, children
 
 type OnChangeFunc func(before, after any)
 
-type UIDropdown struct {
-	Options  []UIDropdownOption
-	Selected int
-
-	open bool
-}
-
-type UIDropdownOption struct {
-	Name  string
-	Value any
-}
-
-func (d *UIDropdown) GetOption(i int) UIDropdownOption {
-	if len(d.Options) == 0 {
-		return UIDropdownOption{}
-	}
-	if i >= len(d.Options) {
-		return d.Options[0]
-	}
-	return d.Options[i]
-}
-
-func (d *UIDropdown) GetSelectedOption() UIDropdownOption {
-	return d.GetOption(d.Selected)
-}
-
-func (d *UIDropdown) SelectByName(name string) {
-	for i, opt := range d.Options {
-		if opt.Name == name {
-			d.Selected = i
-			break
-		}
-	}
-}
-
-func (d *UIDropdown) SelectByValue(v any) {
-	for i, opt := range d.Options {
-		if opt.Value == v {
-			d.Selected = i
-			break
-		}
-	}
-}
-
 type UIDropdownConfig struct {
 	El       clay.EL
 	OnChange OnChangeFunc
 }
 
-func (d *UIDropdown) Do(id clay.ElementID, config UIDropdownConfig) {
+// The dropdown whose options are currently shown, if any. Only one can be open
+// at a time.
+var openDropdown *core.Choice
+
+func UIDropdown(id clay.ElementID, d *core.Choice, config UIDropdownConfig) {
+	open := openDropdown == d
+
 	config.El.Layout.Padding = clay.Padding{}
 	config.El.Layout.ChildAlignment.Y = clay.AlignYCenter
 	config.El.Border = clay.BorderElementConfig{Width: BA, Color: Gray}
@@ -873,15 +1012,19 @@ func (d *UIDropdown) Do(id clay.ElementID, config UIDropdownConfig) {
 				Border: clay.B{Width: clay.BW{Left: 1}, Color: Gray},
 			},
 			OnClick: func(elementID clay.ElementID, pointerData clay.PointerData, userData any) {
-				d.open = !d.open
+				if open {
+					openDropdown = nil
+				} else {
+					openDropdown = d
+				}
 			},
 		}, func() {
-			UIImage(clay.AUTO_ID, util.Tern(d.open, ImgDropdownUp, ImgDropdownDown), clay.EL{
+			UIImage(clay.AUTO_ID, util.Tern(open, ImgDropdownUp, ImgDropdownDown), clay.EL{
 				BackgroundColor: LightGray,
 			})
 		})
 
-		if d.open {
+		if open {
 			clay.CLAY_AUTO_ID(clay.EL{
 				Layout: clay.LAY{
 					LayoutDirection: clay.TopToBottom,
@@ -918,7 +1061,7 @@ func (d *UIDropdown) Do(id clay.ElementID, config UIDropdownConfig) {
 							if pointerData.State == clay.PointerDataReleasedThisFrame {
 								selectedBefore := d.Selected
 								d.Selected = userData.(int)
-								d.open = false
+								openDropdown = nil
 								if config.OnChange != nil {
 									config.OnChange(d.GetOption(selectedBefore).Value, d.GetOption(d.Selected).Value)
 								}
@@ -957,11 +1100,11 @@ func UITooltip(msg string) {
 	})
 }
 
-func PortAnchorID(node *Node, isOutput bool, port int) clay.ElementID {
+func PortAnchorID(node *core.Node, isOutput bool, port int) clay.ElementID {
 	return clay.ID(fmt.Sprintf("N%d%s%d", node.ID, util.Tern(isOutput, "O", "I"), port))
 }
 
-func PortAnchor(node *Node, isOutput bool, port int) {
+func PortAnchor(node *core.Node, isOutput bool, port int) {
 	clay.CLAY(PortAnchorID(node, isOutput, port), clay.EL{})
 }
 
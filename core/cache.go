@@ -0,0 +1,242 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// The result cache used when running nodes, or nil if caching is disabled.
+var ResultCache *Cache
+
+// A content-addressed store of node results on disk. Results are keyed by a
+// hash of the node's action configuration and its input values, so a node
+// whose configuration and inputs haven't changed can reuse its last result
+// instead of running again.
+//
+// Once the entries add up to more than MaxSize, the least recently used ones
+// are deleted.
+type Cache struct {
+	Dir     string
+	MaxSize int64 // in bytes; zero means no limit
+
+	written atomic.Int64 // bytes written since the cache was last pruned
+}
+
+// How much disk space the result cache may use by default.
+const DefaultCacheMaxSize = 1 << 30 // 1 GiB
+
+// Actions can implement this to control how their results are cached. By
+// default, a result depends only on the action's configuration and inputs.
+type CachePolicy interface {
+	// Returns extra data that affects the result, such as the modification time
+	// of a file being read, or ok=false if the result must not be cached at
+	// all, e.g. because the action has side effects.
+	CacheKey(n *Node) (extra []byte, ok bool)
+}
+
+// Bump this to invalidate every existing cache entry, e.g. if the way results
+// are stored changes.
+const cacheFormatVersion = 2
+
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "flowshell", "results")
+}
+
+// Opens the cache in the given directory, or returns nil (no caching) if dir
+// is empty. Old entries are pruned to fit DefaultCacheMaxSize.
+func OpenCache(dir string) *Cache {
+	if dir == "" {
+		return nil
+	}
+	c := &Cache{Dir: dir, MaxSize: DefaultCacheMaxSize}
+	if err := c.Prune(); err != nil {
+		Log.Warn("Failed to prune result cache", "err", err)
+	}
+	return c
+}
+
+// Computes the cache key for the node's next run. Must be called once the
+// node's inputs are available. Returns ok=false if the node cannot be cached,
+// either because of its action or because caching is turned off for it.
+func CacheKey(g *Graph, n *Node) (key string, ok bool) {
+	if n.cachingDisabled() {
+		return "", false
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "flowshell result cache v%d\n", cacheFormatVersion)
+
+	writeBytes := func(b []byte) {
+		binary.Write(h, binary.LittleEndian, int64(len(b)))
+		h.Write(b)
+	}
+
+	writeBytes([]byte(n.Action.Tag()))
+	s := NewEncoder(GraphFileVersion)
+	if !n.Action.Serialize(s) {
+		return "", false
+	}
+	writeBytes(s.Bytes())
+
+	if policy, ok := n.Action.(CachePolicy); ok {
+		extra, ok := policy.CacheKey(n)
+		if !ok {
+			return "", false
+		}
+		writeBytes(extra)
+	}
+
+	for i := range n.InputPorts {
+		v, wired, err := n.GetInputValue(g, i)
+		if err != nil {
+			return "", false
+		}
+		if !wired {
+			writeBytes(nil)
+			continue
+		}
+		s := NewEncoder(GraphFileVersion)
+		if !SThing(s, &v) {
+			return "", false
+		}
+		sum := sha256.Sum256(s.Bytes())
+		writeBytes(sum[:])
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.Dir, key[:2], key+".bin")
+}
+
+// Looks up a cached result. Missing or unreadable entries are both treated as
+// a miss.
+func (c *Cache) Get(key string) ([]FlowValue, bool) {
+	buf, err := os.ReadFile(c.path(key))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			Log.Warn("Failed to read cached result", "err", err)
+		}
+		return nil, false
+	}
+
+	var outputs []FlowValue
+	s := NewDecoder(buf)
+	if !SSlice(s, &outputs) {
+		Log.Warn("Failed to read cached result", "err", errors.Join(s.Errs...))
+		return nil, false
+	}
+
+	// Pruning goes by modification time, so mark the entry as recently used.
+	now := time.Now()
+	os.Chtimes(c.path(key), now, now)
+	return outputs, true
+}
+
+func (c *Cache) Put(key string, outputs []FlowValue) error {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so that other processes never see a
+	// partially-written entry.
+	f, err := os.CreateTemp(filepath.Dir(path), "tmp-*")
+	if err != nil {
+		return err
+	}
+	s := NewEncoder(GraphFileVersion)
+	if !SSlice(s, &outputs) {
+		err = errors.Join(s.Errs...)
+	} else {
+		_, err = f.Write(s.Bytes())
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	// Walking the whole cache is slow, so only prune once a good fraction of
+	// the limit has been written.
+	if c.MaxSize > 0 && c.written.Add(int64(len(s.Bytes()))) > c.MaxSize/8 {
+		c.written.Store(0)
+		if err := c.Prune(); err != nil {
+			Log.Warn("Failed to prune result cache", "err", err)
+		}
+	}
+	return nil
+}
+
+// Deletes the least recently used entries until the rest fit in MaxSize.
+func (c *Cache) Prune() error {
+	if c.MaxSize <= 0 {
+		return nil
+	}
+
+	type entry struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var entries []entry
+	err := filepath.WalkDir(c.Dir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil // e.g. nothing has been cached yet, or another process pruned it
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".bin" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		entries = append(entries, entry{path, info.Size(), info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	slices.SortFunc(entries, func(a, b entry) int { return b.modTime.Compare(a.modTime) })
+	var total int64
+	var errs []error
+	for _, e := range entries {
+		total += e.size
+		if total <= c.MaxSize {
+			continue
+		}
+		if err := os.Remove(e.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Deletes every entry in the cache.
+func (c *Cache) Clear() error {
+	c.written.Store(0)
+	return os.RemoveAll(c.Dir)
+}
@@ -0,0 +1,182 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A countingAction with some configuration, which may opt out of caching.
+type configurableAction struct {
+	countingAction
+	setting  string
+	uncached bool
+}
+
+func (a *configurableAction) Serialize(s *Serializer) bool {
+	SStr(s.Key("setting"), &a.setting)
+	return s.Ok()
+}
+
+func (a *configurableAction) CacheKey(n *Node) ([]byte, bool) {
+	return nil, !a.uncached
+}
+
+func newConfigurableNode(name string, numInputs int) *Node {
+	n := newCountingNode(name, numInputs)
+	n.Action = &configurableAction{}
+	return n
+}
+
+func configurableRuns(n *Node) int {
+	return int(n.Action.(*configurableAction).runs.Load())
+}
+
+// Enables the result cache in a temporary directory for the duration of a
+// test.
+func withCache(t *testing.T) *Cache {
+	oldCache := ResultCache
+	ResultCache = OpenCache(t.TempDir())
+	t.Cleanup(func() { ResultCache = oldCache })
+	return ResultCache
+}
+
+func TestResultCache(t *testing.T) {
+	withCache(t)
+	a := newConfigurableNode("a", 0)
+	b := newConfigurableNode("b", 1)
+	g := newTestGraph(t, []*Node{a, b}, []*Wire{{StartNode: a, EndNode: b}})
+
+	rerun := func() {
+		a.ClearResult()
+		b.ClearResult()
+		<-b.Run(g, true)
+		require.NoError(t, a.State().Result.Err)
+		require.NoError(t, b.State().Result.Err)
+	}
+
+	rerun()
+	assert.Equal(t, []int{1, 1}, []int{configurableRuns(a), configurableRuns(b)})
+
+	// Nothing changed, so both results come from the cache, including the
+	// output values.
+	rerun()
+	assert.Equal(t, []int{1, 1}, []int{configurableRuns(a), configurableRuns(b)})
+	assert.Equal(t, int64(1), b.State().Result.Outputs[0].Int64Value)
+	assert.Equal(t, NodeRunCached, g.NodeHistory(b)[0].Status)
+
+	// Changing a node's configuration reruns it. Its output is different, so
+	// everything downstream reruns too.
+	a.Action.(*configurableAction).setting = "changed"
+	rerun()
+	assert.Equal(t, []int{2, 2}, []int{configurableRuns(a), configurableRuns(b)})
+
+	// Changing a node's configuration back finds the old result again.
+	a.Action.(*configurableAction).setting = ""
+	rerun()
+	assert.Equal(t, []int{2, 2}, []int{configurableRuns(a), configurableRuns(b)})
+
+	t.Run("opt out", func(t *testing.T) {
+		a.Action.(*configurableAction).uncached = true
+		// a outputs a different value every time it runs, so b reruns too.
+		rerun()
+		assert.Equal(t, []int{3, 3}, []int{configurableRuns(a), configurableRuns(b)})
+		rerun()
+		assert.Equal(t, []int{4, 4}, []int{configurableRuns(a), configurableRuns(b)})
+	})
+
+	t.Run("node opt out", func(t *testing.T) {
+		a.Action.(*configurableAction).uncached = false
+		a.SetNoCache(true)
+		defer a.SetNoCache(false)
+		rerun()
+		assert.Equal(t, []int{5, 5}, []int{configurableRuns(a), configurableRuns(b)})
+		rerun()
+		assert.Equal(t, []int{6, 6}, []int{configurableRuns(a), configurableRuns(b)})
+	})
+
+	t.Run("errors are not cached", func(t *testing.T) {
+		c := newConfigurableNode("c", 0)
+		c.Action.(*configurableAction).setting = "c"
+		c.Action.(*configurableAction).err = assert.AnError
+		g := newTestGraph(t, []*Node{c}, nil)
+
+		<-c.Run(g, false)
+		<-c.Run(g, false)
+		assert.Equal(t, 2, configurableRuns(c))
+	})
+}
+
+func TestCachePrune(t *testing.T) {
+	c := OpenCache(t.TempDir())
+	c.MaxSize = 0
+	value := func(size int) []FlowValue {
+		return []FlowValue{NewStringValue(string(make([]byte, size)))}
+	}
+
+	base := time.Now().Add(-time.Hour)
+	for i, key := range []string{"old", "used", "new"} {
+		require.NoError(t, c.Put(key, value(1000)))
+		modified := base.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, os.Chtimes(c.path(key), modified, modified))
+	}
+
+	// Reading an entry makes it the most recently used.
+	_, ok := c.Get("used")
+	require.True(t, ok)
+
+	c.MaxSize = 3000
+	require.NoError(t, c.Prune())
+	_, ok = c.Get("old")
+	assert.False(t, ok)
+	_, ok = c.Get("new")
+	assert.True(t, ok)
+	_, ok = c.Get("used")
+	assert.True(t, ok)
+
+	require.NoError(t, c.Clear())
+	_, ok = c.Get("new")
+	assert.False(t, ok)
+
+	// The cache still works after being cleared.
+	require.NoError(t, c.Put("new", value(10)))
+	_, ok = c.Get("new")
+	assert.True(t, ok)
+}
+
+func TestRunHeadlessCached(t *testing.T) {
+	t.Cleanup(func() { ResultCache = nil })
+	dir := t.TempDir()
+	cacheDir := filepath.Join(dir, "cache")
+	inPath := filepath.Join(dir, "in.txt")
+	outPath := filepath.Join(dir, "out.txt")
+	graphPath := writeTrimGraph(t, inPath, outPath)
+
+	run := func(input, expected string) {
+		t.Helper()
+		require.NoError(t, os.WriteFile(inPath, []byte(input), 0666))
+		require.NoError(t, os.Remove(outPath))
+		assert.Equal(t, 0, RunHeadless([]string{"-cache-dir", cacheDir, graphPath}))
+		out, err := os.ReadFile(outPath)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(out))
+	}
+
+	require.NoError(t, os.WriteFile(outPath, nil, 0666))
+	run("  hello  ", "hello")
+
+	// Load File and Trim Spaces are cached; Save File is not.
+	entries, err := filepath.Glob(filepath.Join(cacheDir, "*", "*.bin"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	// Save File still runs even though nothing changed.
+	run("  hello  ", "hello")
+
+	// Load File notices that the file changed.
+	run("  goodbye world  ", "goodbye world")
+}
@@ -0,0 +1,79 @@
+package core
+
+import "fmt"
+
+// A choice between a fixed set of options, such as a node's format setting.
+// The graph editor shows these as dropdowns.
+type Choice struct {
+	Options  []ChoiceOption
+	Selected int
+}
+
+type ChoiceOption struct {
+	Name  string
+	Value any
+}
+
+func (d *Choice) GetOption(i int) ChoiceOption {
+	if len(d.Options) == 0 {
+		return ChoiceOption{}
+	}
+	if i >= len(d.Options) {
+		return d.Options[0]
+	}
+	return d.Options[i]
+}
+
+func (d *Choice) GetSelectedOption() ChoiceOption {
+	return d.GetOption(d.Selected)
+}
+
+func (d *Choice) SelectByName(name string) {
+	for i, opt := range d.Options {
+		if opt.Name == name {
+			d.Selected = i
+			break
+		}
+	}
+}
+
+func (d *Choice) SelectByValue(v any) {
+	for i, opt := range d.Options {
+		if opt.Value == v {
+			d.Selected = i
+			break
+		}
+	}
+}
+
+// Serialize a choice's selection. The options themselves are not stored, so
+// they must be provided when decoding.
+//
+// Before version 2, the selected option was stored by name. Now it is stored
+// by value, if the value is a string, so that options can be relabeled without
+// breaking old files.
+func SChoice(s *Serializer, d *Choice, options []ChoiceOption) bool {
+	key := func(opt ChoiceOption) string {
+		if str, ok := opt.Value.(string); ok && s.Version >= 2 {
+			return str
+		}
+		return opt.Name
+	}
+
+	if s.Encode {
+		return s.WriteStr(key(d.GetSelectedOption()))
+	}
+
+	selected, ok := s.ReadStr()
+	if !ok {
+		return false
+	}
+	*d = Choice{Options: options}
+	for i, opt := range options {
+		if key(opt) == selected {
+			d.Selected = i
+			return true
+		}
+	}
+	return s.Error(fmt.Errorf("unknown option \"%s\"", selected))
+}
@@ -17,9 +17,11 @@ import (
 func main() {
 	dir := "."
 
-	// Parse the entire directory.
+	// Parse the entire directory, except for tests, which may be in another
+	// package.
 	fset := token.NewFileSet()
-	pkgs, err := parser.ParseDir(fset, dir, nil, parser.ParseComments)
+	notTest := func(info os.FileInfo) bool { return !strings.HasSuffix(info.Name(), "_test.go") }
+	pkgs, err := parser.ParseDir(fset, dir, notTest, parser.ParseComments)
 	if err != nil {
 		log.Fatalf("parse error: %v", err)
 	}
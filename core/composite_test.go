@@ -0,0 +1,158 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollapse(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "in.txt")
+	require.NoError(t, os.WriteFile(path, []byte("  a\nb  \n"), 0666))
+
+	load := NewLoadFileNode(path)
+	trim := NewTrimSpacesNode()
+	lines := NewLinesNode()
+	g := newTestGraph(t, []*Node{load, trim, lines}, []*Wire{
+		{StartNode: load, EndNode: trim},
+		{StartNode: trim, EndNode: lines},
+	})
+	expected := []FlowValue{NewListValue(FlowType{Kind: FSKindBytes}, []FlowValue{NewBytesValue([]byte("a")), NewBytesValue([]byte("b"))})}
+
+	composite, err := g.Collapse([]*Node{trim, lines}, "Trimmed Lines")
+	require.NoError(t, err)
+	assert.Equal(t, []*Node{load, composite}, g.Nodes())
+	require.Len(t, g.Wires(), 1)
+	assert.Equal(t, &Wire{StartNode: load, EndNode: composite}, g.Wires()[0])
+
+	// Trim's input came from outside, and Lines' output wasn't wired, so both
+	// become ports.
+	g.Validate()
+	assert.True(t, composite.Valid)
+	assert.Equal(t, []NodePort{{Name: "Text", Type: FlowType{Kind: FSKindBytes}}}, composite.InputPorts)
+	assert.Equal(t, []string{"Lines"}, portNames(composite.OutputPorts))
+
+	outputs, err := g.Run(t.Context(), composite)
+	require.NoError(t, err)
+	assert.Equal(t, expected, outputs)
+
+	t.Run("trace", func(t *testing.T) {
+		// The inner nodes' events show up in the outer graph's trace.
+		scope := fmt.Sprintf("Trimmed Lines (#%d)", composite.ID)
+		var kinds []TraceEventKind
+		for _, e := range g.TraceEvents() {
+			if e.Scope == scope && e.NodeName == "Trim Spaces" {
+				kinds = append(kinds, e.Kind)
+			}
+		}
+		assert.Equal(t, []TraceEventKind{TraceNodeStart, TraceNodeFinish}, kinds)
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		buf, err := EncodeGraphText(g.File())
+		require.NoError(t, err)
+		f, err := DecodeGraph(buf)
+		require.NoError(t, err)
+		loaded := NewGraphFromFile(f)
+
+		outputs, err := loaded.Run(t.Context(), loaded.Nodes()[1])
+		require.NoError(t, err)
+		assert.Equal(t, expected, outputs)
+	})
+
+	t.Run("clone", func(t *testing.T) {
+		clone, err := CloneNode(composite)
+		require.NoError(t, err)
+		assert.Zero(t, clone.ID)
+		assert.NotSame(t, composite.Action.(*CompositeAction).Inner, clone.Action.(*CompositeAction).Inner)
+
+		g.AddNode(clone)
+		_, err = g.Connect(load, 0, clone, 0)
+		require.NoError(t, err)
+		outputs, err := g.Run(t.Context(), clone)
+		require.NoError(t, err)
+		assert.Equal(t, expected, outputs)
+	})
+
+	t.Run("internal outputs", func(t *testing.T) {
+		// Outputs wired only inside the group stay inside; inputs with nothing
+		// wired become ports too.
+		a := newCountingNode("a", 0)
+		b := newCountingNode("b", 1)
+		c := newCountingNode("c", 2)
+		g := newTestGraph(t, []*Node{a, b, c}, []*Wire{
+			{StartNode: a, EndNode: b},
+			{StartNode: b, EndNode: c},
+		})
+		composite, err := g.Collapse([]*Node{b, c}, "Group")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"In", "In (c #3)"}, portNames(composite.InputPorts))
+		assert.Equal(t, []string{"Out"}, portNames(composite.OutputPorts))
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		a := newCountingNode("a", 0)
+		b := newCountingNode("b", 1)
+		c := newCountingNode("c", 2)
+		g := newTestGraph(t, []*Node{a, b, c}, []*Wire{
+			{StartNode: a, EndNode: b},
+			{StartNode: b, EndNode: c},
+			{StartNode: a, EndNode: c, EndPort: 1},
+		})
+		_, err := g.Collapse([]*Node{a, c}, "Group")
+		assert.ErrorContains(t, err, "both depends on the group and feeds into it")
+		assert.Len(t, g.Nodes(), 3)
+	})
+}
+
+// Inputs that aren't wired to the composite look unwired inside it.
+func TestCompositeUnwiredInput(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), nil, 0666))
+
+	list := NewListFilesNode(dir)
+	g := newTestGraph(t, []*Node{list}, nil)
+	composite, err := g.Collapse([]*Node{list}, "List")
+	require.NoError(t, err)
+	require.Len(t, composite.InputPorts, 1)
+
+	outputs, err := g.Run(t.Context(), composite)
+	require.NoError(t, err)
+	require.Len(t, outputs, 1)
+	assert.Len(t, outputs[0].TableValue, 1)
+}
+
+// Nodes inside a composite that don't depend on its inputs still run again.
+func TestCompositeRerun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "in.txt")
+	require.NoError(t, os.WriteFile(path, []byte("a\nb"), 0666))
+
+	load := NewLoadFileNode(path)
+	lines := NewLinesNode()
+	g := newTestGraph(t, []*Node{load, lines}, []*Wire{{StartNode: load, EndNode: lines}})
+	composite, err := g.Collapse([]*Node{load, lines}, "Read Lines")
+	require.NoError(t, err)
+	lineCount := func() int {
+		t.Helper()
+		outputs, err := g.Run(t.Context(), composite)
+		require.NoError(t, err)
+		return len(outputs[0].ListValue)
+	}
+
+	assert.Equal(t, 2, lineCount())
+	require.NoError(t, os.WriteFile(path, []byte("a\nb\nc"), 0666))
+	assert.Equal(t, 3, lineCount())
+}
+
+func portNames(ports []NodePort) []string {
+	var res []string
+	for _, port := range ports {
+		res = append(res, port.Name)
+	}
+	return res
+}
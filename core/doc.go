@@ -0,0 +1,21 @@
+// Package core is Flowshell's data model and node actions, without any UI. It
+// can be embedded in other Go programs to build and run flows, and builds
+// without cgo.
+//
+// A flow is a [Graph] of [Node]s connected by [Wire]s. Nodes are created with
+// constructors like [NewLoadFileNode] and [NewAggregateNode], added with
+// [Graph.AddNode], and wired together with [Graph.Connect]. [Graph.Run] runs a
+// node, and everything it depends on, and returns its output [FlowValue]s.
+// [ReadGraphFile] and [NewGraphFromFile] load flows saved by the editor.
+//
+// [Graph.Collapse] replaces a group of nodes with a composite node, whose
+// [CompositeAction] runs the group as a graph of its own. [NewForEachNode]
+// makes a node that runs a graph once for each item of a list.
+//
+// [CompileExpr] compiles a small expression language, like
+// `size > 10MB and endsWith(name, ".log")`, which is checked against the
+// [FlowType]s of the names it uses and evaluated over [FlowValue]s.
+//
+// Messages are logged to [Log], which writes to stderr at [LogLevel] and
+// above. Embedders can replace it with their own [log/slog] logger.
+package core
@@ -0,0 +1,36 @@
+package core_test
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bvisness/flowshell/core"
+)
+
+func Example() {
+	g := core.NewGraph()
+
+	load := core.NewLoadFileNode("../corpus/flute1.csv")
+	load.Action.(*core.LoadFileAction).Format.SelectByValue("csv")
+	mean := core.NewAggregateNode("Mean")
+	g.AddNode(load)
+	g.AddNode(mean)
+	if _, err := g.Connect(load, 0, mean, 0); err != nil {
+		panic(err)
+	}
+
+	outputs, err := g.Run(context.Background(), mean)
+	if err != nil {
+		panic(err)
+	}
+	means := outputs[0]
+	for i, field := range means.Type.ContainedType.Fields {
+		fmt.Printf("%s: %.1f\n", field.Name, means.ColumnValues(i)[0].Float64Value)
+	}
+	// Output:
+	// Time to main (us): 391060.0
+	// Time to first frame (us): 444140.0
+	// Avg build (us): 155.0
+	// Avg draw (us): 8481.0
+	// Avg frame (us): 8636.1
+}
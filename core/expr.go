@@ -0,0 +1,634 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// An expression computed from named values, e.g. `size > 10MB and
+// endsWith(name, ".log")`. Expressions are parsed with ParseExpr, typechecked
+// against the types of the names they use with Check, and run with Eval.
+//
+// The language has:
+//
+//   - Literals: numbers (42, 1.5), strings ("text" or 'text'), true and false.
+//     Numbers can have a unit: sizes in B, KB, MB, GB, TB, KiB, MiB, GiB or TiB,
+//     and durations in ms, s, min (or m), h or d.
+//   - Names: fields of the item being looked at, like size. Names that aren't
+//     plain words can be written in backticks, like `file name`, with any
+//     backticks in the name doubled.
+//   - Field access on records, like item.size.
+//   - Arithmetic: + - * / %, with + also joining strings. Units must agree,
+//     so size + 1KB works but size + 1s doesn't.
+//   - Comparisons: == != < <= > >=
+//   - Boolean logic: and, or, not (or &&, ||, !)
+//   - Function calls, like lower(name). See exprFuncs for the list.
+//
+// Booleans are Int64 values with the well-known type Bool.
+type Expr struct {
+	Src  string
+	Type FlowType // Set by Check
+
+	root  exprNode
+	types map[exprNode]FlowType // The type of each node, set by Check
+}
+
+// An error in an expression, at a particular character.
+type ExprError struct {
+	Pos int // Byte offset into the source
+	Col int // 1-based column, in characters
+	Msg string
+}
+
+func (e *ExprError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Col, e.Msg)
+}
+
+// Spaces and a caret, to show under the source to point at the error.
+func (e *ExprError) Caret() string {
+	return strings.Repeat(" ", e.Col-1) + "^"
+}
+
+func exprErrorf(src string, pos int, format string, args ...any) *ExprError {
+	pos = min(max(pos, 0), len(src))
+	return &ExprError{
+		Pos: pos,
+		Col: utf8.RuneCountInString(src[:pos]) + 1,
+		Msg: fmt.Sprintf(format, args...),
+	}
+}
+
+func ParseExpr(src string) (*Expr, error) {
+	tokens, err := lexExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := exprParser{src: src, tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.Kind != exprEOF {
+		return nil, exprErrorf(src, tok.Pos, "unexpected %s", tok)
+	}
+	return &Expr{Src: src, root: root}, nil
+}
+
+// Parses and typechecks an expression.
+func CompileExpr(src string, vars map[string]FlowType) (*Expr, error) {
+	e, err := ParseExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.Check(vars); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// The names an expression can use to refer to an item of a list or a row of a
+// table: item for the whole thing and, for records, each field by name.
+func ItemExprVars(t FlowType) map[string]FlowType {
+	vars := make(map[string]FlowType)
+	if t.Kind == FSKindRecord {
+		for _, f := range t.Fields {
+			vars[f.Name] = *f.Type
+		}
+	}
+	vars["item"] = t
+	return vars
+}
+
+// The values for the names in ItemExprVars.
+func ItemExprValues(v FlowValue) map[string]FlowValue {
+	values := make(map[string]FlowValue)
+	for _, f := range v.RecordValue {
+		values[f.Name] = f.Value
+	}
+	values["item"] = v
+	return values
+}
+
+// Writes a name so that it parses as one, in backticks if it isn't a plain
+// word. Backticks in the name are doubled.
+func quoteExprName(name string) string {
+	plain := name != ""
+	for i, r := range name {
+		if r != '_' && !unicode.IsLetter(r) && !(i > 0 && unicode.IsDigit(r)) {
+			plain = false
+		}
+	}
+	switch name {
+	case "true", "false", "and", "or", "not":
+		plain = false
+	}
+	if plain {
+		return name
+	}
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// Writes a string literal that parses back to s.
+func quoteExprString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`).Replace(s) + `"`
+}
+
+// ---------------------------
+// Syntax tree
+
+type exprNode interface {
+	pos() int // The character to point at in errors about this node
+}
+
+type exprLiteral struct {
+	Pos   int
+	Value FlowValue
+}
+
+type exprName struct {
+	Pos  int
+	Name string
+}
+
+type exprField struct {
+	Pos  int // The field name
+	X    exprNode
+	Name string
+}
+
+type exprUnary struct {
+	Pos int
+	Op  string
+	X   exprNode
+}
+
+type exprBinary struct {
+	Pos  int // The operator
+	Op   string
+	X, Y exprNode
+}
+
+type exprCall struct {
+	Pos  int
+	Name string
+	Args []exprNode
+}
+
+func (n *exprLiteral) pos() int { return n.Pos }
+func (n *exprName) pos() int    { return n.Pos }
+func (n *exprField) pos() int   { return n.Pos }
+func (n *exprUnary) pos() int   { return n.Pos }
+func (n *exprBinary) pos() int  { return n.Pos }
+func (n *exprCall) pos() int    { return n.Pos }
+
+// Where the node's source starts, to point at a whole argument.
+func exprStart(n exprNode) int {
+	switch n := n.(type) {
+	case *exprField:
+		return exprStart(n.X)
+	case *exprBinary:
+		return exprStart(n.X)
+	default:
+		return n.pos()
+	}
+}
+
+// ---------------------------
+// Lexer
+
+type exprTokenKind int
+
+const (
+	exprEOF exprTokenKind = iota
+	exprNumber
+	exprString
+	exprIdent
+	exprPunct
+)
+
+type exprToken struct {
+	Kind  exprTokenKind
+	Text  string // The source, or for strings and backticked names, the contents
+	Pos   int
+	Value FlowValue // For numbers and strings
+}
+
+func (t exprToken) String() string {
+	if t.Kind == exprEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q", t.Text)
+}
+
+// Two-character operators are listed first so that they win over their
+// prefixes.
+var exprPuncts = []string{"==", "!=", "<=", ">=", "&&", "||", "+", "-", "*", "/", "%", "<", ">", "!", "(", ")", ",", "."}
+
+type exprUnit struct {
+	Unit  FlowUnit
+	Scale float64
+}
+
+// Unit suffixes for number literals, in lowercase. Sizes are in bytes and
+// durations in seconds.
+var exprUnits = map[string]exprUnit{
+	"b":   {FSUnitBytes, 1},
+	"kb":  {FSUnitBytes, 1e3},
+	"mb":  {FSUnitBytes, 1e6},
+	"gb":  {FSUnitBytes, 1e9},
+	"tb":  {FSUnitBytes, 1e12},
+	"kib": {FSUnitBytes, 1 << 10},
+	"mib": {FSUnitBytes, 1 << 20},
+	"gib": {FSUnitBytes, 1 << 30},
+	"tib": {FSUnitBytes, 1 << 40},
+	"ms":  {FSUnitSeconds, 0.001},
+	"s":   {FSUnitSeconds, 1},
+	"m":   {FSUnitSeconds, 60},
+	"min": {FSUnitSeconds, 60},
+	"h":   {FSUnitSeconds, 60 * 60},
+	"d":   {FSUnitSeconds, 24 * 60 * 60},
+}
+
+func lexExpr(src string) ([]exprToken, error) {
+	var tokens []exprToken
+	i := 0
+	for {
+		for i < len(src) {
+			r, size := utf8.DecodeRuneInString(src[i:])
+			if !unicode.IsSpace(r) {
+				break
+			}
+			i += size
+		}
+		if i >= len(src) {
+			return append(tokens, exprToken{Kind: exprEOF, Pos: len(src)}), nil
+		}
+
+		start := i
+		r, _ := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case isExprDigit(src[i]):
+			tok, err := lexExprNumber(src, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, tok)
+			i += len(tok.Text)
+		case src[i] == '"' || src[i] == '\'':
+			tok, err := lexExprString(src, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, tok)
+			i += len(tok.Text)
+		case src[i] == '`':
+			// A doubled backtick stands for one inside the name.
+			var name strings.Builder
+			for i++; ; i++ {
+				end := strings.IndexByte(src[i:], '`')
+				if end < 0 {
+					return nil, exprErrorf(src, start, "unterminated name; add a closing `")
+				}
+				name.WriteString(src[i : i+end])
+				i += end + 1
+				if i >= len(src) || src[i] != '`' {
+					break
+				}
+				name.WriteByte('`')
+			}
+			tokens = append(tokens, exprToken{Kind: exprIdent, Text: name.String(), Pos: start})
+		case r == '_' || unicode.IsLetter(r):
+			for i < len(src) {
+				r, size := utf8.DecodeRuneInString(src[i:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, exprToken{Kind: exprIdent, Text: src[start:i], Pos: start})
+		default:
+			found := false
+			for _, p := range exprPuncts {
+				if strings.HasPrefix(src[i:], p) {
+					tokens = append(tokens, exprToken{Kind: exprPunct, Text: p, Pos: start})
+					i += len(p)
+					found = true
+					break
+				}
+			}
+			if !found {
+				if src[i] == '=' {
+					return nil, exprErrorf(src, start, "unexpected \"=\" (use == to compare)")
+				}
+				return nil, exprErrorf(src, start, "unexpected %q", r)
+			}
+		}
+	}
+}
+
+func isExprDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// Lexes a number, with an optional fraction and unit suffix. Numbers with a
+// unit become Int64s when they come out whole, e.g. 1.5KB is 1500 bytes.
+func lexExprNumber(src string, start int) (exprToken, error) {
+	i := start
+	for i < len(src) && isExprDigit(src[i]) {
+		i++
+	}
+	isFloat := false
+	if i+1 < len(src) && src[i] == '.' && isExprDigit(src[i+1]) {
+		isFloat = true
+		i++
+		for i < len(src) && isExprDigit(src[i]) {
+			i++
+		}
+	}
+	numEnd := i
+	for i < len(src) {
+		r, size := utf8.DecodeRuneInString(src[i:])
+		if !unicode.IsLetter(r) {
+			break
+		}
+		i += size
+	}
+	tok := exprToken{Kind: exprNumber, Text: src[start:i], Pos: start}
+	num, suffix := src[start:numEnd], src[numEnd:i]
+
+	if suffix == "" {
+		if isFloat {
+			f, err := strconv.ParseFloat(num, 64)
+			if err != nil {
+				return tok, exprErrorf(src, start, "invalid number %q", num)
+			}
+			tok.Value = NewFloat64Value(f, 0)
+		} else {
+			n, err := strconv.ParseInt(num, 10, 64)
+			if err != nil {
+				return tok, exprErrorf(src, start, "number %s is too big", num)
+			}
+			tok.Value = NewInt64Value(n, 0)
+		}
+		return tok, nil
+	}
+
+	unit, ok := exprUnits[strings.ToLower(suffix)]
+	if !ok {
+		return tok, exprErrorf(src, numEnd, "unknown unit %q (try B, KB, MB, GB, s, min, h, or d)", suffix)
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return tok, exprErrorf(src, start, "invalid number %q", num)
+	}
+	f *= unit.Scale
+	if f == math.Trunc(f) && math.Abs(f) < 1<<62 {
+		tok.Value = NewInt64Value(int64(f), unit.Unit)
+	} else {
+		tok.Value = NewFloat64Value(f, unit.Unit)
+	}
+	return tok, nil
+}
+
+// Lexes a string in single or double quotes, with backslash escapes.
+func lexExprString(src string, start int) (exprToken, error) {
+	quote := src[start]
+	var sb strings.Builder
+	i := start + 1
+	for {
+		if i >= len(src) {
+			return exprToken{}, exprErrorf(src, start, "unterminated string; add a closing %c", quote)
+		}
+		c := src[i]
+		if c == quote {
+			break
+		}
+		if c == '\\' && i+1 < len(src) {
+			switch src[i+1] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case '\\', '"', '\'':
+				sb.WriteByte(src[i+1])
+			default:
+				return exprToken{}, exprErrorf(src, i, "unknown escape \\%c", src[i+1])
+			}
+			i += 2
+			continue
+		}
+		sb.WriteByte(c)
+		i++
+	}
+	return exprToken{
+		Kind:  exprString,
+		Text:  src[start : i+1],
+		Pos:   start,
+		Value: NewStringValue(sb.String()),
+	}, nil
+}
+
+// ---------------------------
+// Parser
+
+// Operators from loosest to tightest: or, and, not, comparisons, + -, * / %,
+// unary -, then field access and calls.
+type exprParser struct {
+	src    string
+	tokens []exprToken
+	i      int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.i]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.i]
+	if tok.Kind != exprEOF {
+		p.i++
+	}
+	return tok
+}
+
+// Consumes the next token if it is one of the given operators or keywords,
+// returning the operator's canonical name.
+func (p *exprParser) accept(ops ...string) (exprToken, string, bool) {
+	tok := p.peek()
+	if tok.Kind != exprPunct && tok.Kind != exprIdent || tok.Kind == exprIdent && p.src[tok.Pos] == '`' {
+		return tok, "", false
+	}
+	for _, op := range ops {
+		if tok.Text == op {
+			p.next()
+			return tok, exprCanonicalOps[op], true
+		}
+	}
+	return tok, "", false
+}
+
+// Symbolic spellings of the keyword operators, and the names used everywhere
+// else.
+var exprCanonicalOps = map[string]string{
+	"or": "or", "||": "or",
+	"and": "and", "&&": "and",
+	"not": "not", "!": "not",
+	"==": "==", "!=": "!=", "<": "<", "<=": "<=", ">": ">", ">=": ">=",
+	"+": "+", "-": "-", "*": "*", "/": "/", "%": "%",
+}
+
+var exprComparisonOps = []string{"==", "!=", "<", "<=", ">", ">="}
+
+func (p *exprParser) expect(punct string) error {
+	tok := p.next()
+	if tok.Kind != exprPunct || tok.Text != punct {
+		return exprErrorf(p.src, tok.Pos, "expected %q, but got %s", punct, tok)
+	}
+	return nil
+}
+
+func (p *exprParser) parseBinary(ops []string, operand func() (exprNode, error)) (exprNode, error) {
+	x, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, op, ok := p.accept(ops...)
+		if !ok {
+			return x, nil
+		}
+		y, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		x = &exprBinary{Pos: tok.Pos, Op: op, X: x, Y: y}
+	}
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	return p.parseBinary([]string{"or", "||"}, p.parseAnd)
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	return p.parseBinary([]string{"and", "&&"}, p.parseNot)
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	if tok, op, ok := p.accept("not", "!"); ok {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &exprUnary{Pos: tok.Pos, Op: op, X: x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	x, err := p.parseAdd()
+	if err != nil {
+		return nil, err
+	}
+	tok, op, ok := p.accept(exprComparisonOps...)
+	if !ok {
+		return x, nil
+	}
+	y, err := p.parseAdd()
+	if err != nil {
+		return nil, err
+	}
+	if tok, _, ok := p.accept(exprComparisonOps...); ok {
+		return nil, exprErrorf(p.src, tok.Pos, "comparisons can't be chained; join them with and")
+	}
+	return &exprBinary{Pos: tok.Pos, Op: op, X: x, Y: y}, nil
+}
+
+func (p *exprParser) parseAdd() (exprNode, error) {
+	return p.parseBinary([]string{"+", "-"}, p.parseMul)
+}
+
+func (p *exprParser) parseMul() (exprNode, error) {
+	return p.parseBinary([]string{"*", "/", "%"}, p.parseUnary)
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if tok, op, ok := p.accept("-"); ok {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &exprUnary{Pos: tok.Pos, Op: op, X: x}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *exprParser) parsePostfix() (exprNode, error) {
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, _, ok := p.accept("."); !ok {
+			return x, nil
+		}
+		tok := p.next()
+		if tok.Kind != exprIdent {
+			return nil, exprErrorf(p.src, tok.Pos, "expected a field name after \".\", but got %s", tok)
+		}
+		x = &exprField{Pos: tok.Pos, X: x, Name: tok.Text}
+	}
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.next()
+	switch tok.Kind {
+	case exprNumber, exprString:
+		return &exprLiteral{Pos: tok.Pos, Value: tok.Value}, nil
+	case exprIdent:
+		if p.src[tok.Pos] != '`' {
+			switch tok.Text {
+			case "true", "false":
+				return &exprLiteral{Pos: tok.Pos, Value: NewBoolValue(tok.Text == "true")}, nil
+			case "and", "or", "not":
+				return nil, exprErrorf(p.src, tok.Pos, "expected a value, but got %s", tok)
+			}
+		}
+		if _, _, ok := p.accept("("); !ok {
+			return &exprName{Pos: tok.Pos, Name: tok.Text}, nil
+		}
+		call := &exprCall{Pos: tok.Pos, Name: tok.Text}
+		if _, _, ok := p.accept(")"); ok {
+			return call, nil
+		}
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			call.Args = append(call.Args, arg)
+			if _, _, ok := p.accept(","); !ok {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return call, nil
+	case exprPunct:
+		if tok.Text == "(" {
+			x, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+		}
+	}
+	return nil, exprErrorf(p.src, tok.Pos, "expected a value, but got %s", tok)
+}
@@ -0,0 +1,282 @@
+package core
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/bvisness/flowshell/util"
+)
+
+// Typechecks the expression against the types of the names it may use, and
+// sets e.Type.
+func (e *Expr) Check(vars map[string]FlowType) error {
+	types := make(map[exprNode]FlowType)
+	t, err := e.check(e.root, vars, types)
+	if err != nil {
+		return err
+	}
+	e.Type = t
+	e.types = types
+	return nil
+}
+
+// Checks the node and records its type in types.
+func (e *Expr) check(n exprNode, vars map[string]FlowType, types map[exprNode]FlowType) (FlowType, error) {
+	t, err := e.checkNode(n, vars, types)
+	if err == nil {
+		types[n] = t
+	}
+	return t, err
+}
+
+func (e *Expr) checkNode(n exprNode, vars map[string]FlowType, types map[exprNode]FlowType) (FlowType, error) {
+	switch n := n.(type) {
+	case *exprLiteral:
+		return *n.Value.Type, nil
+	case *exprName:
+		t, ok := vars[n.Name]
+		if !ok {
+			return FlowType{}, exprErrorf(e.Src, n.Pos, "unknown name %q (names are: %s)", n.Name, strings.Join(slices.Sorted(maps.Keys(vars)), ", "))
+		}
+		return t, nil
+	case *exprField:
+		x, err := e.check(n.X, vars, types)
+		if err != nil {
+			return FlowType{}, err
+		}
+		return exprFieldType(e.Src, n, x)
+	case *exprUnary:
+		x, err := e.check(n.X, vars, types)
+		if err != nil {
+			return FlowType{}, err
+		}
+		t, err := unaryExprType(n.Op, x)
+		if err != nil {
+			return FlowType{}, exprErrorf(e.Src, n.Pos, "%v", err)
+		}
+		return t, nil
+	case *exprBinary:
+		x, err := e.check(n.X, vars, types)
+		if err != nil {
+			return FlowType{}, err
+		}
+		y, err := e.check(n.Y, vars, types)
+		if err != nil {
+			return FlowType{}, err
+		}
+		t, err := binaryExprType(n.Op, x, y)
+		if err != nil {
+			return FlowType{}, exprErrorf(e.Src, n.Pos, "%v", err)
+		}
+		return t, nil
+	case *exprCall:
+		f, ok := exprFuncs[n.Name]
+		if !ok {
+			return FlowType{}, exprErrorf(e.Src, n.Pos, "unknown function %q", n.Name)
+		}
+		if len(n.Args) != len(f.Params) {
+			return FlowType{}, exprErrorf(e.Src, n.Pos, "%s takes %d arguments, but got %d", f.Signature(n.Name), len(f.Params), len(n.Args))
+		}
+		args := make([]FlowType, len(n.Args))
+		for i, arg := range n.Args {
+			t, err := e.check(arg, vars, types)
+			if err != nil {
+				return FlowType{}, err
+			}
+			if err := f.Params[i].check(t); err != nil {
+				return FlowType{}, exprErrorf(e.Src, exprStart(arg), "argument %d of %s: %v", i+1, f.Signature(n.Name), err)
+			}
+			args[i] = t
+		}
+		t, err := f.Result(args)
+		if err != nil {
+			return FlowType{}, exprErrorf(e.Src, n.Pos, "%s: %v", n.Name, err)
+		}
+		return t, nil
+	default:
+		panic(fmt.Errorf("unknown expression node %T", n))
+	}
+}
+
+func exprFieldType(src string, n *exprField, x FlowType) (FlowType, error) {
+	if x.Kind != FSKindRecord {
+		return FlowType{}, exprErrorf(src, n.Pos, "cannot get field %q of %s, which is not a record", n.Name, exprTypeName(x))
+	}
+	for _, f := range x.Fields {
+		if f.Name == n.Name {
+			return *f.Type, nil
+		}
+	}
+	names := make([]string, len(x.Fields))
+	for i, f := range x.Fields {
+		names[i] = f.Name
+	}
+	return FlowType{}, exprErrorf(src, n.Pos, "no field %q (fields are: %s)", n.Name, strings.Join(names, ", "))
+}
+
+func isExprBool(t FlowType) bool {
+	return t.Kind == FSKindInt64 && t.WellKnownType == FSWKTBool
+}
+
+func isExprNumber(t FlowType) bool {
+	return (t.Kind == FSKindInt64 || t.Kind == FSKindFloat64) && t.WellKnownType != FSWKTBool
+}
+
+func isExprTimestamp(t FlowType) bool {
+	return t.WellKnownType == FSWKTTimestamp
+}
+
+func isExprString(t FlowType) bool {
+	return t.Kind == FSKindBytes
+}
+
+// Describes a type for error messages, including its unit.
+func exprTypeName(t FlowType) string {
+	if isExprNumber(t) && !isExprTimestamp(t) && t.Unit != 0 {
+		return fmt.Sprintf("%s (%s)", t, exprUnitName(t.Unit))
+	}
+	return t.String()
+}
+
+func exprUnitName(u FlowUnit) string {
+	switch u {
+	case FSUnitBytes:
+		return "bytes"
+	case FSUnitSeconds:
+		return "seconds"
+	default:
+		return "no unit"
+	}
+}
+
+func unaryExprType(op string, x FlowType) (FlowType, error) {
+	switch op {
+	case "not":
+		if !isExprBool(x) {
+			return FlowType{}, fmt.Errorf("not needs a Bool, but got %s", exprTypeName(x))
+		}
+		return *FSBool, nil
+	case "-":
+		if !isExprNumber(x) || isExprTimestamp(x) {
+			return FlowType{}, fmt.Errorf("cannot negate %s", exprTypeName(x))
+		}
+		return x, nil
+	default:
+		panic(fmt.Errorf("unknown unary operator %s", op))
+	}
+}
+
+var exprOpVerbs = map[string]string{
+	"+": "add", "-": "subtract", "*": "multiply", "/": "divide", "%": "take the remainder of",
+}
+
+// The type of a binary operation's result. Numbers mix freely, but units must
+// agree, except that a number without a unit takes on the other's unit.
+// Timestamps can be compared, subtracted to get a duration in seconds, and
+// moved by a duration.
+func binaryExprType(op string, x, y FlowType) (FlowType, error) {
+	switch op {
+	case "and", "or":
+		if !isExprBool(x) || !isExprBool(y) {
+			return FlowType{}, fmt.Errorf("%s needs Bool values, but got %s and %s", op, exprTypeName(x), exprTypeName(y))
+		}
+		return *FSBool, nil
+	case "==", "!=", "<", "<=", ">", ">=":
+		ordered := op != "==" && op != "!="
+		switch {
+		case isExprBool(x) && isExprBool(y):
+			if ordered {
+				return FlowType{}, fmt.Errorf("cannot use %s on Bool values", op)
+			}
+		case isExprString(x) && isExprString(y):
+		case isExprNumber(x) && isExprNumber(y):
+			if isExprTimestamp(x) != isExprTimestamp(y) {
+				return FlowType{}, fmt.Errorf("cannot compare %s and %s; use date(\"2006-01-02\") for a timestamp", exprTypeName(x), exprTypeName(y))
+			}
+			if _, ok := sameExprUnit(x.Unit, y.Unit); !ok {
+				return FlowType{}, fmt.Errorf("cannot compare %s and %s", exprTypeName(x), exprTypeName(y))
+			}
+		default:
+			return FlowType{}, fmt.Errorf("cannot compare %s and %s", exprTypeName(x), exprTypeName(y))
+		}
+		return *FSBool, nil
+	case "+", "-", "*", "/", "%":
+		if op == "+" && isExprString(x) && isExprString(y) {
+			return FlowType{Kind: FSKindBytes}, nil
+		}
+		return arithmeticExprType(op, x, y)
+	default:
+		panic(fmt.Errorf("unknown binary operator %s", op))
+	}
+}
+
+func arithmeticExprType(op string, x, y FlowType) (FlowType, error) {
+	mismatch := fmt.Errorf("cannot %s %s and %s", exprOpVerbs[op], exprTypeName(x), exprTypeName(y))
+	if !isExprNumber(x) || !isExprNumber(y) {
+		return FlowType{}, mismatch
+	}
+	kind := FSKindFloat64
+	if x.Kind == FSKindInt64 && y.Kind == FSKindInt64 && op != "/" {
+		kind = FSKindInt64
+	}
+
+	xTime, yTime := isExprTimestamp(x), isExprTimestamp(y)
+	if xTime || yTime {
+		// The other operand must be a duration.
+		other := util.Tern(xTime, y, x)
+		duration := !isExprTimestamp(other) && (other.Unit == 0 || other.Unit == FSUnitSeconds)
+		switch {
+		case op == "-" && xTime && yTime:
+			return FlowType{Kind: FSKindInt64, Unit: FSUnitSeconds}, nil
+		case (op == "+" && xTime != yTime || op == "-" && xTime && !yTime) && duration:
+			return *FSTimestamp, nil
+		default:
+			return FlowType{}, mismatch
+		}
+	}
+
+	var unit FlowUnit
+	switch op {
+	case "+", "-", "%":
+		u, ok := sameExprUnit(x.Unit, y.Unit)
+		if !ok {
+			return FlowType{}, mismatch
+		}
+		unit = u
+	case "*":
+		if x.Unit != 0 && y.Unit != 0 {
+			return FlowType{}, mismatch
+		}
+		unit = max(x.Unit, y.Unit)
+	case "/":
+		switch {
+		case y.Unit == 0:
+			unit = x.Unit
+		case x.Unit == y.Unit:
+			unit = 0 // a ratio
+		default:
+			return FlowType{}, mismatch
+		}
+	}
+	if op == "%" && kind != FSKindInt64 {
+		return FlowType{}, fmt.Errorf("%% needs whole numbers, but got %s and %s", exprTypeName(x), exprTypeName(y))
+	}
+	return FlowType{Kind: kind, Unit: unit}, nil
+}
+
+// The unit of a result combining the two units. A number without a unit
+// takes on the other's unit.
+func sameExprUnit(a, b FlowUnit) (FlowUnit, bool) {
+	switch {
+	case a == b:
+		return a, true
+	case a == 0:
+		return b, true
+	case b == 0:
+		return a, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,236 @@
+package core
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"math"
+
+	"github.com/bvisness/flowshell/util"
+)
+
+// Evaluates the expression with the given values for the names it uses. If
+// the expression hasn't been checked, it is checked against the types of the
+// values first. Errors, like dividing by zero, point at the offending
+// character.
+//
+// Eval may be called from several goroutines at once once the expression has
+// been checked.
+func (e *Expr) Eval(vars map[string]FlowValue) (FlowValue, error) {
+	types := e.types
+	if types == nil {
+		varTypes := make(map[string]FlowType, len(vars))
+		for name, v := range vars {
+			if v.Type != nil {
+				varTypes[name] = *v.Type
+			}
+		}
+		types = make(map[exprNode]FlowType)
+		if _, err := e.check(e.root, varTypes, types); err != nil {
+			return FlowValue{}, err
+		}
+	}
+	return e.eval(e.root, vars, types)
+}
+
+// Evaluates the expression as a condition, e.g. for a filter.
+func (e *Expr) EvalBool(vars map[string]FlowValue) (bool, error) {
+	v, err := e.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	if !isExprBool(*v.Type) {
+		return false, exprErrorf(e.Src, exprStart(e.root), "expected a Bool, but got %s", exprTypeName(*v.Type))
+	}
+	return v.Int64Value != 0, nil
+}
+
+func (e *Expr) eval(n exprNode, vars map[string]FlowValue, types map[exprNode]FlowType) (FlowValue, error) {
+	switch n := n.(type) {
+	case *exprLiteral:
+		return n.Value, nil
+	case *exprName:
+		v, ok := vars[n.Name]
+		if !ok || v.Type == nil {
+			return FlowValue{}, exprErrorf(e.Src, n.Pos, "%s has no value", n.Name)
+		}
+		return v, nil
+	case *exprField:
+		x, err := e.eval(n.X, vars, types)
+		if err != nil {
+			return FlowValue{}, err
+		}
+		if _, err := exprFieldType(e.Src, n, *x.Type); err != nil {
+			return FlowValue{}, err
+		}
+		for _, f := range x.RecordValue {
+			if f.Name == n.Name {
+				return f.Value, nil
+			}
+		}
+		return FlowValue{}, exprErrorf(e.Src, n.Pos, "%s has no value", n.Name)
+	case *exprUnary:
+		x, err := e.eval(n.X, vars, types)
+		if err != nil {
+			return FlowValue{}, err
+		}
+		if _, err := unaryExprType(n.Op, *x.Type); err != nil {
+			return FlowValue{}, exprErrorf(e.Src, n.Pos, "%v", err)
+		}
+		if n.Op == "not" {
+			return NewBoolValue(x.Int64Value == 0), nil
+		}
+		x.Int64Value, x.Float64Value = -x.Int64Value, -x.Float64Value
+		return x, nil
+	case *exprBinary:
+		x, err := e.eval(n.X, vars, types)
+		if err != nil {
+			return FlowValue{}, err
+		}
+		// and and or only look at the right side if they need to.
+		if isExprBool(*x.Type) && (n.Op == "and" && x.Int64Value == 0 || n.Op == "or" && x.Int64Value != 0) {
+			return x, nil
+		}
+		y, err := e.eval(n.Y, vars, types)
+		if err != nil {
+			return FlowValue{}, err
+		}
+		t, err := binaryExprType(n.Op, *x.Type, *y.Type)
+		if err != nil {
+			return FlowValue{}, exprErrorf(e.Src, n.Pos, "%v", err)
+		}
+		v, err := evalExprBinary(n.Op, t, x, y)
+		if err != nil {
+			return FlowValue{}, exprErrorf(e.Src, n.Pos, "%v", err)
+		}
+		return v, nil
+	case *exprCall:
+		if n.Name == "if" {
+			cond, err := e.eval(n.Args[0], vars, types)
+			if err != nil {
+				return FlowValue{}, err
+			}
+			v, err := e.eval(util.Tern(cond.Int64Value != 0, n.Args[1], n.Args[2]), vars, types)
+			if err != nil {
+				return FlowValue{}, err
+			}
+			if t := types[n]; isExprNumber(t) {
+				v = convertExprNumber(v, t)
+			}
+			return v, nil
+		}
+
+		args := make([]FlowValue, len(n.Args))
+		for i, arg := range n.Args {
+			v, err := e.eval(arg, vars, types)
+			if err != nil {
+				return FlowValue{}, err
+			}
+			args[i] = v
+		}
+		v, err := exprFuncs[n.Name].Eval(args)
+		if err != nil {
+			return FlowValue{}, exprErrorf(e.Src, n.Pos, "%s: %v", n.Name, err)
+		}
+		return v, nil
+	default:
+		panic(fmt.Errorf("unknown expression node %T", n))
+	}
+}
+
+// Computes a binary operation whose result type t has been checked.
+func evalExprBinary(op string, t FlowType, x, y FlowValue) (FlowValue, error) {
+	switch op {
+	case "and":
+		return NewBoolValue(x.Int64Value != 0 && y.Int64Value != 0), nil
+	case "or":
+		return NewBoolValue(x.Int64Value != 0 || y.Int64Value != 0), nil
+	case "==", "!=", "<", "<=", ">", ">=":
+		return NewBoolValue(compareExprOp(op, compareExprValues(x, y))), nil
+	}
+
+	if isExprString(t) {
+		return NewStringValue(string(x.BytesValue) + string(y.BytesValue)), nil
+	}
+	res := FlowValue{Type: &t}
+	if x.Type.Kind == FSKindInt64 && y.Type.Kind == FSKindInt64 && t.Kind == FSKindInt64 {
+		a, b := x.Int64Value, y.Int64Value
+		switch op {
+		case "+":
+			res.Int64Value = a + b
+		case "-":
+			res.Int64Value = a - b
+		case "*":
+			res.Int64Value = a * b
+		case "%":
+			if b == 0 {
+				return FlowValue{}, errExprDivideByZero
+			}
+			res.Int64Value = a % b
+		}
+		return res, nil
+	}
+
+	a, b := exprFloat(x), exprFloat(y)
+	var f float64
+	switch op {
+	case "+":
+		f = a + b
+	case "-":
+		f = a - b
+	case "*":
+		f = a * b
+	case "/":
+		if b == 0 {
+			return FlowValue{}, errExprDivideByZero
+		}
+		f = a / b
+	}
+	if t.Kind == FSKindInt64 {
+		// e.g. a timestamp moved by a fractional duration
+		res.Int64Value = int64(math.Round(f))
+	} else {
+		res.Float64Value = f
+	}
+	return res, nil
+}
+
+// Applies a comparison operator to the result of a three-way comparison.
+func compareExprOp(op string, c int) bool {
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+func exprFloat(v FlowValue) float64 {
+	if v.Type.Kind == FSKindInt64 {
+		return float64(v.Int64Value)
+	}
+	return v.Float64Value
+}
+
+// Compares two values whose types have been checked as comparable.
+func compareExprValues(x, y FlowValue) int {
+	if isExprString(*x.Type) {
+		return bytes.Compare(x.BytesValue, y.BytesValue)
+	}
+	return compareExprNumbers(x, y)
+}
+
+func compareExprNumbers(x, y FlowValue) int {
+	if x.Type.Kind == FSKindInt64 && y.Type.Kind == FSKindInt64 {
+		return cmp.Compare(x.Int64Value, y.Int64Value)
+	}
+	return cmp.Compare(exprFloat(x), exprFloat(y))
+}
@@ -0,0 +1,356 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bvisness/flowshell/util"
+)
+
+// A function that can be called in an expression.
+type exprFunc struct {
+	Params []exprParam
+	Doc    string
+
+	// The type of the result, given arguments that passed Params.
+	Result func(args []FlowType) (FlowType, error)
+	Eval   func(args []FlowValue) (FlowValue, error)
+}
+
+type exprParam int
+
+const (
+	exprParamAny exprParam = iota
+	exprParamString
+	exprParamNumber
+	exprParamBool
+)
+
+func (p exprParam) String() string {
+	switch p {
+	case exprParamString:
+		return "string"
+	case exprParamNumber:
+		return "number"
+	case exprParamBool:
+		return "bool"
+	default:
+		return "value"
+	}
+}
+
+func (p exprParam) check(t FlowType) error {
+	var ok bool
+	switch p {
+	case exprParamAny:
+		ok = true
+	case exprParamString:
+		ok = isExprString(t)
+	case exprParamNumber:
+		ok = isExprNumber(t)
+	case exprParamBool:
+		ok = isExprBool(t)
+	}
+	if !ok {
+		return fmt.Errorf("expected a %s, but got %s", p, exprTypeName(t))
+	}
+	return nil
+}
+
+// e.g. "replace(string, string, string)"
+func (f exprFunc) Signature(name string) string {
+	return fmt.Sprintf("%s(%s)", name, strings.Join(util.Map(f.Params, exprParam.String), ", "))
+}
+
+// The functions that can be called in expressions, by name.
+var exprFuncs = map[string]exprFunc{
+	"len": {
+		Params: []exprParam{exprParamAny},
+		Doc:    "The number of characters in a string, or items in a list",
+		Result: func(args []FlowType) (FlowType, error) {
+			if !isExprString(args[0]) && args[0].Kind != FSKindList && args[0].Kind != FSKindTable {
+				return FlowType{}, fmt.Errorf("expected a string, list, or table, but got %s", exprTypeName(args[0]))
+			}
+			return FlowType{Kind: FSKindInt64}, nil
+		},
+		Eval: func(args []FlowValue) (FlowValue, error) {
+			switch args[0].Type.Kind {
+			case FSKindList:
+				return NewInt64Value(int64(len(args[0].ListValue)), 0), nil
+			case FSKindTable:
+				return NewInt64Value(int64(len(args[0].TableValue)), 0), nil
+			default:
+				return NewInt64Value(int64(utf8.RuneCount(args[0].BytesValue)), 0), nil
+			}
+		},
+	},
+	"empty": {
+		Params: []exprParam{exprParamAny},
+		Doc:    "Whether a string, list, or table has nothing in it, or a record's fields are all empty",
+		Result: func(args []FlowType) (FlowType, error) {
+			return *FSBool, nil
+		},
+		Eval: func(args []FlowValue) (FlowValue, error) {
+			return NewBoolValue(isEmptyValue(args[0])), nil
+		},
+	},
+	"lower":      stringExprFunc("The string in lowercase", strings.ToLower),
+	"upper":      stringExprFunc("The string in uppercase", strings.ToUpper),
+	"trim":       stringExprFunc("The string without spaces at either end", strings.TrimSpace),
+	"contains":   stringTestExprFunc("Whether the first string contains the second", strings.Contains),
+	"startsWith": stringTestExprFunc("Whether the first string starts with the second", strings.HasPrefix),
+	"endsWith":   stringTestExprFunc("Whether the first string ends with the second", strings.HasSuffix),
+	"replace": {
+		Params: []exprParam{exprParamString, exprParamString, exprParamString},
+		Doc:    "The first string with every copy of the second replaced by the third",
+		Result: func(args []FlowType) (FlowType, error) {
+			return FlowType{Kind: FSKindBytes}, nil
+		},
+		Eval: func(args []FlowValue) (FlowValue, error) {
+			return NewStringValue(strings.ReplaceAll(string(args[0].BytesValue), string(args[1].BytesValue), string(args[2].BytesValue))), nil
+		},
+	},
+	"abs": {
+		Params: []exprParam{exprParamNumber},
+		Doc:    "The number without its sign",
+		Result: func(args []FlowType) (FlowType, error) {
+			return unaryExprType("-", args[0])
+		},
+		Eval: func(args []FlowValue) (FlowValue, error) {
+			v := args[0]
+			v.Int64Value = util.Tern(v.Int64Value < 0, -v.Int64Value, v.Int64Value)
+			v.Float64Value = math.Abs(v.Float64Value)
+			return v, nil
+		},
+	},
+	"round": roundExprFunc("The number rounded to the nearest whole number", math.Round),
+	"floor": roundExprFunc("The number rounded down", math.Floor),
+	"ceil":  roundExprFunc("The number rounded up", math.Ceil),
+	"min":   minMaxExprFunc("The smaller of two numbers", -1),
+	"max":   minMaxExprFunc("The larger of two numbers", 1),
+	"int": {
+		Params: []exprParam{exprParamAny},
+		Doc:    "Converts a number, bool, or string to a whole number, dropping any fraction",
+		Result: func(args []FlowType) (FlowType, error) {
+			if !isExprNumber(args[0]) && !isExprBool(args[0]) && !isExprString(args[0]) {
+				return FlowType{}, fmt.Errorf("cannot convert %s to a number", exprTypeName(args[0]))
+			}
+			return FlowType{Kind: FSKindInt64, Unit: util.Tern(isExprNumber(args[0]), args[0].Unit, 0)}, nil
+		},
+		Eval: func(args []FlowValue) (FlowValue, error) {
+			v := args[0]
+			switch {
+			case isExprString(*v.Type):
+				n, err := strconv.ParseInt(strings.TrimSpace(string(v.BytesValue)), 10, 64)
+				if err != nil {
+					return FlowValue{}, fmt.Errorf("%q is not a whole number", v.BytesValue)
+				}
+				return NewInt64Value(n, 0), nil
+			case v.Type.Kind == FSKindFloat64:
+				return NewInt64Value(int64(v.Float64Value), v.Type.Unit), nil
+			default:
+				return NewInt64Value(v.Int64Value, util.Tern(isExprBool(*v.Type), 0, v.Type.Unit)), nil
+			}
+		},
+	},
+	"float": {
+		Params: []exprParam{exprParamAny},
+		Doc:    "Converts a number or string to a decimal number",
+		Result: func(args []FlowType) (FlowType, error) {
+			if !isExprNumber(args[0]) && !isExprString(args[0]) {
+				return FlowType{}, fmt.Errorf("cannot convert %s to a number", exprTypeName(args[0]))
+			}
+			return FlowType{Kind: FSKindFloat64, Unit: args[0].Unit}, nil
+		},
+		Eval: func(args []FlowValue) (FlowValue, error) {
+			v := args[0]
+			switch v.Type.Kind {
+			case FSKindBytes:
+				f, err := strconv.ParseFloat(strings.TrimSpace(string(v.BytesValue)), 64)
+				if err != nil {
+					return FlowValue{}, fmt.Errorf("%q is not a number", v.BytesValue)
+				}
+				return NewFloat64Value(f, 0), nil
+			case FSKindInt64:
+				return NewFloat64Value(float64(v.Int64Value), v.Type.Unit), nil
+			default:
+				return NewFloat64Value(v.Float64Value, v.Type.Unit), nil
+			}
+		},
+	},
+	"str": {
+		Params: []exprParam{exprParamAny},
+		Doc:    "Converts a number, bool, or timestamp to a string",
+		Result: func(args []FlowType) (FlowType, error) {
+			if !isExprNumber(args[0]) && !isExprBool(args[0]) && !isExprString(args[0]) {
+				return FlowType{}, fmt.Errorf("cannot convert %s to a string", exprTypeName(args[0]))
+			}
+			return FlowType{Kind: FSKindBytes}, nil
+		},
+		Eval: func(args []FlowValue) (FlowValue, error) {
+			v := args[0]
+			switch {
+			case isExprString(*v.Type):
+				return v, nil
+			case isExprBool(*v.Type):
+				return NewStringValue(util.Tern(v.Int64Value != 0, "true", "false")), nil
+			case isExprTimestamp(*v.Type):
+				return NewStringValue(time.Unix(v.Int64Value, 0).Format(time.RFC3339)), nil
+			case v.Type.Kind == FSKindInt64:
+				return NewStringValue(strconv.FormatInt(v.Int64Value, 10)), nil
+			default:
+				return NewStringValue(strconv.FormatFloat(v.Float64Value, 'g', -1, 64)), nil
+			}
+		},
+	},
+	"date": {
+		Params: []exprParam{exprParamString},
+		Doc:    "Parses a local date and time like 2024-01-31 or 2024-01-31 15:04, or an RFC 3339 timestamp",
+		Result: func(args []FlowType) (FlowType, error) {
+			return *FSTimestamp, nil
+		},
+		Eval: func(args []FlowValue) (FlowValue, error) {
+			str := strings.TrimSpace(string(args[0].BytesValue))
+			if t, err := time.Parse(time.RFC3339, str); err == nil {
+				return NewTimestampValue(t), nil
+			}
+			for _, layout := range []string{time.DateOnly, "2006-01-02 15:04", time.DateTime} {
+				if t, err := time.ParseInLocation(layout, str, time.Local); err == nil {
+					return NewTimestampValue(t), nil
+				}
+			}
+			return FlowValue{}, fmt.Errorf("cannot read %q as a date; write it like 2024-01-31 or 2024-01-31 15:04", str)
+		},
+	},
+	"if": {
+		Params: []exprParam{exprParamBool, exprParamAny, exprParamAny},
+		Doc:    "The second value if the condition is true, and the third otherwise",
+		Result: func(args []FlowType) (FlowType, error) {
+			return commonExprType(args[1], args[2])
+		},
+		// Evaluated lazily by Expr.Eval, so that only the chosen branch runs.
+	},
+}
+
+func stringExprFunc(doc string, f func(string) string) exprFunc {
+	return exprFunc{
+		Params: []exprParam{exprParamString},
+		Doc:    doc,
+		Result: func(args []FlowType) (FlowType, error) {
+			return FlowType{Kind: FSKindBytes}, nil
+		},
+		Eval: func(args []FlowValue) (FlowValue, error) {
+			return NewStringValue(f(string(args[0].BytesValue))), nil
+		},
+	}
+}
+
+func stringTestExprFunc(doc string, f func(s, substr string) bool) exprFunc {
+	return exprFunc{
+		Params: []exprParam{exprParamString, exprParamString},
+		Doc:    doc,
+		Result: func(args []FlowType) (FlowType, error) {
+			return *FSBool, nil
+		},
+		Eval: func(args []FlowValue) (FlowValue, error) {
+			return NewBoolValue(f(string(args[0].BytesValue), string(args[1].BytesValue))), nil
+		},
+	}
+}
+
+func roundExprFunc(doc string, f func(float64) float64) exprFunc {
+	return exprFunc{
+		Params: []exprParam{exprParamNumber},
+		Doc:    doc,
+		Result: func(args []FlowType) (FlowType, error) {
+			return FlowType{Kind: FSKindInt64, Unit: args[0].Unit, WellKnownType: args[0].WellKnownType}, nil
+		},
+		Eval: func(args []FlowValue) (FlowValue, error) {
+			v := args[0]
+			if v.Type.Kind == FSKindInt64 {
+				return v, nil
+			}
+			return NewInt64Value(int64(f(v.Float64Value)), v.Type.Unit), nil
+		},
+	}
+}
+
+// sign is -1 for min and 1 for max.
+func minMaxExprFunc(doc string, sign int) exprFunc {
+	return exprFunc{
+		Params: []exprParam{exprParamNumber, exprParamNumber},
+		Doc:    doc,
+		Result: func(args []FlowType) (FlowType, error) {
+			return commonExprType(args[0], args[1])
+		},
+		Eval: func(args []FlowValue) (FlowValue, error) {
+			t, err := commonExprType(*args[0].Type, *args[1].Type)
+			if err != nil {
+				return FlowValue{}, err
+			}
+			v := util.Tern(compareExprNumbers(args[0], args[1])*sign >= 0, args[0], args[1])
+			return convertExprNumber(v, t), nil
+		},
+	}
+}
+
+// The type that can hold either of two values, e.g. for the branches of if().
+// Numbers are widened to Float64 if either is one.
+func commonExprType(a, b FlowType) (FlowType, error) {
+	if isExprNumber(a) && isExprNumber(b) {
+		if _, err := binaryExprType("<", a, b); err != nil {
+			return FlowType{}, fmt.Errorf("%s and %s don't match", exprTypeName(a), exprTypeName(b))
+		}
+		unit, _ := sameExprUnit(a.Unit, b.Unit)
+		if a.Kind == FSKindInt64 && b.Kind == FSKindInt64 {
+			return FlowType{Kind: FSKindInt64, Unit: unit, WellKnownType: a.WellKnownType}, nil
+		}
+		return FlowType{Kind: FSKindFloat64, Unit: unit}, nil
+	}
+	if Typecheck(a, b) != nil || Typecheck(b, a) != nil || isExprBool(a) != isExprBool(b) {
+		return FlowType{}, fmt.Errorf("%s and %s don't match", exprTypeName(a), exprTypeName(b))
+	}
+	return a, nil
+}
+
+// Converts a number to the given numeric type.
+func convertExprNumber(v FlowValue, t FlowType) FlowValue {
+	res := FlowValue{Type: &t}
+	switch {
+	case t.Kind == v.Type.Kind:
+		res.Int64Value, res.Float64Value = v.Int64Value, v.Float64Value
+	case t.Kind == FSKindFloat64:
+		res.Float64Value = float64(v.Int64Value)
+	default:
+		res.Int64Value = int64(v.Float64Value)
+	}
+	return res
+}
+
+var errExprDivideByZero = errors.New("division by zero")
+
+// Numbers and bools are never empty.
+func isEmptyValue(v FlowValue) bool {
+	switch v.Type.Kind {
+	case FSKindBytes:
+		return len(v.BytesValue) == 0
+	case FSKindList:
+		return len(v.ListValue) == 0
+	case FSKindTable:
+		return len(v.TableValue) == 0
+	case FSKindRecord:
+		for _, f := range v.RecordValue {
+			if !isEmptyValue(f.Value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,205 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func exprTestFile() FlowValue {
+	return FlowValue{
+		Type: FSFile,
+		RecordValue: []FlowValueField{
+			{Name: "name", Value: NewStringValue("Report.LOG")},
+			{Name: "type", Value: NewStringValue("file")},
+			{Name: "size", Value: NewInt64Value(2_500_000, FSUnitBytes)},
+			{Name: "modified", Value: NewTimestampValue(time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local))},
+		},
+	}
+}
+
+func TestExprEval(t *testing.T) {
+	file := exprTestFile()
+	vars := ItemExprVars(*file.Type)
+	values := ItemExprValues(file)
+	values["spaced name"] = NewInt64Value(7, 0)
+	vars["spaced name"] = *values["spaced name"].Type
+
+	for _, test := range []struct {
+		src      string
+		expected FlowValue
+	}{
+		// Arithmetic and precedence
+		{"1 + 2 * 3", NewInt64Value(7, 0)},
+		{"(1 + 2) * 3", NewInt64Value(9, 0)},
+		{"7 % 3 - -1", NewInt64Value(2, 0)},
+		{"7 / 2", NewFloat64Value(3.5, 0)},
+		{"1 + 0.5", NewFloat64Value(1.5, 0)},
+		{"`spaced name` * 2", NewInt64Value(14, 0)},
+
+		// Units
+		{"1.5KB", NewInt64Value(1500, FSUnitBytes)},
+		{"2KiB", NewInt64Value(2048, FSUnitBytes)},
+		{"1.5s", NewFloat64Value(1.5, FSUnitSeconds)},
+		{"2h + 30min", NewInt64Value(9000, FSUnitSeconds)},
+		{"size + 500KB", NewInt64Value(3_000_000, FSUnitBytes)},
+		{"size / 1MB", NewFloat64Value(2.5, 0)},
+		{"size * 2", NewInt64Value(5_000_000, FSUnitBytes)},
+		{"size > 2MB", NewBoolValue(true)},
+		{"size > 2500000", NewBoolValue(false)},
+
+		// Timestamps
+		{"modified > date(\"2024-02-29\")", NewBoolValue(true)},
+		{"modified - date(\"2024-03-01\")", NewInt64Value(12*60*60, FSUnitSeconds)},
+		{"modified + 1d > date(\"2024-03-02 11:59\")", NewBoolValue(true)},
+
+		// Strings
+		{"name + \"!\"", NewStringValue("Report.LOG!")},
+		{"lower(name)", NewStringValue("report.log")},
+		{"endsWith(lower(name), '.log')", NewBoolValue(true)},
+		{"contains(name, \"port\") and not startsWith(name, \"x\")", NewBoolValue(true)},
+		{"replace(\"a-b-c\", \"-\", \"+\")", NewStringValue("a+b+c")},
+		{"len(\"héllo\")", NewInt64Value(5, 0)},
+		{"\"abc\" < \"abd\"", NewBoolValue(true)},
+		{"empty(name) or not empty(\"\")", NewBoolValue(false)},
+		{"trim(\"  \\\"hi\\\"\\t\")", NewStringValue("\"hi\"")},
+
+		// Boolean logic and comparisons
+		{"true and false or true", NewBoolValue(true)},
+		{"!(1 == 1) || 2 != 2", NewBoolValue(false)},
+		{"1 < 1.5 && 2 >= 2", NewBoolValue(true)},
+		{"false and 1 / 0 > 0", NewBoolValue(false)},
+
+		// Fields
+		{"item.size == size", NewBoolValue(true)},
+		{"type == \"file\"", NewBoolValue(true)},
+
+		// Functions
+		{"if(size > 1MB, \"big\", \"small\")", NewStringValue("big")},
+		{"if(false, 1, 2.5)", NewFloat64Value(2.5, 0)},
+		{"if(true, 1, 2.5)", NewFloat64Value(1, 0)},
+		{"max(1, 2.5) + min(3, 4)", NewFloat64Value(5.5, 0)},
+		{"round(2.5) + floor(1.9) + ceil(0.1)", NewInt64Value(5, 0)},
+		{"abs(-3)", NewInt64Value(3, 0)},
+		{"int(\"42\") + int(3.9) + int(true)", NewInt64Value(46, 0)},
+		{"float(\"0.25\")", NewFloat64Value(0.25, 0)},
+		{"str(size) + str(1.5) + str(false)", NewStringValue("25000001.5false")},
+	} {
+		t.Run(test.src, func(t *testing.T) {
+			e, err := CompileExpr(test.src, vars)
+			require.NoError(t, err)
+			assert.Equal(t, *test.expected.Type, e.Type)
+
+			v, err := e.Eval(values)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, v)
+
+			// Unchecked expressions are checked against the values.
+			unchecked, err := ParseExpr(test.src)
+			require.NoError(t, err)
+			v, err = unchecked.Eval(values)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, v)
+		})
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	file := exprTestFile()
+	vars := ItemExprVars(*file.Type)
+
+	for _, test := range []struct {
+		src   string
+		col   int
+		msg   string
+		check bool // Whether the error comes from typechecking rather than parsing
+	}{
+		{"1 +", 4, "expected a value, but got end of expression", false},
+		{"(1 + 2", 7, `expected ")"`, false},
+		{"size = 1", 6, "use == to compare", false},
+		{"1 < 2 < 3", 7, "can't be chained", false},
+		{"\"abc", 1, "unterminated string", false},
+		{"10XB", 3, `unknown unit "XB"`, false},
+		{"1 # 2", 3, `unexpected '#'`, false},
+		{"item.", 6, "expected a field name", false},
+		{"siz > 1", 1, `unknown name "siz" (names are: item, modified, name, size, type)`, true},
+		{"item.nmae", 6, `no field "nmae" (fields are: name, type, size, modified)`, true},
+		{"name.x", 6, "not a record", true},
+		{"size + 1s", 6, "cannot add Int64 (bytes) and Int64 (seconds)", true},
+		{"size > 1h", 6, "cannot compare", true},
+		{"modified > 5", 10, "use date(", true},
+		{"name * 2", 6, "cannot multiply Bytes and Int64", true},
+		{"1.5 % 2", 5, "% needs whole numbers", true},
+		{"not size", 1, "not needs a Bool", true},
+		{"size and true", 6, "and needs Bool values", true},
+		{"lower(size)", 7, "argument 1 of lower(string): expected a string, but got Int64 (bytes)", true},
+		{"lower(name, name)", 1, "takes 1 arguments, but got 2", true},
+		{"frob(name)", 1, `unknown function "frob"`, true},
+		{"if(true, 1, \"a\")", 1, "don't match", true},
+		{"héllo + 1", 1, `unknown name "héllo"`, true},
+		{"\"é\" + size", 5, "cannot add", true},
+	} {
+		t.Run(test.src, func(t *testing.T) {
+			e, err := ParseExpr(test.src)
+			if !test.check {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				err = e.Check(vars)
+				require.Error(t, err)
+			}
+			var exprErr *ExprError
+			require.ErrorAs(t, err, &exprErr)
+			assert.Contains(t, exprErr.Msg, test.msg)
+			assert.Equal(t, test.col, exprErr.Col, "error should point at column %d, but points at:\n%s\n%s", test.col, test.src, exprErr.Caret())
+		})
+	}
+}
+
+func TestExprRuntimeErrors(t *testing.T) {
+	for _, test := range []struct {
+		src string
+		col int
+		msg string
+	}{
+		{"1 / (2 - 2)", 3, "division by zero"},
+		{"5 % 0", 3, "division by zero"},
+		{"int(\"x\") + 1", 1, `int: "x" is not a whole number`},
+		{"date(\"yesterday\")", 1, "cannot read \"yesterday\" as a date"},
+	} {
+		t.Run(test.src, func(t *testing.T) {
+			e, err := CompileExpr(test.src, nil)
+			require.NoError(t, err)
+			_, err = e.Eval(nil)
+			var exprErr *ExprError
+			require.ErrorAs(t, err, &exprErr)
+			assert.Contains(t, exprErr.Msg, test.msg)
+			assert.Equal(t, test.col, exprErr.Col)
+		})
+	}
+
+	e, err := CompileExpr("1 + 1", nil)
+	require.NoError(t, err)
+	_, err = e.EvalBool(nil)
+	assert.EqualError(t, err, "column 1: expected a Bool, but got Int64")
+}
+
+// Names and strings written by the Filter node's simple modes parse back to
+// themselves.
+func TestExprQuoting(t *testing.T) {
+	for _, name := range []string{"size", "file name", "a`b", "`", "``x``", "true", "2x", "héllo"} {
+		t.Run(name, func(t *testing.T) {
+			src := quoteExprName(name) + " + " + quoteExprString(name)
+			e, err := CompileExpr(src, map[string]FlowType{name: *NewStringValue("").Type})
+			require.NoError(t, err, src)
+			v, err := e.Eval(map[string]FlowValue{name: NewStringValue("!")})
+			require.NoError(t, err, src)
+			assert.Equal(t, NewStringValue("!"+name), v)
+		})
+	}
+
+	_, err := ParseExpr("`a``")
+	assert.EqualError(t, err, "column 1: unterminated name; add a closing `")
+}
@@ -0,0 +1,192 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/bvisness/flowshell/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterTable(t *testing.T) {
+	dir := t.TempDir()
+	for name, size := range map[string]int{"empty.log": 0, "small.txt": 10, "big.log": 1_000_000} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), make([]byte, size), 0666))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub dir"), 0777))
+
+	listFiles := NewListFilesNode(dir)
+	filter := NewFilterNode(FilterCompare)
+	g := newTestGraph(t, []*Node{listFiles, filter}, []*Wire{
+		{StartNode: listFiles, EndNode: filter},
+	})
+	a := filter.Action.(*FilterAction)
+
+	g.Validate()
+	assert.Equal(t, listFiles.OutputPorts[0].Type, filter.OutputPorts[0].Type)
+	assert.Equal(t, []string{"name", "type", "size", "modified"}, util.Map(a.Columns.Options, func(o ChoiceOption) string { return o.Name }))
+	assert.Equal(t, "name", a.Column)
+
+	for _, test := range []struct {
+		name     string
+		mode     string
+		column   string
+		op       string
+		value    string
+		expr     string
+		expected []string
+	}{
+		{name: "string", mode: FilterCompare, column: "name", op: "==", value: "small.txt", expected: []string{"small.txt"}},
+		{name: "string func", mode: FilterCompare, column: "name", op: "endsWith", value: ".log", expected: []string{"big.log", "empty.log"}},
+		{name: "quoted string", mode: FilterCompare, column: "name", op: "contains", value: `"`, expected: nil},
+		{name: "units", mode: FilterCompare, column: "size", op: ">", value: "0.5MB", expected: []string{"big.log"}},
+		{name: "timestamp", mode: FilterCompare, column: "modified", op: ">", value: "2000-01-01", expected: []string{"big.log", "empty.log", "small.txt", "sub dir"}},
+		{name: "non-empty", mode: FilterNonEmpty, column: "name", expected: []string{"big.log", "empty.log", "small.txt", "sub dir"}},
+		{name: "expression", mode: FilterExpression, expr: `type == "file" and size < 1KB`, expected: []string{"empty.log", "small.txt"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			a.Mode.SelectByValue(test.mode)
+			a.Column = test.column
+			a.Op.SelectByValue(test.op)
+			a.Value = test.value
+			a.Expr = test.expr
+			filter.MarkChanged(g)
+
+			g.Validate()
+			require.True(t, filter.Valid, "%v", a.Err)
+			res, err := g.Run(t.Context(), filter)
+			require.NoError(t, err)
+			assert.Equal(t, filter.OutputPorts[0].Type, *res[0].Type)
+			names := util.Map(res[0].ColumnValues(0), func(v FlowValue) string { return string(v.BytesValue) })
+			assert.ElementsMatch(t, test.expected, names)
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		a.Mode.SelectByValue(FilterCompare)
+		a.Column = "size"
+		a.Op.SelectByValue(">")
+		a.Value = "1KB +"
+		g.Validate()
+		assert.False(t, filter.Valid)
+		assert.EqualError(t, a.Err, "value: column 6: expected a value, but got end of expression")
+
+		a.Value = "1s"
+		g.Validate()
+		assert.False(t, filter.Valid)
+		assert.ErrorContains(t, a.Err, "cannot compare Int64 (bytes) and Int64 (seconds)")
+
+		a.Op.SelectByValue("contains")
+		a.Value = "1"
+		g.Validate()
+		assert.False(t, filter.Valid)
+		assert.EqualError(t, a.Err, `contains needs a text column, but "size" is Int64 (bytes)`)
+
+		a.Mode.SelectByValue(FilterExpression)
+		a.Expr = "size"
+		g.Validate()
+		assert.False(t, filter.Valid)
+		assert.EqualError(t, a.Err, "column 1: the condition should be true or false, but is Int64 (bytes)")
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		a.Mode.SelectByValue(FilterCompare)
+		a.Column = "size"
+		a.Op.SelectByValue("<")
+		a.Value = "100"
+
+		buf, err := EncodeGraphText(g.File())
+		require.NoError(t, err)
+		f, err := DecodeGraph(buf)
+		require.NoError(t, err)
+		loaded := NewGraphFromFile(f)
+		loadedFilter := loaded.Nodes()[1]
+
+		res, err := loaded.Run(t.Context(), loadedFilter)
+		require.NoError(t, err)
+		names := util.Map(res[0].ColumnValues(0), func(v FlowValue) string { return string(v.BytesValue) })
+		assert.ElementsMatch(t, []string{"empty.log", "small.txt"}, slices.DeleteFunc(names, func(name string) bool { return name == "sub dir" }))
+	})
+}
+
+// A CSV file's columns aren't known until it loads.
+func TestFilterCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.csv")
+	require.NoError(t, os.WriteFile(path, []byte("a,b\n1,20\n3,10\n5,0\n"), 0666))
+
+	load := NewLoadFileNode(path)
+	filter := NewFilterNode(FilterCompare)
+	g := newTestGraph(t, []*Node{load, filter}, nil)
+	g.Validate() // so that Load File outputs a table
+	_, err := g.Connect(load, 0, filter, 0)
+	require.NoError(t, err)
+	a := filter.Action.(*FilterAction)
+	a.Op.SelectByValue(">")
+	a.Value = "2"
+
+	g.Validate()
+	assert.True(t, filter.Valid)
+	assert.Empty(t, a.Columns.Options)
+
+	// Without a column chosen, the first one is checked.
+	res, err := g.Run(t.Context(), filter)
+	require.NoError(t, err)
+	assert.Equal(t, []FlowValue{NewFloat64Value(3, 0), NewFloat64Value(5, 0)}, res[0].ColumnValues(0))
+
+	// Once the file has loaded, its columns are offered.
+	g.Validate()
+	assert.Equal(t, []string{"a", "b"}, util.Map(a.Columns.Options, func(o ChoiceOption) string { return o.Name }))
+	assert.Equal(t, "a", a.Column)
+
+	a.Column = "b"
+	filter.MarkChanged(g)
+	res, err = g.Run(t.Context(), filter)
+	require.NoError(t, err)
+	assert.Equal(t, []FlowValue{NewFloat64Value(20, 0), NewFloat64Value(10, 0)}, res[0].ColumnValues(1))
+
+	a.Op.SelectByValue("contains")
+	filter.MarkChanged(g)
+	_, err = g.Run(t.Context(), filter)
+	assert.ErrorContains(t, err, `contains needs a text column, but "b" is Float64`)
+}
+
+func TestFilterList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lines.txt")
+	require.NoError(t, os.WriteFile(path, []byte("one\n\ntwo\n\nthree"), 0666))
+
+	load := NewLoadFileNode(path)
+	lines := NewLinesNode()
+	filter := NewFilterNode(FilterNonEmpty)
+	g := newTestGraph(t, []*Node{load, lines, filter}, []*Wire{
+		{StartNode: load, EndNode: lines},
+		{StartNode: lines, EndNode: filter},
+	})
+
+	g.Validate()
+	assert.True(t, filter.Valid)
+	assert.Equal(t, lines.OutputPorts[0].Type, filter.OutputPorts[0].Type)
+	assert.Empty(t, filter.Action.(*FilterAction).Columns.Options)
+
+	res, err := g.Run(t.Context(), filter)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"one", "two", "three"}, util.Map(res[0].ListValue, func(v FlowValue) string { return string(v.BytesValue) }))
+
+	t.Run("compare", func(t *testing.T) {
+		a := filter.Action.(*FilterAction)
+		a.Mode.SelectByValue(FilterCompare)
+		a.Op.SelectByValue("startsWith")
+		a.Value = "t"
+		filter.MarkChanged(g)
+
+		res, err := g.Run(t.Context(), filter)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"two", "three"}, util.Map(res[0].ListValue, func(v FlowValue) string { return string(v.BytesValue) }))
+
+		a.Mode.SelectByValue(FilterExpression)
+		a.ModeChanged(filter, FilterCompare)
+		assert.Equal(t, `startsWith(item, "t")`, a.Expr)
+	})
+}
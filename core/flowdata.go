@@ -1,9 +1,11 @@
-package app
+package core
 
 import (
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/bvisness/flowshell/util"
 )
 
 type FlowValue struct {
@@ -22,6 +24,43 @@ type FlowValueField struct {
 	Value FlowValue
 }
 
+var _ Serializable = &FlowValue{}
+
+func (v *FlowValue) Serialize(s *Serializer) bool {
+	SMaybeThing(s.Key("type"), &v.Type)
+	if !s.Ok() || v.Type == nil {
+		return s.Ok()
+	}
+
+	switch v.Type.Kind {
+	case FSKindBytes:
+		SBytes(s.Key("bytes"), &v.BytesValue)
+	case FSKindInt64:
+		SInt(s.Key("int64"), &v.Int64Value)
+	case FSKindFloat64:
+		SFloat(s.Key("float64"), &v.Float64Value)
+	case FSKindList:
+		SSlice(s.Key("list"), &v.ListValue)
+	case FSKindRecord:
+		SSlice(s.Key("record"), &v.RecordValue)
+	case FSKindTable:
+		SSeq(s.Key("table"), len(v.TableValue), func(n int) {
+			v.TableValue = make([][]FlowValueField, n)
+		}, func(i int) bool {
+			return SSlice(s, &v.TableValue[i])
+		})
+	default:
+		return s.Error(fmt.Errorf("cannot serialize a value of type %s", v.Type))
+	}
+	return s.Ok()
+}
+
+func (f *FlowValueField) Serialize(s *Serializer) bool {
+	SStr(s.Key("name"), &f.Name)
+	SThing(s.Key("value"), &f.Value)
+	return s.Ok()
+}
+
 func (v *FlowValue) ColumnValues(col int) []FlowValue {
 	if v.Type.Kind != FSKindTable {
 		panic(fmt.Errorf("value %s was not a table", v))
@@ -71,6 +110,8 @@ func (t FlowType) String() string {
 		return "File"
 	case FSWKTTimestamp:
 		return "Timestamp"
+	case FSWKTBool:
+		return "Bool"
 	}
 
 	joinFields := func(fields []FlowField) string {
@@ -102,10 +143,13 @@ func (t FlowType) String() string {
 }
 
 func (t *FlowType) Serialize(s *Serializer) bool {
-	SInt(s, &t.Kind)
-	SMaybeThing(s, &t.ContainedType)
-	SSlice(s, &t.Fields)
-	SInt(s, &t.Unit)
+	SInt(s.Key("kind"), &t.Kind)
+	SMaybeThing(s.Key("contained"), &t.ContainedType)
+	SSlice(s.Key("fields"), &t.Fields)
+	SInt(s.Key("unit"), &t.Unit)
+	if s.Version >= 5 {
+		SInt(s.Key("wellKnownType"), &t.WellKnownType)
+	}
 	return s.Ok()
 }
 
@@ -150,8 +194,8 @@ type FlowField struct {
 }
 
 func (f *FlowField) Serialize(s *Serializer) bool {
-	SStr(s, &f.Name)
-	SMaybeThing(s, &f.Type)
+	SStr(s.Key("name"), &f.Name)
+	SMaybeThing(s.Key("type"), &f.Type)
 	return s.Ok()
 }
 
@@ -167,6 +211,7 @@ type FlowWellKnownType int
 const (
 	FSWKTFile FlowWellKnownType = iota + 1
 	FSWKTTimestamp
+	FSWKTBool // An Int64 that is 1 for true and 0 for false
 )
 
 var FSFile = &FlowType{
@@ -186,6 +231,11 @@ var FSTimestamp = &FlowType{
 	WellKnownType: FSWKTTimestamp,
 }
 
+var FSBool = &FlowType{
+	Kind:          FSKindInt64,
+	WellKnownType: FSWKTBool,
+}
+
 // ---------------------------
 // Constructors
 
@@ -240,6 +290,10 @@ func NewTimestampValue(t time.Time) FlowValue {
 	return FlowValue{Type: FSTimestamp, Int64Value: t.Unix()}
 }
 
+func NewBoolValue(b bool) FlowValue {
+	return FlowValue{Type: FSBool, Int64Value: util.Tern[int64](b, 1, 0)}
+}
+
 func NewListValue(contained FlowType, items []FlowValue) FlowValue {
 	t := NewListType(contained)
 	for _, item := range items {
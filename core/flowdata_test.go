@@ -0,0 +1,63 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bvisness/flowshell/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlowValueRoundTrip(t *testing.T) {
+	file := FlowValue{
+		Type: FSFile,
+		RecordValue: []FlowValueField{
+			{Name: "name", Value: NewStringValue("flute1.csv")},
+			{Name: "type", Value: NewStringValue("f")},
+			{Name: "size", Value: NewInt64Value(1234, FSUnitBytes)},
+			{Name: "modified", Value: NewTimestampValue(time.Unix(1700000000, 0))},
+		},
+	}
+	table := FlowValue{
+		Type: &FlowType{Kind: FSKindTable, ContainedType: FSFile},
+		TableValue: [][]FlowValueField{
+			file.RecordValue,
+			file.RecordValue,
+		},
+	}
+
+	values := map[string]FlowValue{
+		"bytes":     NewBytesValue([]byte{0, 1, 2, 0xff}),
+		"int64":     NewInt64Value(-42, FSUnitBytes),
+		"float64":   NewFloat64Value(3.25, FSUnitSeconds),
+		"timestamp": NewTimestampValue(time.Unix(1700000000, 0)),
+		"list":      NewListValue(FlowType{Kind: FSKindBytes}, []FlowValue{NewStringValue("a"), NewStringValue("b")}),
+		"record":    file,
+		"table":     table,
+	}
+
+	for name, before := range values {
+		t.Run(name, func(t *testing.T) {
+			for _, s := range []*Serializer{NewEncoder(GraphFileVersion), NewTextEncoder(GraphFileVersion)} {
+				require.True(t, SThing(s.Key("value"), &before), "%v", s.Errs)
+
+				var after FlowValue
+				d := util.Tern(s.Text, NewTextDecoder, NewDecoder)(s.Bytes())
+				require.True(t, SThing(d.Key("value"), &after), "%v", d.Errs)
+				assert.Equal(t, before, after)
+			}
+		})
+	}
+}
+
+func TestFlowTypeWellKnown(t *testing.T) {
+	s := NewEncoder(GraphFileVersion)
+	require.True(t, SThing(s, FSFile))
+
+	var after FlowType
+	require.True(t, SThing(NewDecoder(s.Bytes()), &after))
+	assert.Equal(t, *FSFile, after)
+	assert.Equal(t, "File", after.String())
+	assert.Equal(t, "Timestamp", after.Fields[3].Type.String())
+}
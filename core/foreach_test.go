@@ -0,0 +1,168 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bvisness/flowshell/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForEach(t *testing.T) {
+	root := t.TempDir()
+	var dirs []string
+	for dir, files := range map[string][]string{"one": {"a.txt"}, "two": {"b.txt", "c.txt"}} {
+		dirs = append(dirs, filepath.Join(root, dir))
+		for _, file := range files {
+			require.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0777))
+			require.NoError(t, os.WriteFile(filepath.Join(root, dir, file), nil, 0666))
+		}
+	}
+	slices.Sort(dirs)
+	listPath := filepath.Join(t.TempDir(), "list.txt")
+	writeList := func(dirs ...string) {
+		require.NoError(t, os.WriteFile(listPath, []byte(strings.Join(dirs, "\n")), 0666))
+	}
+
+	// List the files in each directory named in the list.
+	forEach := NewForEachNode()
+	inner := forEach.Action.(*ForEachAction).Inner
+	inputs, _ := findNode[*SubgraphInputsAction](inner)
+	outputs, _ := findNode[*SubgraphOutputsAction](inner)
+	listFiles := NewListFilesNode(".")
+	inner.AddNode(listFiles)
+	for _, w := range []*Wire{
+		{StartNode: inputs, EndNode: listFiles},
+		{StartNode: listFiles, EndNode: outputs},
+	} {
+		_, err := inner.Connect(w.StartNode, w.StartPort, w.EndNode, w.EndPort)
+		require.NoError(t, err)
+	}
+
+	list := NewLoadFileNode(listPath)
+	lines := NewLinesNode()
+	g := newTestGraph(t, []*Node{list, lines, forEach}, []*Wire{
+		{StartNode: list, EndNode: lines},
+		{StartNode: lines, EndNode: forEach},
+	})
+	writeList(dirs...)
+	fileNames := func(res []FlowValue) [][]string {
+		var names [][]string
+		for _, table := range res[0].ListValue {
+			names = append(names, util.Map(table.ColumnValues(0), func(v FlowValue) string { return string(v.BytesValue) }))
+		}
+		return names
+	}
+	expected := [][]string{{"a.txt"}, {"b.txt", "c.txt"}}
+
+	g.Validate()
+	assert.True(t, forEach.Valid)
+	assert.Equal(t, FlowType{Kind: FSKindBytes}, inputs.OutputPorts[0].Type)
+	assert.Equal(t, NewListType(listFiles.OutputPorts[0].Type), forEach.OutputPorts[0].Type)
+
+	res, err := g.Run(t.Context(), forEach)
+	require.NoError(t, err)
+	assert.Equal(t, forEach.OutputPorts[0].Type, *res[0].Type)
+	assert.Equal(t, expected, fileNames(res))
+
+	t.Run("one at a time", func(t *testing.T) {
+		forEach.Action.(*ForEachAction).SetConcurrency(1)
+		defer forEach.Action.(*ForEachAction).SetConcurrency(DefaultForEachConcurrency)
+		list.MarkStale(g)
+
+		g.ClearTraceEvents()
+		res, err := g.Run(t.Context(), forEach)
+		require.NoError(t, err)
+		assert.Equal(t, expected, fileNames(res))
+
+		// Every item's run shows up in the trace.
+		starts := 0
+		for _, e := range g.TraceEvents() {
+			if e.Kind == TraceNodeStart && e.NodeID == listFiles.ID && e.Scope != "" {
+				assert.Equal(t, fmt.Sprintf("For Each (#%d)", forEach.ID), e.Scope)
+				starts++
+			}
+		}
+		assert.Equal(t, len(dirs), starts)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		writeList(dirs[0], filepath.Join(root, "missing"), dirs[1])
+		defer writeList(dirs...)
+		list.MarkStale(g)
+
+		_, err := g.Run(t.Context(), forEach)
+		require.ErrorContains(t, err, "item 1:")
+		require.ErrorContains(t, err, "missing")
+	})
+
+	t.Run("change while running", func(t *testing.T) {
+		defer forEach.Action.(*ForEachAction).SetConcurrency(DefaultForEachConcurrency)
+		list.MarkStale(g)
+
+		// Either setting works; the race detector checks the rest.
+		done := forEach.Run(g, false)
+		forEach.Action.(*ForEachAction).SetConcurrency(1)
+		<-done
+		state := forEach.State()
+		require.NoError(t, state.Result.Err)
+		assert.Equal(t, expected, fileNames(state.Result.Outputs))
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		buf, err := EncodeGraphText(g.File())
+		require.NoError(t, err)
+		f, err := DecodeGraph(buf)
+		require.NoError(t, err)
+		loaded := NewGraphFromFile(f)
+		assert.Equal(t, DefaultForEachConcurrency, loaded.Nodes()[2].Action.(*ForEachAction).Concurrency)
+
+		res, err := loaded.Run(t.Context(), loaded.Nodes()[2])
+		require.NoError(t, err)
+		assert.Equal(t, expected, fileNames(res))
+	})
+}
+
+func TestForEachTable(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0666))
+	}
+
+	// Rows go through unchanged, so they are collected back into the same
+	// table.
+	forEach := NewForEachNode()
+	inner := forEach.Action.(*ForEachAction).Inner
+	inputs, _ := findNode[*SubgraphInputsAction](inner)
+	outputs, _ := findNode[*SubgraphOutputsAction](inner)
+	_, err := inner.Connect(inputs, 0, outputs, 0)
+	require.NoError(t, err)
+
+	listFiles := NewListFilesNode(dir)
+	g := newTestGraph(t, []*Node{listFiles, forEach}, []*Wire{
+		{StartNode: listFiles, EndNode: forEach},
+	})
+
+	files, err := g.Run(t.Context(), listFiles)
+	require.NoError(t, err)
+	res, err := g.Run(t.Context(), forEach)
+	require.NoError(t, err)
+	assert.Equal(t, files, res)
+	assert.Equal(t, listFiles.OutputPorts[0].Type, forEach.OutputPorts[0].Type)
+
+	t.Run("empty", func(t *testing.T) {
+		listFiles.Action.(*ListFilesAction).Dir = t.TempDir()
+		listFiles.MarkStale(g)
+
+		res, err := g.Run(t.Context(), forEach)
+		require.NoError(t, err)
+		require.Len(t, res, 1)
+		assert.Equal(t, forEach.OutputPorts[0].Type, *res[0].Type)
+		assert.Empty(t, res[0].TableValue)
+	})
+}
@@ -1,3 +1,3 @@
 //go:generate go run ./cmd/gen_node_actions.go
 
-package app
+package core
@@ -0,0 +1,300 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// A graph of nodes connected by wires. Wires are indexed by the nodes at both
+// ends, so finding a node's inputs and outputs doesn't require scanning every
+// wire in the graph.
+//
+// A graph may be read from any goroutine (actions read their inputs while
+// running), but should only be modified from one goroutine at a time.
+type Graph struct {
+	mu sync.RWMutex
+
+	// These slices are replaced rather than modified in place, so slices
+	// returned from Nodes and Wires stay valid.
+	nodes []*Node
+	wires []*Wire
+
+	byID    map[int]*Node
+	inputs  map[*Node][]*Wire // Wires into each node
+	outputs map[*Node][]*Wire // Wires out of each node
+
+	nodeID     int // The last node ID handed out
+	selectedID int
+
+	// Recent runs, oldest first. Guarded by schedulerMu, since runs finish on
+	// the scheduler's goroutines.
+	runs        []*RunRecord
+	runID       int // The last run ID handed out
+	traceMu     sync.Mutex
+	traceEvents []TraceEvent
+	traceParent *Graph // Where events go instead, for subgraphs
+	traceScope  string
+}
+
+func NewGraph() *Graph {
+	return &Graph{
+		byID:    make(map[int]*Node),
+		inputs:  make(map[*Node][]*Wire),
+		outputs: make(map[*Node][]*Wire),
+	}
+}
+
+// Builds a graph from a file. The file's wires are kept even if their types no
+// longer match; validation will flag the affected nodes.
+func NewGraphFromFile(f *GraphFile) *Graph {
+	g := NewGraph()
+	g.nodeID = f.NodeID
+	for _, n := range f.Nodes {
+		g.AddNode(n)
+	}
+	for _, wire := range f.Wires {
+		g.addWire(wire)
+	}
+	return g
+}
+
+// Makes a copy of the graph's nodes and wires, without any results, by saving
+// and loading it.
+func CloneGraph(g *Graph) (*Graph, error) {
+	buf, err := EncodeGraph(g.File())
+	if err != nil {
+		return nil, err
+	}
+	f, err := DecodeGraph(buf)
+	if err != nil {
+		return nil, err
+	}
+	return NewGraphFromFile(f), nil
+}
+
+// Captures the graph for saving. The caller fills in any view state, like
+// the pan.
+func (g *Graph) File() *GraphFile {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return &GraphFile{
+		Nodes:  g.nodes,
+		Wires:  g.wires,
+		NodeID: g.nodeID,
+	}
+}
+
+// All the nodes in the graph, in the order they were added. The returned
+// slice must not be modified.
+func (g *Graph) Nodes() []*Node {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.nodes
+}
+
+// All the wires in the graph. The returned slice must not be modified.
+func (g *Graph) Wires() []*Wire {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.wires
+}
+
+func (g *Graph) Node(id int) (*Node, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	n, ok := g.byID[id]
+	return n, ok
+}
+
+// Adds a node to the graph, giving it a new ID unless it already has one.
+func (g *Graph) AddNode(n *Node) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.addNode(n)
+}
+
+func (g *Graph) addNode(n *Node) {
+	if n.ID == 0 {
+		g.nodeID++
+		n.ID = g.nodeID
+	}
+	// Don't hand out IDs that are already taken, even if a file lies.
+	g.nodeID = max(g.nodeID, n.ID)
+
+	g.nodes = append(slices.Clip(g.nodes), n)
+	g.byID[n.ID] = n
+}
+
+// Removes a node from the graph, along with every wire into or out of it.
+func (g *Graph) RemoveNode(n *Node) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.removeNode(n)
+}
+
+func (g *Graph) removeNode(n *Node) {
+	if g.byID[n.ID] != n {
+		return
+	}
+	for _, wire := range slices.Concat(g.inputs[n], g.outputs[n]) {
+		g.removeWire(wire)
+	}
+	g.nodes = slices.DeleteFunc(slices.Clone(g.nodes), func(other *Node) bool { return other == n })
+	delete(g.byID, n.ID)
+	delete(g.inputs, n)
+	delete(g.outputs, n)
+	if g.selectedID == n.ID {
+		g.selectedID = 0
+	}
+}
+
+// Wires an output port of one node to an input port of another, replacing any
+// wire already going into that input. Refuses wires that would form a cycle
+// or whose types don't match.
+func (g *Graph) Connect(start *Node, startPort int, end *Node, endPort int) (*Wire, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.byID[start.ID] != start || g.byID[end.ID] != end {
+		return nil, fmt.Errorf("cannot wire nodes from outside the graph")
+	}
+	if startPort < 0 || startPort >= len(start.OutputPorts) {
+		return nil, fmt.Errorf("%s has no output port %d", start, startPort)
+	}
+	if endPort < 0 || endPort >= len(end.InputPorts) {
+		return nil, fmt.Errorf("%s has no input port %d", end, endPort)
+	}
+	if g.wouldCreateCycle(start, end) {
+		return nil, fmt.Errorf("cannot wire %s to %s: the graph would contain a cycle", start, end)
+	}
+	if err := CheckWireType(end, endPort, start.OutputPorts[startPort].Type); err != nil {
+		return nil, fmt.Errorf("cannot wire %s to %s: %v", start, end, err)
+	}
+
+	if existing, ok := g.inputWire(end, endPort); ok {
+		g.removeWire(existing)
+	}
+	wire := &Wire{
+		StartNode: start, StartPort: startPort,
+		EndNode: end, EndPort: endPort,
+	}
+	g.addWire(wire)
+	return wire, nil
+}
+
+func (g *Graph) Disconnect(wire *Wire) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.removeWire(wire)
+}
+
+func (g *Graph) addWire(wire *Wire) {
+	g.wires = append(slices.Clip(g.wires), wire)
+	g.inputs[wire.EndNode] = append(slices.Clip(g.inputs[wire.EndNode]), wire)
+	g.outputs[wire.StartNode] = append(slices.Clip(g.outputs[wire.StartNode]), wire)
+}
+
+func (g *Graph) removeWire(wire *Wire) {
+	isWire := func(w *Wire) bool { return w == wire }
+	g.wires = slices.DeleteFunc(slices.Clone(g.wires), isWire)
+	g.inputs[wire.EndNode] = slices.DeleteFunc(slices.Clone(g.inputs[wire.EndNode]), isWire)
+	g.outputs[wire.StartNode] = slices.DeleteFunc(slices.Clone(g.outputs[wire.StartNode]), isWire)
+}
+
+// The wire going into the given input port of a node, if any.
+func (g *Graph) InputWire(n *Node, port int) (*Wire, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.inputWire(n, port)
+}
+
+func (g *Graph) inputWire(n *Node, port int) (*Wire, bool) {
+	for _, wire := range g.inputs[n] {
+		if wire.EndPort == port {
+			return wire, true
+		}
+	}
+	return nil, false
+}
+
+// The nodes wired into the given node, without duplicates.
+func (g *Graph) Inputs(n *Node) []*Node {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	var res []*Node
+	for _, wire := range g.inputs[n] {
+		if !slices.Contains(res, wire.StartNode) {
+			res = append(res, wire.StartNode)
+		}
+	}
+	return res
+}
+
+// The nodes the given node is wired into, without duplicates.
+func (g *Graph) Outputs(n *Node) []*Node {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	var res []*Node
+	for _, wire := range g.outputs[n] {
+		if !slices.Contains(res, wire.EndNode) {
+			res = append(res, wire.EndNode)
+		}
+	}
+	return res
+}
+
+func (g *Graph) Selected() (*Node, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	n, ok := g.byID[g.selectedID]
+	return n, ok
+}
+
+// Selects the given node, or nothing if n is nil.
+func (g *Graph) Select(n *Node) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.selectedID = 0
+	if n != nil {
+		g.selectedID = n.ID
+	}
+}
+
+func (g *Graph) IsSelected(n *Node) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return n.ID != 0 && n.ID == g.selectedID
+}
+
+// Actions whose input types depend on what is wired into them implement this
+// to decide which wires to accept. By default, an input port accepts values
+// that typecheck against the port's type.
+type InputTypeChecker interface {
+	CheckInputType(n *Node, port int, t FlowType) error
+}
+
+// Checks whether an output of the given type may be wired into the node's
+// input port.
+func CheckWireType(n *Node, port int, t FlowType) error {
+	if checker, ok := n.Action.(InputTypeChecker); ok {
+		return checker.CheckInputType(n, port, t)
+	}
+	return checkWireType(t, n.InputPorts[port].Type)
+}
+
+// Like Typecheck, but an output of type Any matches any input, since its
+// actual type is only known once it runs. The value is still checked then.
+func checkWireType(out, in FlowType) error {
+	if out.Kind == FSKindAny {
+		return nil
+	}
+	if out.Kind == in.Kind && (out.Kind == FSKindList || out.Kind == FSKindTable) &&
+		out.ContainedType != nil && in.ContainedType != nil {
+		if err := checkWireType(*out.ContainedType, *in.ContainedType); err != nil {
+			return fmt.Errorf("expected type %s, but got %s: %v", in.String(), out.String(), err)
+		}
+		return nil
+	}
+	return Typecheck(out, in)
+}
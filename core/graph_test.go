@@ -0,0 +1,107 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraph(t *testing.T) {
+	g := NewGraph()
+	a := newCountingNode("a", 0)
+	b := newCountingNode("b", 2)
+	c := newCountingNode("c", 1)
+	for _, n := range []*Node{a, b, c} {
+		g.AddNode(n)
+	}
+	assert.Equal(t, []int{1, 2, 3}, []int{a.ID, b.ID, c.ID})
+
+	// Graphs hand out their own IDs.
+	other := NewGraph()
+	otherNode := newCountingNode("other", 0)
+	other.AddNode(otherNode)
+	assert.Equal(t, 1, otherNode.ID)
+	_, err := g.Connect(otherNode, 0, b, 0)
+	assert.Error(t, err, "nodes from other graphs can't be wired in")
+
+	ab0, err := g.Connect(a, 0, b, 0)
+	require.NoError(t, err)
+	_, err = g.Connect(a, 0, b, 1)
+	require.NoError(t, err)
+	bc, err := g.Connect(b, 0, c, 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, []*Node{a}, g.Inputs(b), "inputs are not duplicated")
+	assert.Equal(t, []*Node{b}, g.Outputs(a))
+	wire, ok := g.InputWire(b, 0)
+	assert.True(t, ok)
+	assert.Same(t, ab0, wire)
+
+	t.Run("replace", func(t *testing.T) {
+		// Wiring into a port that is already wired replaces the old wire.
+		cb, err := g.Connect(a, 0, c, 0)
+		require.NoError(t, err)
+		assert.NotContains(t, g.Wires(), bc)
+		assert.Empty(t, g.Outputs(b))
+
+		g.Disconnect(cb)
+		_, err = g.Connect(b, 0, c, 0)
+		require.NoError(t, err)
+	})
+
+	t.Run("refused", func(t *testing.T) {
+		before := g.Wires()
+
+		_, err := g.Connect(c, 0, b, 0)
+		assert.ErrorContains(t, err, "cycle")
+		_, err = g.Connect(a, 1, b, 0)
+		assert.ErrorContains(t, err, "no output port 1")
+
+		d := NewLinesNode()
+		g.AddNode(d)
+		_, err = g.Connect(a, 0, d, 0)
+		assert.ErrorContains(t, err, "expected type Bytes, but got Int64")
+
+		assert.Equal(t, before, g.Wires())
+		g.RemoveNode(d)
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		g.Select(b)
+		g.RemoveNode(b)
+		assert.Equal(t, []*Node{a, c}, g.Nodes())
+		assert.Empty(t, g.Wires())
+		assert.Empty(t, g.Outputs(a))
+		assert.Empty(t, g.Inputs(c))
+		_, ok := g.Selected()
+		assert.False(t, ok)
+
+		// IDs are not reused.
+		e := newCountingNode("e", 0)
+		g.AddNode(e)
+		assert.Equal(t, 5, e.ID)
+	})
+}
+
+func TestConnectPolymorphic(t *testing.T) {
+	g := NewGraph()
+	process := NewRunProcessNode("echo hi")
+	lines := NewLinesNode()
+	trim := NewTrimSpacesNode()
+	trimText := NewTrimSpacesNode()
+	load := NewLoadFileNode("in.json")
+	load.Action.(*LoadFileAction).Format.SelectByValue("json")
+	for _, n := range []*Node{process, lines, trim, trimText, load} {
+		g.AddNode(n)
+	}
+	g.Validate()
+
+	// Trim Spaces takes text or lists of text.
+	_, err := g.Connect(lines, 0, trim, 0)
+	assert.NoError(t, err)
+	_, err = g.Connect(process, 0, trimText, 0)
+	assert.NoError(t, err)
+	_, err = g.Connect(load, 0, lines, 0)
+	assert.NoError(t, err, "Any outputs are checked when they run")
+}
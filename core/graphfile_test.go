@@ -0,0 +1,281 @@
+package core
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateFixtures = flag.Bool("update", false, "write a graph fixture for the current file format version")
+
+// A graph using every kind of node, for checking that old files still load.
+// Only ever add nodes to the end of this graph, so that fixtures from older
+// versions remain a prefix of it.
+func fixtureGraph() *GraphFile {
+	runProcess := NewRunProcessNode("echo hello")
+	lines := NewLinesNode()
+	trim := NewTrimSpacesNode()
+	loadFile := NewLoadFileNode("corpus/flute1.csv")
+	concat := NewConcatTablesNode()
+	concat.InputPorts = append(concat.InputPorts, NodePort{Name: "Table 2", Type: NewAnyTableType()})
+	mean := NewAggregateNode("Mean")
+	saveFile := NewSaveFileNode("out.csv")
+	saveFile.Action.(*SaveFileAction).Format.SelectByValue("csv")
+	uncached := NewRunProcessNode("date")
+	uncached.NoCache = true
+	listFiles := NewListFilesNode("corpus")
+	retried := NewRunProcessNode("curl -f https://example.com")
+	retried.Policy = RunPolicy{Timeout: 30 * time.Second, MaxAttempts: 3, Backoff: time.Second}
+
+	g := &GraphFile{
+		Nodes: []*Node{runProcess, lines, trim, loadFile, concat, mean, saveFile, uncached, listFiles, retried},
+		Wires: []*Wire{
+			{StartNode: runProcess, StartPort: 0, EndNode: lines, EndPort: 0},
+			{StartNode: lines, StartPort: 0, EndNode: trim, EndPort: 0},
+			{StartNode: loadFile, StartPort: 0, EndNode: concat, EndPort: 0},
+			{StartNode: loadFile, StartPort: 0, EndNode: concat, EndPort: 1},
+			{StartNode: concat, StartPort: 0, EndNode: mean, EndPort: 0},
+			{StartNode: mean, StartPort: 0, EndNode: saveFile, EndPort: 1},
+		},
+		Pan: V2{X: 12, Y: 34},
+	}
+	for i, n := range g.Nodes {
+		n.ID = i + 1
+		n.Pos = V2{X: float32(i * 100), Y: float32(i * 50)}
+	}
+	g.NodeID = len(g.Nodes)
+
+	// Bring port types up to date, as they would be in a graph saved from the UI.
+	validateGraphFile(g)
+
+	return g
+}
+
+func validateGraphFile(f *GraphFile) {
+	NewGraphFromFile(f).Validate()
+}
+
+func TestGraphFileRoundTrip(t *testing.T) {
+	text := NewRunProcessNode("echo hi")
+	lines := NewLinesNode()
+	before := newTestGraph(t, []*Node{text, lines}, []*Wire{{StartNode: text, StartPort: 0, EndNode: lines, EndPort: 0}}).File()
+	before.NodeID = 42
+	before.Pan = V2{X: 10, Y: -5}
+
+	buf, err := EncodeGraph(before)
+	require.NoError(t, err)
+	after, err := DecodeGraph(buf)
+	require.NoError(t, err)
+
+	assert.Equal(t, before, after)
+}
+
+func TestGraphFileTextRoundTrip(t *testing.T) {
+	before := fixtureGraph()
+
+	buf, err := EncodeGraphText(before)
+	require.NoError(t, err)
+	require.True(t, json.Valid(buf), "%s", buf)
+	after, err := DecodeGraph(buf)
+	require.NoError(t, err)
+	validateGraphFile(after)
+	assert.Equal(t, before, after)
+
+	t.Run("stable", func(t *testing.T) {
+		again, err := EncodeGraphText(after)
+		require.NoError(t, err)
+		assert.Equal(t, string(buf), string(again))
+	})
+
+	t.Run("reordered keys", func(t *testing.T) {
+		// Anyone editing the file by hand gets to put fields in whatever order
+		// they like.
+		var generic map[string]any
+		require.NoError(t, json.Unmarshal(buf, &generic))
+		shuffled, err := json.Marshal(generic) // sorts keys alphabetically
+		require.NoError(t, err)
+		require.NotEqual(t, string(buf), string(shuffled))
+
+		g, err := DecodeGraph(shuffled)
+		require.NoError(t, err)
+		validateGraphFile(g)
+		assert.Equal(t, before, g)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := DecodeGraph([]byte(`{"version": 2, "nodes": [{"id": 1}]}`))
+		assert.ErrorContains(t, err, "nodes[0].pos: missing field")
+
+		_, err = DecodeGraph([]byte(`{"version": 2, "nodes": {}`))
+		assert.ErrorContains(t, err, "invalid JSON")
+	})
+}
+
+func TestGraphFileFixtures(t *testing.T) {
+	if *updateFixtures {
+		for _, path := range fixturePaths(GraphFileVersion) {
+			require.NoError(t, WriteGraphFile(path, fixtureGraph()))
+			t.Logf("wrote %s", path)
+		}
+	}
+
+	expected := fixtureGraph()
+	for version := 1; version <= GraphFileVersion; version++ {
+		for _, path := range fixturePaths(version) {
+			t.Run(filepath.Base(path), func(t *testing.T) {
+				checkFixture(t, path, expected)
+			})
+		}
+	}
+}
+
+// The text format was added in version 2, so older versions only have a
+// binary fixture.
+func fixturePaths(version int) []string {
+	path := filepath.Join("testdata", fmt.Sprintf("graph_v%d.flow", version))
+	if version < 2 {
+		return []string{path}
+	}
+	return []string{path, path + ".json"}
+}
+
+func checkFixture(t *testing.T, path string, expected *GraphFile) {
+	buf, err := os.ReadFile(path)
+	require.NoError(t, err, "every version of the file format needs a fixture; run the tests with -update to create one")
+
+	g, err := DecodeGraph(buf)
+	require.NoError(t, err)
+	validateGraphFile(g)
+
+	require.NotEmpty(t, g.Nodes)
+	require.LessOrEqual(t, len(g.Nodes), len(expected.Nodes))
+	for i, n := range g.Nodes {
+		assert.Equal(t, expected.Nodes[i], n)
+	}
+	for _, wire := range g.Wires {
+		assert.Contains(t, expected.Wires, &Wire{
+			StartNode: expected.Nodes[wire.StartNode.ID-1], StartPort: wire.StartPort,
+			EndNode: expected.Nodes[wire.EndNode.ID-1], EndPort: wire.EndPort,
+		})
+	}
+	assert.Equal(t, expected.Pan, g.Pan)
+	assert.GreaterOrEqual(t, g.NodeID, len(g.Nodes))
+}
+
+// An action this build doesn't know about, as if from a plugin or a newer
+// version of Flowshell.
+type pluginAction struct {
+	countingAction
+	Setting string
+	Count   int
+}
+
+func (a *pluginAction) Tag() string { return "PluginAction" }
+func (a *pluginAction) Serialize(s *Serializer) bool {
+	SStr(s.Key("setting"), &a.Setting)
+	SInt(s.Key("count"), &a.Count)
+	return s.Ok()
+}
+
+func TestUnknownNodeType(t *testing.T) {
+	plugin := newCountingNode("Plugin", 1)
+	plugin.Action = &pluginAction{Setting: "hello", Count: 3}
+	source := newCountingNode("Source", 0)
+	sink := newCountingNode("Sink", 1)
+	g := &GraphFile{
+		Nodes: []*Node{source, plugin, sink},
+		Wires: []*Wire{
+			{StartNode: source, StartPort: 0, EndNode: plugin, EndPort: 0},
+			{StartNode: plugin, StartPort: 0, EndNode: sink, EndPort: 0},
+		},
+	}
+
+	for _, format := range []struct {
+		name   string
+		encode func(g *GraphFile) ([]byte, error)
+	}{
+		{"binary", EncodeGraph},
+		{"text", EncodeGraphText},
+	} {
+		t.Run(format.name, func(t *testing.T) {
+			before, err := format.encode(g)
+			require.NoError(t, err)
+
+			decoded, err := DecodeGraph(before)
+			require.NoError(t, err)
+			require.Len(t, decoded.Nodes, 3)
+			unknown := decoded.Nodes[1]
+			require.IsType(t, &UnknownAction{}, unknown.Action)
+			assert.Equal(t, "PluginAction", unknown.Action.Tag())
+			assert.Equal(t, plugin.InputPorts, unknown.InputPorts)
+			assert.Equal(t, plugin.OutputPorts, unknown.OutputPorts)
+			assert.Len(t, decoded.Wires, 2)
+
+			after, err := format.encode(decoded)
+			require.NoError(t, err)
+			assert.Equal(t, before, after, "unknown nodes should be saved exactly as they were loaded")
+
+			validateGraphFile(decoded)
+			assert.False(t, unknown.Valid)
+			res := <-unknown.Action.Run(t.Context(), NewGraphFromFile(decoded), unknown)
+			assert.ErrorContains(t, res.Err, "unknown node type \"PluginAction\"")
+		})
+	}
+
+	t.Run("cannot convert", func(t *testing.T) {
+		buf, err := EncodeGraph(g)
+		require.NoError(t, err)
+		decoded, err := DecodeGraph(buf)
+		require.NoError(t, err)
+		_, err = EncodeGraphText(decoded)
+		assert.ErrorContains(t, err, "cannot convert")
+	})
+
+	t.Run("old binary version", func(t *testing.T) {
+		s := NewEncoder(2)
+		require.True(t, g.Serialize(s))
+		_, err := DecodeGraph(s.Bytes())
+		assert.ErrorContains(t, err, "unknown node type")
+	})
+}
+
+func TestMigrations(t *testing.T) {
+	for i, m := range migrations {
+		assert.Equal(t, i+2, m.Version, "migrations should be listed in order, one per version")
+	}
+	assert.Equal(t, GraphFileVersion, migrations[len(migrations)-1].Version, "every version bump needs a migration entry")
+
+	t.Run("applied in order", func(t *testing.T) {
+		oldMigrations := migrations
+		t.Cleanup(func() { migrations = oldMigrations })
+
+		var applied []int
+		migrations = nil
+		for v := 2; v <= 4; v++ {
+			migrations = append(migrations, Migration{
+				Version: v,
+				Upgrade: func(g *GraphFile) error {
+					applied = append(applied, v)
+					return nil
+				},
+			})
+		}
+
+		require.NoError(t, migrateGraph(&GraphFile{}, 2))
+		assert.Equal(t, []int{3, 4}, applied)
+	})
+}
+
+func TestDecodeNewerVersion(t *testing.T) {
+	s := NewEncoder(GraphFileVersion + 1)
+	SThing(s, &GraphFile{})
+	_, err := DecodeGraph(s.Bytes())
+	assert.ErrorContains(t, err, "newer version")
+}
@@ -0,0 +1,233 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"time"
+
+	"github.com/bvisness/flowshell/util"
+)
+
+// RunHeadless implements `flowshell run`, which loads a saved graph and runs
+// it to completion without opening a window. It returns the process's exit
+// code.
+func RunHeadless(args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return runHeadless(ctx, args)
+}
+
+// Like RunHeadless, but stops running (and watching) when ctx is canceled.
+func runHeadless(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	cacheDir := flags.String("cache-dir", DefaultCacheDir(), "directory for cached node results")
+	noCache := flags.Bool("no-cache", false, "run every node instead of reusing cached results")
+	watch := flags.Bool("watch", false, "keep running, and re-run nodes when the files they read change")
+	verbose := flags.Bool("v", false, "log debug messages, such as when each node is scheduled and run")
+	tracePath := flags.String("trace", "", "write a trace of the run to this file, for viewing in Perfetto (https://ui.perfetto.dev)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: flowshell run [flags] <graph file>\n\n")
+		fmt.Fprintf(flags.Output(), "Runs every sink node in the graph (every node whose outputs are not wired\n")
+		fmt.Fprintf(flags.Output(), "anywhere), along with everything upstream of them. Exits with status 1 if\n")
+		fmt.Fprintf(flags.Output(), "any node fails.\n\n")
+		fmt.Fprintf(flags.Output(), "With -watch, keeps running until interrupted, re-running the affected\n")
+		fmt.Fprintf(flags.Output(), "nodes whenever a file read by Load File or List Files changes. The exit\n")
+		fmt.Fprintf(flags.Output(), "status then reflects the last run before the interrupt.\n\n")
+		fmt.Fprintf(flags.Output(), "With -trace, writes a Chrome trace of when each node waited, ran, and\n")
+		fmt.Fprintf(flags.Output(), "started processes once the run finishes (or, with -watch, when interrupted).\n\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	if *verbose {
+		LogLevel.Set(slog.LevelDebug)
+	}
+
+	f, err := ReadGraphFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	g := NewGraphFromFile(f)
+	ResultCache = OpenCache(util.Tern(*noCache, "", *cacheDir))
+
+	var watcher Watcher
+	if *watch {
+		watcher.Check(g) // before running, so that changes during the run are noticed
+	}
+
+	errs := RunGraph(ctx, g)
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	}
+	if *watch {
+		errs = watchHeadless(ctx, g, &watcher, errs)
+	}
+	if *tracePath != "" {
+		if err := WriteChromeTraceFile(*tracePath, g.TraceEvents()); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write trace: %v\n", err)
+			return 1
+		}
+	}
+	if len(errs) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// Re-runs nodes as their files change, until ctx is canceled. Returns the
+// errors from the last run, which is the initial run (with errs) if nothing
+// changed.
+func watchHeadless(ctx context.Context, g *Graph, watcher *Watcher, errs []error) []error {
+	fmt.Fprintf(os.Stderr, "Watching for changes...\n")
+	ticker := time.NewTicker(WatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return errs
+		}
+
+		changed := watcher.Check(g)
+		if len(changed) == 0 {
+			continue
+		}
+		for _, n := range changed {
+			fmt.Fprintf(os.Stderr, "Files changed for %s (#%d), re-running\n", n.Name, n.ID)
+		}
+		affected, dones := RerunAffected(g, changed)
+		waitOrStop(ctx, g, dones, affected)
+		errs = nodeErrors(affected)
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		}
+	}
+}
+
+// An error attributed to a specific node.
+type NodeError struct {
+	Node *Node
+	Err  error
+}
+
+func (e NodeError) Error() string {
+	return fmt.Sprintf("%s (#%d): %v", e.Node.Name, e.Node.ID, e.Err)
+}
+
+func (e NodeError) Unwrap() error {
+	return e.Err
+}
+
+// RunGraph validates the graph and runs all of its sink nodes to completion,
+// stopping everything if ctx is canceled. It returns the errors from every
+// node that failed, in topological order.
+func RunGraph(ctx context.Context, g *Graph) []error {
+	g.Validate()
+
+	sorted, err := g.Toposort(g.Nodes())
+	if err != nil {
+		return []error{err}
+	}
+
+	// Refuse to run anything if the graph is incomplete; actions assume that
+	// validation has passed.
+	var errs []error
+	for _, n := range sorted {
+		if !n.Valid {
+			errs = append(errs, NodeError{Node: n, Err: fmt.Errorf("node is not fully configured (are all of its inputs wired?)")})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	var dones []<-chan struct{}
+	for _, n := range sorted {
+		if len(g.Outputs(n)) == 0 {
+			dones = append(dones, n.Run(g, false))
+		}
+	}
+
+	waitOrStop(ctx, g, dones, sorted)
+	return nodeErrors(sorted)
+}
+
+// Run validates the graph and runs the node, along with anything upstream of
+// it that needs to run, and waits for the results. If ctx is canceled first,
+// the runs are stopped. The returned error joins the errors of every node that
+// failed.
+func (g *Graph) Run(ctx context.Context, n *Node) ([]FlowValue, error) {
+	g.Validate()
+
+	upstream := []*Node{n}
+	for i := 0; i < len(upstream); i++ {
+		for _, input := range g.Inputs(upstream[i]) {
+			if !slices.Contains(upstream, input) {
+				upstream = append(upstream, input)
+			}
+		}
+	}
+	sorted, err := g.Toposort(upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, n := range sorted {
+		if !n.Valid {
+			errs = append(errs, NodeError{Node: n, Err: fmt.Errorf("node is not fully configured (are all of its inputs wired?)")})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	waitOrStop(ctx, g, []<-chan struct{}{n.Run(g, false)}, sorted)
+	if errs := nodeErrors(sorted); len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return n.State().Result.Outputs, nil
+}
+
+// Waits for all the runs to finish, stopping the given nodes if ctx is
+// canceled first.
+func waitOrStop(ctx context.Context, g *Graph, dones []<-chan struct{}, ns []*Node) {
+	allDone := make(chan struct{})
+	go func() {
+		for _, done := range dones {
+			<-done
+		}
+		close(allDone)
+	}()
+	select {
+	case <-allDone:
+	case <-ctx.Done():
+		for _, n := range ns {
+			n.Stop(g)
+		}
+		<-allDone
+	}
+}
+
+func nodeErrors(ns []*Node) []error {
+	var errs []error
+	for _, n := range ns {
+		if state := n.State(); state.ResultAvailable && state.Result.Err != nil {
+			errs = append(errs, NodeError{Node: n, Err: state.Result.Err})
+		}
+	}
+	return errs
+}
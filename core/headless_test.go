@@ -0,0 +1,93 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Builds Load File -> Trim Spaces -> Save File and saves it to a graph file.
+func writeTrimGraph(t *testing.T, inPath, outPath string) string {
+	load := NewLoadFileNode(inPath)
+	trim := NewTrimSpacesNode()
+	save := NewSaveFileNode(outPath)
+
+	g := newTestGraph(t, []*Node{load, trim, save}, []*Wire{
+		{StartNode: load, StartPort: 0, EndNode: trim, EndPort: 0},
+		{StartNode: trim, StartPort: 0, EndNode: save, EndPort: 1},
+	})
+
+	graphPath := filepath.Join(t.TempDir(), "trim.flow")
+	require.NoError(t, WriteGraphFile(graphPath, g.File()))
+	return graphPath
+}
+
+func TestRunHeadless(t *testing.T) {
+	dir := t.TempDir()
+	inPath := filepath.Join(dir, "in.txt")
+	outPath := filepath.Join(dir, "out.txt")
+	require.NoError(t, os.WriteFile(inPath, []byte("  hello  \n"), 0666))
+
+	assert.Equal(t, 0, RunHeadless([]string{"-no-cache", writeTrimGraph(t, inPath, outPath)}))
+
+	out, err := os.ReadFile(outPath)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(out))
+
+	t.Run("failure", func(t *testing.T) {
+		graphPath := writeTrimGraph(t, filepath.Join(dir, "missing.txt"), outPath)
+		assert.Equal(t, 1, RunHeadless([]string{"-no-cache", graphPath}))
+
+		f, err := ReadGraphFile(graphPath)
+		require.NoError(t, err)
+		errs := RunGraph(t.Context(), NewGraphFromFile(f))
+		require.Len(t, errs, 1)
+		assert.ErrorIs(t, errs[0], os.ErrNotExist)
+		assert.Contains(t, errs[0].Error(), "Load File")
+	})
+}
+
+func TestGraphRun(t *testing.T) {
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "in.csv")
+	require.NoError(t, os.WriteFile(csvPath, []byte("a,b\n1,10\n3,20\n"), 0666))
+
+	load := NewLoadFileNode(csvPath)
+	load.Action.(*LoadFileAction).Format.SelectByValue("csv")
+	mean := NewAggregateNode("Mean")
+	g := newTestGraph(t, []*Node{load, mean}, []*Wire{
+		{StartNode: load, StartPort: 0, EndNode: mean, EndPort: 0},
+	})
+
+	outputs, err := g.Run(t.Context(), mean)
+	require.NoError(t, err)
+	require.Len(t, outputs, 1)
+	assert.Equal(t, []FlowValue{NewFloat64Value(2, 0)}, outputs[0].ColumnValues(0))
+	assert.Equal(t, []FlowValue{NewFloat64Value(15, 0)}, outputs[0].ColumnValues(1))
+
+	t.Run("failure", func(t *testing.T) {
+		missingPath := filepath.Join(dir, "missing.csv")
+		load.Action.(*LoadFileAction).Path = missingPath
+		load.MarkChanged(g)
+
+		_, err := g.Run(t.Context(), mean)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		assert.Contains(t, err.Error(), "Load File")
+
+		// The failed node runs again rather than reporting the same error.
+		require.NoError(t, os.WriteFile(missingPath, []byte("a\n4\n"), 0666))
+		outputs, err := g.Run(t.Context(), mean)
+		require.NoError(t, err)
+		assert.Equal(t, []FlowValue{NewFloat64Value(4, 0)}, outputs[0].ColumnValues(0))
+	})
+
+	t.Run("unwired", func(t *testing.T) {
+		unwired := NewAggregateNode("Min")
+		g.AddNode(unwired)
+		_, err := g.Run(t.Context(), unwired)
+		assert.ErrorContains(t, err, "not fully configured")
+	})
+}
@@ -0,0 +1,216 @@
+package core
+
+import (
+	"slices"
+	"time"
+)
+
+// How many runs each graph remembers.
+const MaxRunHistory = 100
+
+// How many of each node's recent results keep their output values. Outputs can
+// be large, so older entries only keep their status and timing.
+const MaxRunOutputs = 2
+
+type NodeRunStatus int
+
+const (
+	NodeRunPending  NodeRunStatus = iota // Waiting on inputs, or running
+	NodeRunExecuted                      // The action ran
+	NodeRunCached                        // The result came from the result cache
+	NodeRunReused                        // The node's existing result was up to date, so it didn't run
+	NodeRunSkipped                       // An input failed or the run was stopped before the action started
+)
+
+func (s NodeRunStatus) String() string {
+	switch s {
+	case NodeRunPending:
+		return "Pending"
+	case NodeRunExecuted:
+		return "Executed"
+	case NodeRunCached:
+		return "Cached"
+	case NodeRunReused:
+		return "Reused"
+	case NodeRunSkipped:
+		return "Skipped"
+	default:
+		return "<UNKNOWN STATUS>"
+	}
+}
+
+// A record of one call to Node.Run: when it happened, and what happened to
+// each node it needed.
+type RunRecord struct {
+	ID     int
+	Target *Node // The node that was run
+	Start  time.Time
+	End    time.Time // Zero until every node in the run has finished
+
+	// The nodes involved in the run, in the order they were scheduled. Inputs
+	// whose results were reused are included, but nothing upstream of them.
+	Nodes []NodeRunRecord
+
+	graph *Graph
+}
+
+func (r *RunRecord) Done() bool {
+	return !r.End.IsZero()
+}
+
+// How long the run took, or has taken so far.
+func (r *RunRecord) Duration() time.Duration {
+	if !r.Done() {
+		return time.Since(r.Start)
+	}
+	return r.End.Sub(r.Start)
+}
+
+// Finds the record for a node, if it was part of the run.
+func (r *RunRecord) Node(n *Node) (NodeRunRecord, bool) {
+	for _, nr := range r.Nodes {
+		if nr.Node == n {
+			return nr, true
+		}
+	}
+	return NodeRunRecord{}, false
+}
+
+// What happened to a node during a run. If the node was already running when
+// the run started, the run waits on it, and records that run's result.
+type NodeRunRecord struct {
+	RunID  int
+	Node   *Node
+	Status NodeRunStatus
+
+	// When the action started and finished (or when the result was looked up
+	// in the cache). Zero if the node didn't run.
+	Start, End time.Time
+
+	Err     error
+	Outputs []FlowValue // Values are never modified once produced, so these are shared, not copied
+
+	// Whether Outputs were dropped because the node has produced MaxRunOutputs
+	// newer results since.
+	OutputsDiscarded bool
+}
+
+// How long the node's action took, or has taken so far.
+func (r *NodeRunRecord) Duration() time.Duration {
+	switch {
+	case r.Start.IsZero():
+		return 0
+	case r.End.IsZero():
+		return time.Since(r.Start)
+	default:
+		return r.End.Sub(r.Start)
+	}
+}
+
+// Points at a node's entry in a run that is waiting on it.
+type runRecordRef struct {
+	run *RunRecord
+	i   int
+}
+
+// Returns copies of the graph's recent runs, oldest first.
+func (g *Graph) History() []RunRecord {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+
+	res := make([]RunRecord, len(g.runs))
+	for i, run := range g.runs {
+		res[i] = *run
+		res[i].Nodes = slices.Clone(run.Nodes)
+	}
+	return res
+}
+
+// Returns the node's entries in the graph's recent runs, most recent first.
+// Comparing the first two shows how the latest run differed from the one
+// before.
+func (g *Graph) NodeHistory(n *Node) []NodeRunRecord {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+
+	var res []NodeRunRecord
+	for i := len(g.runs) - 1; i >= 0; i-- {
+		for _, nr := range g.runs[i].Nodes {
+			if nr.Node == n {
+				res = append(res, nr)
+			}
+		}
+	}
+	return res
+}
+
+// Starts recording a new run. Must be called with schedulerMu held.
+func (g *Graph) newRunRecord(target *Node) *RunRecord {
+	g.runID++
+	run := &RunRecord{ID: g.runID, Target: target, Start: time.Now(), graph: g}
+	g.runs = append(g.runs, run)
+	if len(g.runs) > MaxRunHistory {
+		g.runs = slices.Delete(g.runs, 0, len(g.runs)-MaxRunHistory)
+	}
+	return run
+}
+
+// Adds a node to the run. Nodes that are pending are finished later by
+// finishNode; otherwise, the node's current result is recorded. Must be called
+// with schedulerMu held.
+func (r *RunRecord) addNode(n *Node, status NodeRunStatus) runRecordRef {
+	nr := NodeRunRecord{RunID: r.ID, Node: n, Status: status}
+	if status != NodeRunPending {
+		nr.Err = n.state.Result.Err
+		nr.Outputs = n.state.Result.Outputs
+	}
+	r.Nodes = append(r.Nodes, nr)
+	return runRecordRef{run: r, i: len(r.Nodes) - 1}
+}
+
+// Records the outcome of a pending node, finishing the run if it was the last
+// one. Must be called with schedulerMu held.
+func (ref runRecordRef) finishNode(status NodeRunStatus, res *NodeActionResult) {
+	nr := &ref.run.Nodes[ref.i]
+	nr.Status = status
+	if !nr.Start.IsZero() {
+		nr.End = time.Now()
+	}
+	if res != nil {
+		nr.Err = res.Err
+		nr.Outputs = res.Outputs
+		ref.run.graph.discardOldOutputs(nr.Node)
+	}
+	ref.run.checkDone()
+}
+
+// Drops the outputs of the node's entries that are older than its last
+// MaxRunOutputs results. Must be called with schedulerMu held.
+func (g *Graph) discardOldOutputs(n *Node) {
+	results := 0
+	for i := len(g.runs) - 1; i >= 0; i-- {
+		for j := range g.runs[i].Nodes {
+			nr := &g.runs[i].Nodes[j]
+			if nr.Node != n || nr.Status == NodeRunPending {
+				continue
+			}
+			if results >= MaxRunOutputs && nr.Outputs != nil {
+				nr.Outputs = nil
+				nr.OutputsDiscarded = true
+			}
+			if nr.Status == NodeRunExecuted || nr.Status == NodeRunCached {
+				results++
+			}
+		}
+	}
+}
+
+// Ends the run if no nodes are pending. Must be called with schedulerMu held.
+func (r *RunRecord) checkDone() {
+	for _, nr := range r.Nodes {
+		if nr.Status == NodeRunPending {
+			return
+		}
+	}
+	r.End = time.Now()
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunHistory(t *testing.T) {
+	a := newCountingNode("a", 0)
+	b := newCountingNode("b", 1)
+	c := newCountingNode("c", 1)
+	d := newCountingNode("d", 2)
+	g := newTestGraph(t, []*Node{a, b, c, d}, []*Wire{
+		{StartNode: a, EndNode: b},
+		{StartNode: a, EndNode: c},
+		{StartNode: b, EndNode: d, EndPort: 0},
+		{StartNode: c, EndNode: d, EndPort: 1},
+	})
+
+	statuses := func(run RunRecord) map[string]NodeRunStatus {
+		res := make(map[string]NodeRunStatus)
+		for _, nr := range run.Nodes {
+			res[nr.Node.Name] = nr.Status
+		}
+		return res
+	}
+
+	<-d.Run(g, false)
+	history := g.History()
+	require.Len(t, history, 1)
+	first := history[0]
+	assert.Equal(t, d, first.Target)
+	assert.True(t, first.Done())
+	assert.Equal(t, map[string]NodeRunStatus{
+		"a": NodeRunExecuted, "b": NodeRunExecuted, "c": NodeRunExecuted, "d": NodeRunExecuted,
+	}, statuses(first))
+	for _, nr := range first.Nodes {
+		assert.False(t, nr.Start.IsZero())
+		assert.False(t, nr.End.Before(nr.Start))
+		assert.Equal(t, []FlowValue{NewInt64Value(1, 0)}, nr.Outputs)
+	}
+
+	c.MarkStale(g)
+	<-d.Run(g, false)
+	history = g.History()
+	require.Len(t, history, 2)
+	assert.Equal(t, map[string]NodeRunStatus{
+		"a": NodeRunReused, "b": NodeRunReused, "c": NodeRunExecuted, "d": NodeRunExecuted,
+	}, statuses(history[1]))
+	nr, ok := history[1].Node(a)
+	require.True(t, ok)
+	assert.Zero(t, nr.Duration())
+	assert.Equal(t, []FlowValue{NewInt64Value(1, 0)}, nr.Outputs, "reused nodes should record the result they already had")
+
+	dHistory := g.NodeHistory(d)
+	require.Len(t, dHistory, 2)
+	assert.Equal(t, history[1].ID, dHistory[0].RunID, "most recent first")
+	assert.Equal(t, []FlowValue{NewInt64Value(2, 0)}, dHistory[0].Outputs)
+	assert.Equal(t, []FlowValue{NewInt64Value(1, 0)}, dHistory[1].Outputs)
+
+	t.Run("failure", func(t *testing.T) {
+		a.Action.(*countingAction).err = errors.New("oh no")
+		<-d.Run(g, true)
+		run := g.History()[2]
+		assert.Equal(t, map[string]NodeRunStatus{
+			"a": NodeRunExecuted, "b": NodeRunSkipped, "c": NodeRunSkipped, "d": NodeRunSkipped,
+		}, statuses(run))
+		nr, _ := run.Node(a)
+		assert.EqualError(t, nr.Err, "oh no")
+	})
+
+	t.Run("outputs", func(t *testing.T) {
+		a.Action.(*countingAction).err = nil
+		for range MaxRunOutputs + 2 {
+			<-a.Run(g, false)
+		}
+		aHistory := g.NodeHistory(a)
+		for _, nr := range aHistory[:MaxRunOutputs] {
+			assert.NotEmpty(t, nr.Outputs, "run %d", nr.RunID)
+		}
+		for _, nr := range aHistory[MaxRunOutputs : MaxRunOutputs+2] {
+			assert.Nil(t, nr.Outputs, "run %d", nr.RunID)
+			assert.True(t, nr.OutputsDiscarded)
+			assert.Equal(t, NodeRunExecuted, nr.Status, "statuses are kept for every run")
+			assert.False(t, nr.End.IsZero(), "timings are kept for every run")
+		}
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		for range MaxRunHistory {
+			<-b.Run(g, false)
+		}
+		history := g.History()
+		assert.Len(t, history, MaxRunHistory)
+		assert.Equal(t, g.runID, history[len(history)-1].ID)
+	})
+}
@@ -0,0 +1,147 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How many log entries are kept for the console. Older entries are dropped.
+const MaxLogEntries = 10_000
+
+// The attribute key that attributes a log message to a node. See Node.Logger.
+const LogNodeKey = "node"
+
+const logNodeNameKey = "node_name"
+
+// The minimum level of messages written to stderr. Every message is kept in
+// Logs regardless.
+var LogLevel slog.LevelVar
+
+// Recent log messages, for showing in the UI.
+var Logs = &LogBuffer{}
+
+// The logger for everything in Flowshell. Messages about a specific node should
+// use Node.Logger instead.
+var Log = slog.New(newLogHandler(Logs, os.Stderr, &LogLevel))
+
+// Returns a logger whose messages are attributed to the node.
+func (n *Node) Logger() *slog.Logger {
+	return Log.With(LogNodeKey, n.ID, logNodeNameKey, n.Name)
+}
+
+type LogEntry struct {
+	Time    time.Time
+	Level   slog.Level
+	Message string
+	Attrs   string // Any other attributes, as key=value pairs
+
+	// The node the message is about, if any. IDs start at 1.
+	NodeID   int
+	NodeName string
+}
+
+// A bounded list of log entries, safe for concurrent use.
+type LogBuffer struct {
+	mu      sync.Mutex
+	entries []LogEntry
+}
+
+func (b *LogBuffer) add(e LogEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.entries) >= MaxLogEntries {
+		b.entries = slices.Delete(b.entries, 0, MaxLogEntries/2)
+	}
+	b.entries = append(b.entries, e)
+}
+
+// Returns a copy of the buffer's entries, oldest first.
+func (b *LogBuffer) Entries() []LogEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.entries)
+}
+
+func (b *LogBuffer) Clear() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries = nil
+}
+
+// Sends every message to a LogBuffer, and messages at or above a level to a
+// text handler.
+type logHandler struct {
+	buf  *LogBuffer
+	text slog.Handler
+
+	attrs  []slog.Attr // From WithAttrs, with group prefixes already applied
+	prefix string      // From WithGroup, e.g. "group1.group2."
+}
+
+func newLogHandler(buf *LogBuffer, w io.Writer, level slog.Leveler) *logHandler {
+	return &logHandler{
+		buf:  buf,
+		text: slog.NewTextHandler(w, &slog.HandlerOptions{Level: level}),
+	}
+}
+
+func (h *logHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return true
+}
+
+func (h *logHandler) Handle(ctx context.Context, r slog.Record) error {
+	e := LogEntry{Time: r.Time, Level: r.Level, Message: r.Message}
+	var attrs []string
+	add := func(a slog.Attr) {
+		switch {
+		case a.Key == LogNodeKey && a.Value.Kind() == slog.KindInt64:
+			e.NodeID = int(a.Value.Int64())
+		case a.Key == logNodeNameKey:
+			e.NodeName = a.Value.String()
+		default:
+			attrs = append(attrs, fmt.Sprintf("%s=%v", a.Key, a.Value))
+		}
+	}
+	for _, a := range h.attrs {
+		add(a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		add(slog.Attr{Key: h.prefix + a.Key, Value: a.Value})
+		return true
+	})
+	e.Attrs = strings.Join(attrs, " ")
+	h.buf.add(e)
+
+	if h.text.Enabled(ctx, r.Level) {
+		return h.text.Handle(ctx, r)
+	}
+	return nil
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	res := *h
+	res.text = h.text.WithAttrs(attrs)
+	res.attrs = slices.Clip(h.attrs)
+	for _, a := range attrs {
+		res.attrs = append(res.attrs, slog.Attr{Key: h.prefix + a.Key, Value: a.Value})
+	}
+	return &res
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	res := *h
+	res.text = h.text.WithGroup(name)
+	res.prefix = h.prefix + name + "."
+	return &res
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogHandler(t *testing.T) {
+	var buf LogBuffer
+	var out bytes.Buffer
+	log := slog.New(newLogHandler(&buf, &out, slog.LevelInfo))
+
+	n := &Node{ID: 3, Name: "Trim Spaces"}
+	log.With(LogNodeKey, n.ID, logNodeNameKey, n.Name).Debug("Running node")
+	log.WithGroup("cache").Warn("Failed", "err", "oops")
+
+	entries := buf.Entries()
+	require.Len(t, entries, 2)
+	assert.Equal(t, slog.LevelDebug, entries[0].Level)
+	assert.Equal(t, "Running node", entries[0].Message)
+	assert.Equal(t, 3, entries[0].NodeID)
+	assert.Equal(t, "Trim Spaces", entries[0].NodeName)
+	assert.Empty(t, entries[0].Attrs)
+
+	assert.Equal(t, 0, entries[1].NodeID)
+	assert.Equal(t, "cache.err=oops", entries[1].Attrs)
+
+	// Debug messages are kept, but not written out.
+	assert.NotContains(t, out.String(), "Running node")
+	assert.Contains(t, out.String(), "level=WARN msg=Failed cache.err=oops")
+
+	buf.Clear()
+	assert.Empty(t, buf.Entries())
+}
+
+func TestSchedulerLogs(t *testing.T) {
+	a := newCountingNode("a", 0)
+	b := newCountingNode("b", 1)
+	g := newTestGraph(t, []*Node{a, b}, []*Wire{{StartNode: a, EndNode: b}})
+	Logs.Clear()
+	<-b.Run(g, false)
+
+	var messages []string
+	for _, e := range Logs.Entries() {
+		if e.NodeID == b.ID && e.NodeName == "b" {
+			assert.Equal(t, slog.LevelDebug, e.Level)
+			messages = append(messages, e.Message)
+		}
+	}
+	assert.Equal(t, []string{"Scheduling node", "Running node"}, messages)
+}
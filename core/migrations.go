@@ -0,0 +1,54 @@
+package core
+
+import "fmt"
+
+// The history of the graph file format. Every time the format changes, bump
+// GraphFileVersion, add an entry here, and run the tests with -update to
+// create a fixture for the new version.
+//
+// Most changes only affect a single node action, and are best handled in that
+// action's Serialize method by checking s.Version. Changes that need to see
+// the whole graph can provide an Upgrade function, which is run on graphs
+// decoded from the previous version.
+var migrations = []Migration{
+	{
+		Version:     2,
+		Description: "Dropdown selections are stored by value instead of display name",
+	},
+	{
+		Version:     3,
+		Description: "Node actions are length-prefixed so that unknown node types can be skipped",
+	},
+	{
+		Version:     4,
+		Description: "Nodes can opt out of the result cache",
+	},
+	{
+		Version:     5,
+		Description: "Types remember whether they are well-known, like File or Timestamp",
+	},
+	{
+		Version:     6,
+		Description: "Nodes have a timeout and retry policy",
+	},
+}
+
+type Migration struct {
+	Version     int // The version this migration upgrades to
+	Description string
+	Upgrade     func(g *GraphFile) error
+}
+
+// Upgrade a graph decoded from an older version of the file format by applying
+// every migration since that version, in order.
+func migrateGraph(g *GraphFile, fromVersion int) error {
+	for _, m := range migrations {
+		if m.Version <= fromVersion || m.Upgrade == nil {
+			continue
+		}
+		if err := m.Upgrade(g); err != nil {
+			return fmt.Errorf("failed to upgrade graph to version %d (%s): %w", m.Version, m.Description, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bvisness/flowshell/trace"
+	"github.com/bvisness/flowshell/util"
+)
+
+// A position in the graph editor.
+type V2 struct {
+	X, Y float32
+}
+
+func SV2(s *Serializer, v *V2) {
+	SObject(s, func() bool {
+		SFloat(s.Key("x"), &v.X)
+		return SFloat(s.Key("y"), &v.Y)
+	})
+}
+
+type Node struct {
+	ID     int
+	Pos    V2
+	Name   string
+	Pinned bool
+	// Never reuse a cached result for this node, e.g. because it reads
+	// something the cache can't see. Use SetNoCache to change it.
+	NoCache bool
+
+	InputPorts  []NodePort
+	OutputPorts []NodePort
+
+	Action NodeAction
+	Policy RunPolicy // Use SetPolicy to change it
+	Valid  bool
+
+	// Execution state, which is written by the scheduler's goroutines. Guarded
+	// by schedulerMu; use State to read it.
+	state       NodeState
+	done        chan struct{} // closed when the current run completes
+	cancel      context.CancelFunc
+	records     []runRecordRef // entries in the run history waiting on the current run
+	actionStart time.Time      // when the current run's action started, if it has
+	inputTypes  []FlowType     // the input port types when the current run's action started
+}
+
+// A snapshot of a node's execution state.
+type NodeState struct {
+	Running         bool
+	ResultAvailable bool
+	Result          NodeActionResult
+	Stale           bool // The result is out of date with the node's inputs or configuration
+}
+
+// Returns the node's current execution state. It is safe to call this while
+// the node is running.
+func (n *Node) State() NodeState {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+	return n.state
+}
+
+var _ Serializable = &Node{}
+
+func (n *Node) Serialize(s *Serializer) bool {
+	SInt(s.Key("id"), &n.ID)
+	SV2(s.Key("pos"), &n.Pos)
+	SStr(s.Key("name"), &n.Name)
+	SBool(s.Key("pinned"), &n.Pinned)
+	if s.Version >= 4 {
+		SBool(s.Key("noCache"), &n.NoCache)
+	}
+
+	SSlice(s.Key("inputs"), &n.InputPorts)
+	SSlice(s.Key("outputs"), &n.OutputPorts)
+
+	if s.Encode {
+		s.Key("type").WriteStr(n.Action.Tag())
+	} else {
+		tag, ok := s.Key("type").ReadStr()
+		if !ok {
+			return false
+		}
+		if meta, ok := GetNodeActionMeta(tag); ok {
+			n.Action = meta.Alloc()
+		} else if !s.Text && s.Version < 3 {
+			// Actions weren't length-prefixed yet, so there's no way to skip it.
+			return s.Error(fmt.Errorf("unknown node type \"%s\"", tag))
+		} else {
+			n.Action = &UnknownAction{tag: tag}
+		}
+	}
+	SOpaque(s.Key("action"), n.Action)
+	if s.Version >= 6 {
+		SThing(s.Key("policy"), &n.Policy)
+	}
+
+	// The remainder of the fields are dynamic and need not be serialized.
+
+	return s.Ok()
+}
+
+// Copies the node's configuration, including any inner graph, but not its ID
+// or results.
+func CloneNode(n *Node) (*Node, error) {
+	enc := NewEncoder(GraphFileVersion)
+	if !n.Serialize(enc) {
+		return nil, errors.Join(enc.Errs...)
+	}
+	dec := NewDecoder(enc.Bytes())
+	var clone Node
+	if !clone.Serialize(dec) {
+		return nil, errors.Join(dec.Errs...)
+	}
+	clone.ID = 0
+	return &clone, nil
+}
+
+func (n *Node) String() string {
+	return fmt.Sprintf("Node#%d(%s)", n.ID, n.Name)
+}
+
+type NodePort struct {
+	Name string
+	Type FlowType
+}
+
+var _ Serializable = &NodePort{}
+
+func (np *NodePort) Serialize(s *Serializer) bool {
+	SStr(s.Key("name"), &np.Name)
+	SThing(s.Key("type"), &np.Type)
+	return s.Ok()
+}
+
+type Wire struct {
+	StartNode, EndNode *Node
+	StartPort, EndPort int
+}
+
+func (w *Wire) Type() FlowType {
+	return w.StartNode.OutputPorts[w.StartPort].Type
+}
+
+func (n *Node) ClearResult() {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+	n.state.ResultAvailable = false
+	n.state.Result = NodeActionResult{}
+}
+
+func (n *Node) GetInputWire(g *Graph, port int) (*Wire, bool) {
+	return g.InputWire(n, port)
+}
+
+func (n *Node) InputIsWired(g *Graph, port int) bool {
+	_, res := g.InputWire(n, port)
+	return res
+}
+
+func (n *Node) GetInputValue(g *Graph, port int) (FlowValue, bool, error) {
+	inputTypes := n.checkedInputTypes()
+	if port >= len(inputTypes) {
+		panic(fmt.Errorf("node %s has no port %d", n, port))
+	}
+
+	wire, ok := g.InputWire(n, port)
+	if !ok {
+		return FlowValue{}, false, nil
+	}
+	wireValue, ok := wire.StartNode.GetOutputValue(wire.StartPort)
+	if !ok || wireValue.Type == nil {
+		// Inputs to a composite node that aren't wired on the outside have no
+		// value inside.
+		return FlowValue{}, false, nil
+	}
+	if err := Typecheck(*wireValue.Type, inputTypes[port]); err != nil {
+		return wireValue, true, fmt.Errorf("on input port %d: %v", port, err)
+	}
+	return wireValue, true, nil
+}
+
+// Returns the types that GetInputValue checks against. While the node's action
+// is running, these are the types from when it started, since validation may
+// change the ports in the meantime.
+func (n *Node) checkedInputTypes() []FlowType {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+	if n.state.Running && n.inputTypes != nil {
+		return n.inputTypes
+	}
+	return util.Map(n.InputPorts, func(port NodePort) FlowType { return port.Type })
+}
+
+func (n *Node) GetOutputValue(port int) (FlowValue, bool) {
+	state := n.State()
+	if !state.ResultAvailable {
+		return FlowValue{}, false
+	}
+	// The outputs were checked against the node's output types when it ran.
+	// The ports themselves may have been changed by validation since.
+	if port >= len(state.Result.Outputs) {
+		panic(fmt.Errorf("node %s has no output value for port %d", n, port))
+	}
+	return state.Result.Outputs[port], true
+}
+
+// All implementations of NodeAction should be marked with `GEN:NodeAction` in
+// a comment, in order to be picked up by go:generate.
+type NodeAction interface {
+	UpdateAndValidate(g *Graph, n *Node)
+	// Run the action. Implementations should stop early and report ctx.Err()
+	// if the context is canceled, e.g. by the node's Stop button. Goroutines
+	// started by the action should `defer RecoverPanic(&res)` so that bugs
+	// show up as errors on the node instead of crashing Flowshell.
+	Run(ctx context.Context, g *Graph, n *Node) <-chan NodeActionResult
+	Tag() string // This is implemented automatically by go:generate.
+	Serializable
+}
+
+type NodeActionResult struct {
+	Outputs []FlowValue
+	Err     error
+}
+
+// A panic that occurred while running a node.
+type PanicError struct {
+	Value any
+	Stack trace.CallStack
+}
+
+func (e PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+func (e PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// Recovers from a panic, replacing the result with a PanicError. Must be
+// deferred directly, after the deferred send of the result:
+//
+//	defer func() { done <- res }()
+//	defer RecoverPanic(&res)
+func RecoverPanic(res *NodeActionResult) {
+	if r := recover(); r != nil {
+		*res = NodeActionResult{Err: PanicError{Value: r, Stack: trace.PanicTrace()}}
+	}
+}
+
+type NodeActionMeta struct {
+	Tag   string
+	Alloc func() NodeAction
+}
+
+// Looks up a node action by tag. Unknown tags may come from files saved by a
+// newer version of Flowshell; if you just added a node action, make sure to
+// run go:generate.
+func GetNodeActionMeta(tag string) (NodeActionMeta, bool) {
+	for _, meta := range allNodeActions {
+		if tag == meta.Tag {
+			return meta, true
+		}
+	}
+	return NodeActionMeta{}, false
+}
+
+// See node_actions_gen.go for the definition of allNodeActions.
@@ -1,15 +1,21 @@
 // Code generated by gen_node_actions.go; DO NOT EDIT.
 
-package app
+package core
 
 var allNodeActions = [...]NodeActionMeta{
 	{Tag: "AggregateAction", Alloc: func() NodeAction { return &AggregateAction{} }},
+	{Tag: "CompositeAction", Alloc: func() NodeAction { return &CompositeAction{} }},
 	{Tag: "ConcatTablesAction", Alloc: func() NodeAction { return &ConcatTablesAction{} }},
+	{Tag: "FilterAction", Alloc: func() NodeAction { return &FilterAction{} }},
+	{Tag: "ForEachAction", Alloc: func() NodeAction { return &ForEachAction{} }},
 	{Tag: "LinesAction", Alloc: func() NodeAction { return &LinesAction{} }},
 	{Tag: "ListFilesAction", Alloc: func() NodeAction { return &ListFilesAction{} }},
 	{Tag: "LoadFileAction", Alloc: func() NodeAction { return &LoadFileAction{} }},
 	{Tag: "RunProcessAction", Alloc: func() NodeAction { return &RunProcessAction{} }},
 	{Tag: "SaveFileAction", Alloc: func() NodeAction { return &SaveFileAction{} }},
+	{Tag: "SortAction", Alloc: func() NodeAction { return &SortAction{} }},
+	{Tag: "SubgraphInputsAction", Alloc: func() NodeAction { return &SubgraphInputsAction{} }},
+	{Tag: "SubgraphOutputsAction", Alloc: func() NodeAction { return &SubgraphOutputsAction{} }},
 	{Tag: "TrimSpacesAction", Alloc: func() NodeAction { return &TrimSpacesAction{} }},
 }
 
@@ -17,10 +23,22 @@ func (a *AggregateAction) Tag() string {
 	return "AggregateAction"
 }
 
+func (a *CompositeAction) Tag() string {
+	return "CompositeAction"
+}
+
 func (a *ConcatTablesAction) Tag() string {
 	return "ConcatTablesAction"
 }
 
+func (a *FilterAction) Tag() string {
+	return "FilterAction"
+}
+
+func (a *ForEachAction) Tag() string {
+	return "ForEachAction"
+}
+
 func (a *LinesAction) Tag() string {
 	return "LinesAction"
 }
@@ -41,6 +59,18 @@ func (a *SaveFileAction) Tag() string {
 	return "SaveFileAction"
 }
 
+func (a *SortAction) Tag() string {
+	return "SortAction"
+}
+
+func (a *SubgraphInputsAction) Tag() string {
+	return "SubgraphInputsAction"
+}
+
+func (a *SubgraphOutputsAction) Tag() string {
+	return "SubgraphOutputsAction"
+}
+
 func (a *TrimSpacesAction) Tag() string {
 	return "TrimSpacesAction"
 }
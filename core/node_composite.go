@@ -0,0 +1,424 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/bvisness/flowshell/util"
+)
+
+// A node that runs a graph of its own, so that a group of nodes can be used
+// as one. The inner graph has a Subgraph Inputs node, whose outputs are the
+// values wired into the composite, and a Subgraph Outputs node, whose inputs
+// become the composite's outputs.
+//
+// Each composite node owns its inner graph. Copies made with CloneNode can be
+// edited independently.
+//
+// GEN:NodeAction
+type CompositeAction struct {
+	Subgraph
+}
+
+func NewCompositeNode(name string, inner *Graph) *Node {
+	n := &Node{
+		Name:   name,
+		Action: &CompositeAction{Subgraph{Inner: inner}},
+	}
+	n.Action.(*CompositeAction).updatePorts(n)
+	return n
+}
+
+var _ SubgraphAction = &CompositeAction{}
+var _ CachePolicy = &CompositeAction{}
+var _ WatchedAction = &CompositeAction{}
+
+// A graph run by a node, with a Subgraph Inputs node for the values going in
+// and a Subgraph Outputs node for the values coming out.
+type Subgraph struct {
+	Inner *Graph
+	Pan   V2 // Where the inner graph was scrolled to when it was last edited
+}
+
+// An action that runs a graph of its own, which can be opened for editing.
+type SubgraphAction interface {
+	NodeAction
+	InnerGraph() *Subgraph
+}
+
+func (sg *Subgraph) InnerGraph() *Subgraph {
+	return sg
+}
+
+func (sg *Subgraph) inputsNode() (*Node, bool) {
+	return findNode[*SubgraphInputsAction](sg.Inner)
+}
+
+func (sg *Subgraph) outputsNode() (*Node, bool) {
+	return findNode[*SubgraphOutputsAction](sg.Inner)
+}
+
+func findNode[T NodeAction](g *Graph) (*Node, bool) {
+	for _, n := range g.Nodes() {
+		if _, ok := n.Action.(T); ok {
+			return n, true
+		}
+	}
+	return nil, false
+}
+
+// Validates the inner graph. Returns false if any node inside is invalid.
+// Must be called with schedulerMu held.
+func (sg *Subgraph) validateLocked() bool {
+	sg.Inner.validateLocked()
+	for _, inner := range sg.Inner.Nodes() {
+		if !inner.Valid {
+			return false
+		}
+	}
+	return true
+}
+
+// Runs the inner graph with the given values as its inputs, and returns its
+// outputs.
+func runSubgraph(ctx context.Context, g *Graph, values []FlowValue) ([]FlowValue, error) {
+	inputs, hasInputs := findNode[*SubgraphInputsAction](g)
+	outputs, hasOutputs := findNode[*SubgraphOutputsAction](g)
+	if !hasInputs || !hasOutputs {
+		return nil, errors.New("the inner graph is missing its inputs or outputs node")
+	}
+
+	inputs.setResult(g, NodeActionResult{Outputs: values})
+	if _, err := g.Run(ctx, outputs); err != nil {
+		return nil, err
+	}
+	var res []FlowValue
+	for i, port := range outputs.InputPorts {
+		v, ok, err := outputs.GetInputValue(g, i)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("output \"%s\" is not wired inside the subgraph", port.Name)
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+// Marks every node in the graph stale, except pinned ones, so that they run
+// again the next time they're needed.
+func (g *Graph) markUnpinnedStale() {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+	for _, n := range g.Nodes() {
+		if !n.Pinned {
+			n.state.Stale = true
+		}
+	}
+}
+
+// The subgraph can be cached if everything inside it can.
+func (sg *Subgraph) cacheKey() ([]byte, bool) {
+	var extra []byte
+	for _, inner := range sg.Inner.Nodes() {
+		if inner.cachingDisabled() {
+			return nil, false
+		}
+		if policy, ok := inner.Action.(CachePolicy); ok {
+			innerExtra, ok := policy.CacheKey(inner)
+			if !ok {
+				return nil, false
+			}
+			extra = append(extra, innerExtra...)
+		}
+	}
+	return extra, true
+}
+
+func (sg *Subgraph) watchedPaths() []string {
+	var paths []string
+	for _, req := range watchRequests(sg.Inner) {
+		paths = append(paths, req.Paths...)
+	}
+	return paths
+}
+
+func (sg *Subgraph) serialize(s *Serializer) bool {
+	f := &GraphFile{}
+	if s.Encode {
+		f = sg.Inner.File()
+		f.Pan = sg.Pan
+	}
+	SThing(s.Key("graph"), f)
+	if !s.Encode && s.Ok() {
+		sg.Inner = NewGraphFromFile(f)
+		sg.Pan = f.Pan
+	}
+	return s.Ok()
+}
+
+// Copies the ports of the inner graph's inputs and outputs nodes. Returns false
+// if either is missing, in which case the ports are left alone so that wires
+// into the composite stay intact.
+func (c *CompositeAction) updatePorts(n *Node) bool {
+	inputs, hasInputs := c.inputsNode()
+	outputs, hasOutputs := c.outputsNode()
+	if !hasInputs || !hasOutputs {
+		return false
+	}
+	n.InputPorts = slices.Clone(inputs.OutputPorts)
+	n.OutputPorts = slices.Clone(outputs.InputPorts)
+	return true
+}
+
+func (c *CompositeAction) UpdateAndValidate(g *Graph, n *Node) {
+	innerValid := c.validateLocked()
+	n.Valid = c.updatePorts(n) && innerValid
+}
+
+func (c *CompositeAction) Run(ctx context.Context, g *Graph, n *Node) <-chan NodeActionResult {
+	done := make(chan NodeActionResult)
+
+	go func() {
+		var res NodeActionResult
+		defer func() { done <- res }()
+		defer RecoverPanic(&res)
+
+		// Inputs that aren't wired are passed along as missing values, so that
+		// e.g. List Files falls back to its own directory setting.
+		values := make([]FlowValue, len(n.InputPorts))
+		for i := range n.InputPorts {
+			v, _, err := n.GetInputValue(g, i)
+			if err != nil {
+				res.Err = err
+				return
+			}
+			values[i] = v
+		}
+		// Running the composite runs everything inside it again, not just the
+		// nodes that depend on its inputs, e.g. so that files are read again.
+		c.Inner.markUnpinnedStale()
+		c.Inner.forwardTraceEvents(g, fmt.Sprintf("%s (#%d)", n.Name, n.ID))
+		res.Outputs, res.Err = runSubgraph(ctx, c.Inner, values)
+	}()
+
+	return done
+}
+
+func (c *CompositeAction) CacheKey(n *Node) ([]byte, bool) {
+	return c.cacheKey()
+}
+
+func (c *CompositeAction) WatchedPaths(g *Graph, n *Node) []string {
+	return c.watchedPaths()
+}
+
+func (c *CompositeAction) Serialize(s *Serializer) bool {
+	return c.serialize(s)
+}
+
+// The values going into a subgraph, e.g. those wired into a composite node.
+// The node running the subgraph provides its result directly; running it on
+// its own only works once that node has run.
+//
+// GEN:NodeAction
+type SubgraphInputsAction struct{}
+
+func NewSubgraphInputsNode() *Node {
+	return &Node{
+		Name:   "Subgraph Inputs",
+		Action: &SubgraphInputsAction{},
+	}
+}
+
+var _ NodeAction = &SubgraphInputsAction{}
+
+func (a *SubgraphInputsAction) UpdateAndValidate(g *Graph, n *Node) {
+	n.Valid = true
+}
+
+func (a *SubgraphInputsAction) Run(ctx context.Context, g *Graph, n *Node) <-chan NodeActionResult {
+	done := make(chan NodeActionResult, 1)
+	done <- NodeActionResult{Err: errors.New("run the node containing this graph to provide its inputs")}
+	return done
+}
+
+func (a *SubgraphInputsAction) Serialize(s *Serializer) bool {
+	return s.Ok()
+}
+
+// The values coming out of a subgraph, e.g. a composite node's outputs. Its
+// ports take on the types of whatever is wired into them.
+//
+// GEN:NodeAction
+type SubgraphOutputsAction struct{}
+
+func NewSubgraphOutputsNode() *Node {
+	return &Node{
+		Name:   "Subgraph Outputs",
+		Action: &SubgraphOutputsAction{},
+	}
+}
+
+var _ NodeAction = &SubgraphOutputsAction{}
+
+func (a *SubgraphOutputsAction) UpdateAndValidate(g *Graph, n *Node) {
+	n.Valid = true
+	for i := range n.InputPorts {
+		if wire, ok := n.GetInputWire(g, i); ok {
+			n.InputPorts[i].Type = wire.Type()
+		}
+	}
+}
+
+func (a *SubgraphOutputsAction) Run(ctx context.Context, g *Graph, n *Node) <-chan NodeActionResult {
+	done := make(chan NodeActionResult, 1)
+	done <- NodeActionResult{}
+	return done
+}
+
+func (a *SubgraphOutputsAction) Serialize(s *Serializer) bool {
+	return s.Ok()
+}
+
+// Replaces the nodes with a composite node that runs them as a graph of its
+// own. Input ports that aren't fed by another node in the group become the
+// composite's inputs, and output ports that are wired outside the group, or
+// not wired at all, become its outputs. Wires to the rest of the graph are
+// moved to the composite's ports.
+func (g *Graph) Collapse(ns []*Node, name string) (*Node, error) {
+	if len(ns) == 0 {
+		return nil, errors.New("no nodes to collapse")
+	}
+	inGroup := func(n *Node) bool { return slices.Contains(ns, n) }
+	for _, n := range ns {
+		if existing, ok := g.Node(n.ID); !ok || existing != n {
+			return nil, fmt.Errorf("%s is not in the graph", n)
+		}
+		if n.State().Running {
+			return nil, fmt.Errorf("%s is running", n)
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// A path out of the group and back in would become a cycle through the
+	// composite.
+	for _, n := range ns {
+		for _, wire := range g.outputs[n] {
+			if !inGroup(wire.EndNode) && g.reachesAny(wire.EndNode, inGroup) {
+				return nil, fmt.Errorf("cannot collapse: %s both depends on the group and feeds into it", wire.EndNode)
+			}
+		}
+	}
+
+	inputs := NewSubgraphInputsNode()
+	outputs := NewSubgraphOutputsNode()
+	var innerWires []*Wire
+	var outerInputs []*Wire    // The wire into each of the composite's inputs, or nil
+	var outerOutputs [][]*Wire // The wires out of each of the composite's outputs
+	portName := func(ports []NodePort, n *Node, port NodePort) string {
+		if slices.ContainsFunc(ports, func(p NodePort) bool { return p.Name == port.Name }) {
+			return fmt.Sprintf("%s (%s #%d)", port.Name, n.Name, n.ID)
+		}
+		return port.Name
+	}
+	for _, n := range ns {
+		for i, port := range n.InputPorts {
+			wire, wired := g.inputWire(n, i)
+			if wired && inGroup(wire.StartNode) {
+				innerWires = append(innerWires, wire)
+				continue
+			}
+			innerWires = append(innerWires, &Wire{
+				StartNode: inputs, StartPort: len(inputs.OutputPorts),
+				EndNode: n, EndPort: i,
+			})
+			inputs.OutputPorts = append(inputs.OutputPorts, NodePort{Name: portName(inputs.OutputPorts, n, port), Type: port.Type})
+			outerInputs = append(outerInputs, util.Tern(wired, wire, nil))
+		}
+		for i, port := range n.OutputPorts {
+			var internal, external []*Wire
+			for _, wire := range g.outputs[n] {
+				if wire.StartPort == i {
+					if inGroup(wire.EndNode) {
+						internal = append(internal, wire)
+					} else {
+						external = append(external, wire)
+					}
+				}
+			}
+			if len(internal) > 0 && len(external) == 0 {
+				continue
+			}
+			innerWires = append(innerWires, &Wire{
+				StartNode: n, StartPort: i,
+				EndNode: outputs, EndPort: len(outputs.InputPorts),
+			})
+			outputs.InputPorts = append(outputs.InputPorts, NodePort{Name: portName(outputs.InputPorts, n, port), Type: port.Type})
+			outerOutputs = append(outerOutputs, external)
+		}
+	}
+
+	// Lay out the inner graph with the inputs to the left of the group and the
+	// outputs to the right.
+	topLeft, bottomRight := ns[0].Pos, ns[0].Pos
+	for _, n := range ns {
+		topLeft = V2{min(topLeft.X, n.Pos.X), min(topLeft.Y, n.Pos.Y)}
+		bottomRight = V2{max(bottomRight.X, n.Pos.X), max(bottomRight.Y, n.Pos.Y)}
+	}
+	inputs.Pos = V2{topLeft.X - 300, topLeft.Y}
+	outputs.Pos = V2{bottomRight.X + 450, topLeft.Y}
+
+	inner := NewGraph()
+	for _, n := range ns {
+		g.removeNode(n)
+		inner.AddNode(n)
+	}
+	inner.AddNode(inputs)
+	inner.AddNode(outputs)
+	for _, wire := range innerWires {
+		inner.addWire(wire)
+	}
+
+	composite := NewCompositeNode(name, inner)
+	composite.Pos = topLeft
+	g.addNode(composite)
+	for i, wire := range outerInputs {
+		if wire != nil {
+			g.addWire(&Wire{StartNode: wire.StartNode, StartPort: wire.StartPort, EndNode: composite, EndPort: i})
+		}
+	}
+	for i, wires := range outerOutputs {
+		for _, wire := range wires {
+			g.addWire(&Wire{StartNode: composite, StartPort: i, EndNode: wire.EndNode, EndPort: wire.EndPort})
+		}
+	}
+	return composite, nil
+}
+
+// Reports whether any node matching the predicate can be reached by following
+// wires out of n. Must be called with g.mu held.
+func (g *Graph) reachesAny(n *Node, match func(*Node) bool) bool {
+	visited := make(map[*Node]bool)
+	stack := []*Node{n}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if match(n) {
+			return true
+		}
+		if visited[n] {
+			continue
+		}
+		visited[n] = true
+		for _, wire := range g.outputs[n] {
+			stack = append(stack, wire.EndNode)
+		}
+	}
+	return false
+}
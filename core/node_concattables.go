@@ -0,0 +1,126 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// GEN:NodeAction
+type ConcatTablesAction struct{}
+
+func NewConcatTablesNode() *Node {
+	return &Node{
+		Name: "Concatenate Tables",
+
+		InputPorts: []NodePort{{
+			Name: "Table 1",
+			Type: NewAnyTableType(),
+		}},
+		OutputPorts: []NodePort{{
+			Name: "Table",
+			Type: NewAnyTableType(),
+		}},
+
+		Action: &ConcatTablesAction{},
+	}
+}
+
+var _ NodeAction = &ConcatTablesAction{}
+
+// Adds another table input to the end of the node.
+func (a *ConcatTablesAction) AddInput(g *Graph, n *Node) {
+	n.InputPorts = append(n.InputPorts, NodePort{
+		Name: fmt.Sprintf("Table %d", len(n.InputPorts)+1),
+		Type: NewAnyTableType(),
+	})
+	n.MarkChanged(g)
+}
+
+// Removes the last table input, along with any wire into it. The node always
+// keeps at least one input.
+func (a *ConcatTablesAction) RemoveInput(g *Graph, n *Node) {
+	if len(n.InputPorts) <= 1 {
+		return
+	}
+	if wire, ok := g.InputWire(n, len(n.InputPorts)-1); ok {
+		g.Disconnect(wire)
+	}
+	n.InputPorts = n.InputPorts[:len(n.InputPorts)-1]
+	n.MarkChanged(g)
+}
+
+func (a *ConcatTablesAction) UpdateAndValidate(g *Graph, n *Node) {
+	n.Valid = true
+
+	allPortsWired := true
+	for i := range n.InputPorts {
+		wire, hasWire := n.GetInputWire(g, i)
+		if !hasWire {
+			allPortsWired = false
+			n.OutputPorts[0].Type = NewAnyTableType()
+		} else if i == 0 {
+			n.OutputPorts[0].Type = wire.Type()
+		}
+	}
+
+	if !allPortsWired {
+		n.Valid = false
+	}
+}
+
+func (a *ConcatTablesAction) Run(ctx context.Context, g *Graph, n *Node) <-chan NodeActionResult {
+	done := make(chan NodeActionResult)
+
+	go func() {
+		var res NodeActionResult
+		defer func() { done <- res }()
+		defer RecoverPanic(&res)
+
+		firstInput, ok, err := n.GetInputValue(g, 0)
+		if !ok {
+			panic("first input was not wired (validation should have caught this)")
+		}
+		if err != nil {
+			res.Err = err
+			return
+		}
+		expectedType := firstInput.Type
+
+		var tableRowses [][][]FlowValueField
+		for i := range n.InputPorts {
+			input, ok, err := n.GetInputValue(g, i)
+			if !ok {
+				res.Err = errors.New("an input node is required")
+				return
+			}
+			if err != nil {
+				res.Err = err
+				return
+			}
+
+			if err := Typecheck(*input.Type, *expectedType); err != nil {
+				res.Err = fmt.Errorf("all tables should have the same type: expected %s but got %s", expectedType, input.Type)
+				return
+			}
+			tableRowses = append(tableRowses, input.TableValue)
+		}
+
+		var finalTableRows [][]FlowValueField
+		for _, rows := range tableRowses {
+			finalTableRows = append(finalTableRows, rows...)
+		}
+		res = NodeActionResult{
+			Outputs: []FlowValue{{
+				Type:       expectedType,
+				TableValue: finalTableRows,
+			}},
+		}
+	}()
+
+	return done
+}
+
+func (n *ConcatTablesAction) Serialize(s *Serializer) bool {
+	return s.Ok()
+}
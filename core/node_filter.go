@@ -0,0 +1,323 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Keeps the items of a list, or the rows of a table, that match a condition.
+// The condition is either a quick check of one column, built from dropdowns,
+// or an expression (see Expr). Either way, it is compiled to an expression
+// over the item's fields, with the item itself as "item".
+//
+// GEN:NodeAction
+type FilterAction struct {
+	Mode   Choice
+	Column string // The column the quick modes check, for records
+	Op     Choice // How the Compare mode compares the column to Value
+	Value  string
+	Expr   string // The Expression mode's condition
+
+	// The columns to choose from, for the editor. Rebuilt from the input's
+	// type by UpdateAndValidate.
+	Columns Choice
+	// Why the condition doesn't work with the input, if it doesn't. Set by
+	// UpdateAndValidate.
+	Err error
+}
+
+const (
+	FilterNonEmpty   = "nonempty"
+	FilterCompare    = "compare"
+	FilterExpression = "expression"
+)
+
+var filterModeOptions = []ChoiceOption{
+	{Name: "Not empty", Value: FilterNonEmpty},
+	{Name: "Compare", Value: FilterCompare},
+	{Name: "Expression", Value: FilterExpression},
+}
+
+var filterOpOptions = []ChoiceOption{
+	{Name: "==", Value: "=="},
+	{Name: "!=", Value: "!="},
+	{Name: "<", Value: "<"},
+	{Name: "<=", Value: "<="},
+	{Name: ">", Value: ">"},
+	{Name: ">=", Value: ">="},
+	{Name: "contains", Value: "contains"},
+	{Name: "starts with", Value: "startsWith"},
+	{Name: "ends with", Value: "endsWith"},
+}
+
+func NewFilterNode(mode string) *Node {
+	action := FilterAction{
+		Mode: Choice{Options: filterModeOptions},
+		Op:   Choice{Options: filterOpOptions},
+	}
+	action.Mode.SelectByValue(mode)
+
+	return &Node{
+		Name: "Filter",
+
+		InputPorts: []NodePort{{
+			Name: "Items",
+			Type: NewListType(FlowType{Kind: FSKindAny}),
+		}},
+		OutputPorts: []NodePort{{
+			Name: "Kept",
+			Type: NewListType(FlowType{Kind: FSKindAny}),
+		}},
+
+		Action: &action,
+	}
+}
+
+var _ NodeAction = &FilterAction{}
+var _ InputTypeChecker = &FilterAction{}
+
+func (a *FilterAction) UpdateAndValidate(g *Graph, n *Node) {
+	n.Valid = true
+	a.Err = nil
+
+	wire, hasWire := n.GetInputWire(g, 0)
+	if !hasWire {
+		n.InputPorts[0].Type = NewListType(FlowType{Kind: FSKindAny})
+		n.OutputPorts[0].Type = NewListType(FlowType{Kind: FSKindAny})
+		a.updateColumns(FlowType{Kind: FSKindAny})
+		n.Valid = false
+		return
+	}
+
+	// The kept items have the same type as the input.
+	n.InputPorts[0].Type = wire.Type()
+	n.OutputPorts[0].Type = wire.Type()
+
+	itemType := itemTypeOf(wire.Type())
+	if itemType.Kind == FSKindAny {
+		// Catch it at runtime, but offer the columns of the last result, e.g.
+		// for CSV files, whose columns come from their header.
+		a.updateColumns(lastItemType(wire))
+		return
+	}
+	a.updateColumns(itemType)
+	if _, err := a.Condition(itemType); err != nil {
+		a.Err = err
+		n.Valid = false
+	}
+}
+
+func (a *FilterAction) CheckInputType(n *Node, port int, t FlowType) error {
+	return checkItemsType(t)
+}
+
+// Accepts any list or table, for nodes that work on each item or row.
+func checkItemsType(t FlowType) error {
+	if t.Kind == FSKindTable {
+		return nil
+	}
+	return checkWireType(t, NewListType(FlowType{Kind: FSKindAny}))
+}
+
+// The type of a list's items or a table's rows.
+func itemTypeOf(t FlowType) FlowType {
+	if t.ContainedType != nil && (t.Kind == FSKindList || t.Kind == FSKindTable) {
+		return *t.ContainedType
+	}
+	return FlowType{Kind: FSKindAny}
+}
+
+// The type of the items last sent down the wire, for inputs whose type isn't
+// known until they run, like a CSV file's table. Must be called with
+// schedulerMu held, e.g. from UpdateAndValidate.
+func lastItemType(wire *Wire) FlowType {
+	state := wire.StartNode.state
+	if !state.ResultAvailable || wire.StartPort >= len(state.Result.Outputs) {
+		return FlowType{Kind: FSKindAny}
+	}
+	v := state.Result.Outputs[wire.StartPort]
+	if v.Type == nil {
+		return FlowType{Kind: FSKindAny}
+	}
+	return itemTypeOf(*v.Type)
+}
+
+// Offers the item's fields as columns, keeping the selected column if it's
+// still there.
+func (a *FilterAction) updateColumns(itemType FlowType) {
+	a.Columns = Choice{}
+	if itemType.Kind != FSKindRecord {
+		return
+	}
+	for _, f := range itemType.Fields {
+		a.Columns.Options = append(a.Columns.Options, ChoiceOption{Name: f.Name, Value: f.Name})
+	}
+	if a.Column == "" && len(itemType.Fields) > 0 {
+		a.Column = itemType.Fields[0].Name
+	}
+	a.Columns.SelectByValue(a.Column)
+}
+
+// The condition as an expression, e.g. `size > 10MB`. The quick modes check
+// the selected column of records, or the item itself otherwise.
+func (a *FilterAction) Expression(itemType FlowType) (string, error) {
+	mode := a.Mode.GetSelectedOption().Value.(string)
+	if mode == FilterExpression {
+		if a.Expr == "" {
+			return "", errors.New("an expression is required")
+		}
+		return a.Expr, nil
+	}
+
+	subject, subjectType, column := "item", itemType, ""
+	if itemType.Kind == FSKindRecord {
+		column = a.Column
+		if column == "" && len(itemType.Fields) > 0 {
+			// No column could be chosen before the items' type was known.
+			column = itemType.Fields[0].Name
+		}
+		i := slices.IndexFunc(itemType.Fields, func(f FlowField) bool { return f.Name == column })
+		if i < 0 {
+			return "", fmt.Errorf("no column %q", column)
+		}
+		subject, subjectType = quoteExprName(column), *itemType.Fields[i].Type
+	}
+	if mode == FilterNonEmpty {
+		return fmt.Sprintf("not empty(%s)", subject), nil
+	}
+
+	op := a.Op.GetSelectedOption().Value.(string)
+	if _, ok := exprFuncs[op]; ok && !isExprString(subjectType) {
+		// contains, startsWith, and endsWith
+		if column == "" {
+			return "", fmt.Errorf("%s needs text items, not %s", a.Op.GetSelectedOption().Name, exprTypeName(subjectType))
+		}
+		return "", fmt.Errorf("%s needs a text column, but %q is %s", a.Op.GetSelectedOption().Name, column, exprTypeName(subjectType))
+	}
+	switch {
+	case isExprString(subjectType):
+		if _, ok := exprFuncs[op]; ok {
+			return fmt.Sprintf("%s(%s, %s)", op, subject, quoteExprString(a.Value)), nil
+		}
+		return fmt.Sprintf("%s %s %s", subject, op, quoteExprString(a.Value)), nil
+	case isExprTimestamp(subjectType):
+		return fmt.Sprintf("%s %s date(%s)", subject, op, quoteExprString(a.Value)), nil
+	default:
+		// The value is an expression of its own, like 10MB. Check it alone so
+		// that errors point at the right character.
+		if _, err := ParseExpr(a.Value); err != nil {
+			return "", fmt.Errorf("value: %w", err)
+		}
+		return fmt.Sprintf("%s %s (%s)", subject, op, a.Value), nil
+	}
+}
+
+// Call after the mode changes. Switching from a quick mode to the Expression
+// mode starts the expression from the quick mode's condition, so it can be
+// tweaked from there.
+func (a *FilterAction) ModeChanged(n *Node, before string) {
+	if a.Expr != "" || a.Mode.GetSelectedOption().Value != FilterExpression {
+		return
+	}
+	quick := *a
+	quick.Mode.SelectByValue(before)
+	if expr, err := quick.Expression(itemTypeOf(n.InputPorts[0].Type)); err == nil {
+		a.Expr = expr
+	}
+}
+
+// Compiles the condition for items of the given type.
+func (a *FilterAction) Condition(itemType FlowType) (*Expr, error) {
+	src, err := a.Expression(itemType)
+	if err != nil {
+		return nil, err
+	}
+	cond, err := CompileExpr(src, ItemExprVars(itemType))
+	if err != nil {
+		return nil, err
+	}
+	if !isExprBool(cond.Type) {
+		return nil, exprErrorf(src, exprStart(cond.root), "the condition should be true or false, but is %s", exprTypeName(cond.Type))
+	}
+	return cond, nil
+}
+
+func (a *FilterAction) Run(ctx context.Context, g *Graph, n *Node) <-chan NodeActionResult {
+	done := make(chan NodeActionResult)
+
+	go func() {
+		var res NodeActionResult
+		defer func() { done <- res }()
+		defer RecoverPanic(&res)
+
+		input, ok, err := n.GetInputValue(g, 0)
+		if !ok {
+			res.Err = errors.New("an input node is required")
+			return
+		}
+		if err != nil {
+			res.Err = err
+			return
+		}
+
+		var length int
+		switch input.Type.Kind {
+		case FSKindList:
+			length = len(input.ListValue)
+		case FSKindTable:
+			length = len(input.TableValue)
+		default:
+			res.Err = fmt.Errorf("can only filter lists or tables, not %s", input.Type)
+			return
+		}
+		itemType := itemTypeOf(*input.Type)
+		cond, err := a.Condition(itemType)
+		if err != nil {
+			res.Err = err
+			return
+		}
+
+		kept := FlowValue{Type: input.Type}
+		for i := range length {
+			if err := ctx.Err(); err != nil {
+				res.Err = err
+				return
+			}
+			item := FlowValue{Type: &itemType}
+			if input.Type.Kind == FSKindTable {
+				item.RecordValue = input.TableValue[i]
+			} else {
+				item = input.ListValue[i]
+			}
+			keep, err := cond.EvalBool(ItemExprValues(item))
+			if err != nil {
+				res.Err = fmt.Errorf("item %d: %w", i, err)
+				return
+			}
+			if !keep {
+				continue
+			}
+			if input.Type.Kind == FSKindTable {
+				kept.TableValue = append(kept.TableValue, input.TableValue[i])
+			} else {
+				kept.ListValue = append(kept.ListValue, input.ListValue[i])
+			}
+		}
+		res = NodeActionResult{
+			Outputs: []FlowValue{kept},
+		}
+	}()
+
+	return done
+}
+
+func (a *FilterAction) Serialize(s *Serializer) bool {
+	SChoice(s.Key("mode"), &a.Mode, filterModeOptions)
+	SStr(s.Key("column"), &a.Column)
+	SChoice(s.Key("op"), &a.Op, filterOpOptions)
+	SStr(s.Key("value"), &a.Value)
+	SStr(s.Key("expr"), &a.Expr)
+	return s.Ok()
+}
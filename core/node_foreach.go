@@ -0,0 +1,256 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/bvisness/flowshell/util"
+)
+
+// Runs a subgraph once for each item of a list, or each row of a table, and
+// collects the results. The subgraph's inputs are the item and its index, and
+// its one output is collected into a list, or into a table if it is a record.
+// This lets any node work on lists without special support.
+//
+// GEN:NodeAction
+type ForEachAction struct {
+	Subgraph
+	Concurrency int // How many items to run at once. Use SetConcurrency to change it.
+}
+
+const DefaultForEachConcurrency = 4
+
+// Changes how many items to run at once. Runs that have already started keep
+// the old setting.
+func (a *ForEachAction) SetConcurrency(concurrency int) {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+	a.Concurrency = max(concurrency, 1)
+}
+
+func NewForEachNode() *Node {
+	inputs := NewSubgraphInputsNode()
+	inputs.OutputPorts = []NodePort{
+		{Name: "Item", Type: FlowType{Kind: FSKindAny}},
+		{Name: "Index", Type: FlowType{Kind: FSKindInt64}},
+	}
+	outputs := NewSubgraphOutputsNode()
+	outputs.InputPorts = []NodePort{{Name: "Result", Type: FlowType{Kind: FSKindAny}}}
+	outputs.Pos = V2{X: 450}
+
+	inner := NewGraph()
+	inner.AddNode(inputs)
+	inner.AddNode(outputs)
+
+	return &Node{
+		Name: "For Each",
+
+		InputPorts: []NodePort{{
+			Name: "Items",
+			Type: NewListType(FlowType{Kind: FSKindAny}),
+		}},
+		OutputPorts: []NodePort{{
+			Name: "Results",
+			Type: NewListType(FlowType{Kind: FSKindAny}),
+		}},
+
+		Action: &ForEachAction{
+			Subgraph:    Subgraph{Inner: inner},
+			Concurrency: DefaultForEachConcurrency,
+		},
+	}
+}
+
+var _ SubgraphAction = &ForEachAction{}
+var _ InputTypeChecker = &ForEachAction{}
+var _ CachePolicy = &ForEachAction{}
+var _ WatchedAction = &ForEachAction{}
+
+func (a *ForEachAction) UpdateAndValidate(g *Graph, n *Node) {
+	n.Valid = true
+
+	itemType := FlowType{Kind: FSKindAny}
+	if wire, hasWire := n.GetInputWire(g, 0); hasWire {
+		n.InputPorts[0].Type = wire.Type()
+		if t := wire.Type(); t.ContainedType != nil && (t.Kind == FSKindList || t.Kind == FSKindTable) {
+			itemType = *t.ContainedType
+		}
+	} else {
+		n.InputPorts[0].Type = NewListType(FlowType{Kind: FSKindAny})
+		n.Valid = false
+	}
+
+	// The item's type flows into the subgraph, and the result's type flows
+	// back out.
+	inputs, hasInputs := a.inputsNode()
+	if hasInputs && len(inputs.OutputPorts) > 0 {
+		inputs.OutputPorts[0].Type = itemType
+	}
+	if !a.validateLocked() {
+		n.Valid = false
+	}
+	outputs, hasOutputs := a.outputsNode()
+	if !hasInputs || !hasOutputs || len(outputs.InputPorts) != 1 {
+		n.Valid = false
+		n.OutputPorts[0].Type = NewListType(FlowType{Kind: FSKindAny})
+	} else {
+		n.OutputPorts[0].Type = collectedType(outputs.InputPorts[0].Type)
+	}
+}
+
+func (a *ForEachAction) CheckInputType(n *Node, port int, t FlowType) error {
+	return checkItemsType(t)
+}
+
+// Results are collected into a table if they are records, and a list
+// otherwise.
+func collectedType(result FlowType) FlowType {
+	if result.Kind == FSKindRecord {
+		return FlowType{Kind: FSKindTable, ContainedType: &result}
+	}
+	return NewListType(result)
+}
+
+func (a *ForEachAction) Run(ctx context.Context, g *Graph, n *Node) <-chan NodeActionResult {
+	done := make(chan NodeActionResult)
+	schedulerMu.Lock()
+	concurrency := a.Concurrency
+	schedulerMu.Unlock()
+
+	go func() {
+		var res NodeActionResult
+		defer func() { done <- res }()
+		defer RecoverPanic(&res)
+
+		input, ok, err := n.GetInputValue(g, 0)
+		if !ok {
+			res.Err = errors.New("an input node is required")
+			return
+		}
+		if err != nil {
+			res.Err = err
+			return
+		}
+
+		items := input.ListValue
+		if input.Type.Kind == FSKindTable {
+			items = util.Map(input.TableValue, func(row []FlowValueField) FlowValue {
+				return FlowValue{Type: input.Type.ContainedType, RecordValue: row}
+			})
+		}
+
+		// Each run of the subgraph gets a copy of it, since nodes only hold
+		// one result at a time.
+		first, err := CloneGraph(a.Inner)
+		if err != nil {
+			res.Err = err
+			return
+		}
+		scope := fmt.Sprintf("%s (#%d)", n.Name, n.ID)
+		results, err := runEach(ctx, g, scope, first, items, concurrency)
+		if err != nil {
+			res.Err = err
+			return
+		}
+
+		resultType := FlowType{Kind: FSKindAny}
+		if len(results) > 0 {
+			resultType = *results[0].Type
+		} else if outputs, ok := findNode[*SubgraphOutputsAction](first); ok && len(outputs.InputPorts) > 0 {
+			resultType = outputs.InputPorts[0].Type
+		}
+		collected := collectedType(resultType)
+		res.Outputs = []FlowValue{{Type: &collected}}
+		if collected.Kind == FSKindTable {
+			res.Outputs[0].TableValue = util.Map(results, func(v FlowValue) []FlowValueField { return v.RecordValue })
+		} else {
+			res.Outputs[0].ListValue = results
+		}
+	}()
+
+	return done
+}
+
+// Runs the subgraph for each item, with up to concurrency items at a time.
+// Stops at the first error. Trace events go to parent, with each copy of the
+// subgraph in its own scope.
+func runEach(ctx context.Context, parent *Graph, scope string, first *Graph, items []FlowValue, concurrency int) ([]FlowValue, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	graphs := []*Graph{first}
+	for len(graphs) < min(max(concurrency, 1), len(items)) {
+		g, err := CloneGraph(first)
+		if err != nil {
+			return nil, err
+		}
+		graphs = append(graphs, g)
+	}
+	for i, g := range graphs {
+		g.forwardTraceEvents(parent, util.Tern(len(graphs) > 1, fmt.Sprintf("%s [%d]", scope, i+1), scope))
+	}
+
+	results := make([]FlowValue, len(items))
+	var firstErr error
+	var errOnce sync.Once
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for _, g := range graphs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				outputs, err := runSubgraph(ctx, g, []FlowValue{items[i], NewInt64Value(int64(i), 0)})
+				if err == nil && len(outputs) != 1 {
+					err = fmt.Errorf("expected one output, but got %d", len(outputs))
+				}
+				if err != nil {
+					fail(fmt.Errorf("item %d: %w", i, err))
+					continue
+				}
+				results[i] = outputs[0]
+			}
+		}()
+	}
+feed:
+	for i := range items {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (a *ForEachAction) CacheKey(n *Node) ([]byte, bool) {
+	return a.cacheKey()
+}
+
+func (a *ForEachAction) WatchedPaths(g *Graph, n *Node) []string {
+	return a.watchedPaths()
+}
+
+func (a *ForEachAction) Serialize(s *Serializer) bool {
+	a.serialize(s)
+	SInt(s.Key("concurrency"), &a.Concurrency)
+	return s.Ok()
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"runtime"
+
+	"github.com/bvisness/flowshell/util"
+)
+
+// GEN:NodeAction
+type LinesAction struct {
+	IncludeCarriageReturns bool
+}
+
+func NewLinesNode() *Node {
+	return &Node{
+		Name: "Lines",
+
+		InputPorts: []NodePort{{
+			Name: "Text",
+			Type: FlowType{Kind: FSKindBytes},
+		}},
+		OutputPorts: []NodePort{{
+			Name: "Lines",
+			Type: FlowType{Kind: FSKindList, ContainedType: &FlowType{Kind: FSKindBytes}},
+		}},
+
+		Action: &LinesAction{
+			IncludeCarriageReturns: runtime.GOOS == "windows",
+		},
+	}
+}
+
+var _ NodeAction = &LinesAction{}
+
+func (c *LinesAction) UpdateAndValidate(g *Graph, n *Node) {
+	n.Valid = true
+
+	if _, ok := n.GetInputWire(g, 0); !ok {
+		n.Valid = false
+	}
+}
+
+var LFSplit = regexp.MustCompile(`\n`)
+var CRLFSplit = regexp.MustCompile(`\r?\n`)
+
+func (l *LinesAction) Run(ctx context.Context, g *Graph, n *Node) <-chan NodeActionResult {
+	done := make(chan NodeActionResult)
+
+	go func() {
+		var res NodeActionResult
+		defer func() { done <- res }()
+		defer RecoverPanic(&res)
+
+		text, ok, err := n.GetInputValue(g, 0)
+		if !ok {
+			panic(fmt.Errorf("node %s: no text input, should have been caught by validation", n))
+		}
+		if err != nil {
+			res.Err = err
+			return
+		}
+		linesStrs := util.Tern(l.IncludeCarriageReturns, CRLFSplit, LFSplit).Split(string(text.BytesValue), -1)
+		lines := util.Map(linesStrs, func(line string) FlowValue { return NewStringValue(line) })
+
+		res = NodeActionResult{
+			Outputs: []FlowValue{{
+				Type:      &FlowType{Kind: FSKindList, ContainedType: &FlowType{Kind: FSKindBytes}},
+				ListValue: lines,
+			}},
+		}
+	}()
+
+	return done
+}
+
+func (n *LinesAction) Serialize(s *Serializer) bool {
+	SBool(s.Key("includeCarriageReturns"), &n.IncludeCarriageReturns)
+	return s.Ok()
+}
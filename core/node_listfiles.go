@@ -0,0 +1,148 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/bvisness/flowshell/util"
+)
+
+// GEN:NodeAction
+type ListFilesAction struct {
+	Dir string
+}
+
+func NewListFilesNode(dir string) *Node {
+	return &Node{
+		Name: "List Files",
+
+		InputPorts: []NodePort{{
+			Name: "Directory Path",
+			Type: FlowType{Kind: FSKindBytes},
+		}},
+		OutputPorts: []NodePort{{
+			Name: "Files",
+			Type: FlowType{Kind: FSKindTable, ContainedType: FSFile},
+		}},
+
+		Action: &ListFilesAction{
+			Dir: dir,
+		},
+	}
+}
+
+var _ NodeAction = &ListFilesAction{}
+var _ CachePolicy = &ListFilesAction{}
+var _ WatchedAction = &ListFilesAction{}
+
+func (c *ListFilesAction) UpdateAndValidate(g *Graph, n *Node) {
+	n.Valid = true
+}
+
+func (c *ListFilesAction) Run(ctx context.Context, g *Graph, n *Node) <-chan NodeActionResult {
+	done := make(chan NodeActionResult)
+
+	go func() {
+		var res NodeActionResult
+		defer func() { done <- res }()
+		defer RecoverPanic(&res)
+
+		wireDir, hasWire, err := n.GetInputValue(g, 0)
+		if err != nil {
+			res.Err = err
+			return
+		}
+		entries, err := readDirContext(ctx, util.Tern(hasWire, string(wireDir.BytesValue), c.Dir))
+		if err != nil {
+			res.Err = err
+			return
+		}
+
+		var rows [][]FlowValueField
+		for _, entry := range entries {
+			if ctx.Err() != nil {
+				res.Err = ctx.Err()
+				return
+			}
+
+			info, err := entry.Info()
+			if errors.Is(err, os.ErrNotExist) {
+				// This can happen if a file was deleted since the dir was listed. Unlikely but hey.
+				continue
+			} else if err != nil {
+				res.Err = err
+				return
+			}
+
+			row := []FlowValueField{
+				{Name: "name", Value: NewStringValue(entry.Name())},
+				{Name: "type", Value: NewStringValue(util.Tern(entry.IsDir(), "dir", "file"))},
+				{Name: "size", Value: NewInt64Value(info.Size(), FSUnitBytes)},
+				{Name: "modified", Value: NewTimestampValue(info.ModTime())},
+			}
+			rows = append(rows, row)
+		}
+
+		res = NodeActionResult{
+			Outputs: []FlowValue{{
+				Type:       &FlowType{Kind: FSKindTable, ContainedType: FSFile},
+				TableValue: rows,
+			}},
+		}
+	}()
+
+	return done
+}
+
+// Like os.ReadDir, but reads in batches so that listing a huge directory can
+// be canceled partway through.
+func readDirContext(ctx context.Context, dir string) ([]os.DirEntry, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []os.DirEntry
+	for {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		batch, err := f.ReadDir(256)
+		entries = append(entries, batch...)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	slices.SortFunc(entries, func(a, b os.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
+
+func (n *ListFilesAction) Serialize(s *Serializer) bool {
+	SStr(s.Key("dir"), &n.Dir)
+	return s.Ok()
+}
+
+// A directory's modification time doesn't change when the files in it do, so
+// there's no cheap way to tell whether the listing is stale.
+func (c *ListFilesAction) CacheKey(n *Node) ([]byte, bool) {
+	return nil, false
+}
+
+func (c *ListFilesAction) WatchedPaths(g *Graph, n *Node) []string {
+	if wireDir, hasWire, err := n.GetInputValue(g, 0); hasWire {
+		if err != nil {
+			return nil
+		}
+		return []string{string(wireDir.BytesValue)}
+	}
+	return []string{c.Dir}
+}
@@ -0,0 +1,226 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bvisness/flowshell/util"
+)
+
+// GEN:NodeAction
+type LoadFileAction struct {
+	Path string
+
+	Format Choice
+
+	// TODO: In reality this should be a more complex thing. For now we will just
+	// always parse them as floats. (The "right way" to do it would be to have
+	// CSV always parse as strings, but make it clear in the UI that they are
+	// strings, and then have the user convert them to numbers. Perhaps this
+	// could be done with a "Convert to Number" node that works on single
+	// strings, lists, records, and tables. But perhaps you'd want to be able to
+	// easily apply it to specific columns of a table? Maybe implicit conversion
+	// to number would be ok within the Aggregate node and other nodes that do
+	// math? Who knows. Very large design space. For now we just demo by always
+	// parsing as float.
+	csvNumbers bool
+}
+
+var loadFileFormatOptions = []ChoiceOption{
+	{Name: "Raw bytes", Value: "raw"},
+	{Name: "CSV", Value: "csv"},
+	{Name: "JSON", Value: "json"},
+}
+
+// TODO: Make this node polymorphic on lists of strings
+// (rename to "Load Files" dynamically)
+func NewLoadFileNode(path string) *Node {
+	format := Choice{
+		Options: loadFileFormatOptions,
+	}
+
+	if ext := strings.ToLower(filepath.Ext(path)); ext != "" {
+		format.SelectByValue(ext[1:])
+	}
+
+	return &Node{
+		Name: "Load File",
+
+		InputPorts: []NodePort{{
+			Name: "Path",
+			Type: FlowType{Kind: FSKindBytes},
+		}},
+		OutputPorts: []NodePort{{
+			Name: "Data",
+			Type: FlowType{Kind: FSKindBytes},
+		}},
+
+		Action: &LoadFileAction{
+			Path:       path,
+			Format:     format,
+			csvNumbers: true,
+		},
+	}
+}
+
+var _ NodeAction = &LoadFileAction{}
+var _ CachePolicy = &LoadFileAction{}
+var _ WatchedAction = &LoadFileAction{}
+
+func (c *LoadFileAction) UpdateAndValidate(g *Graph, n *Node) {
+	switch c.Format.GetSelectedOption().Value {
+	case "raw":
+		n.OutputPorts[0].Type = FlowType{Kind: FSKindBytes}
+	case "csv":
+		n.OutputPorts[0].Type = FlowType{Kind: FSKindTable, ContainedType: &FlowType{Kind: FSKindAny}}
+	case "json":
+		n.OutputPorts[0].Type = FlowType{Kind: FSKindAny}
+	}
+
+	n.Valid = true
+}
+
+func (c *LoadFileAction) Run(ctx context.Context, g *Graph, n *Node) <-chan NodeActionResult {
+	done := make(chan NodeActionResult)
+
+	go func() {
+		var res NodeActionResult
+		defer func() { done <- res }()
+		defer RecoverPanic(&res)
+
+		content, err := readFileContext(ctx, c.Path) // TODO: Get path from port
+		if err != nil {
+			res.Err = err
+			return
+		}
+
+		switch format := c.Format.GetSelectedOption().Value; format {
+		case "raw":
+			res = NodeActionResult{
+				Outputs: []FlowValue{NewBytesValue(content)},
+			}
+		case "csv":
+			r := csv.NewReader(bytes.NewReader(content))
+			rows, err := r.ReadAll()
+			if err != nil {
+				res.Err = err
+				return
+			}
+
+			// Special case: if we don't even get a row, synthesize an empty table with no columns.
+			if len(rows) == 0 {
+				res = NodeActionResult{
+					Outputs: []FlowValue{{
+						Type: &FlowType{
+							Kind: FSKindTable,
+							ContainedType: &FlowType{
+								Kind:   FSKindRecord,
+								Fields: nil,
+							},
+						},
+					}},
+				}
+				return
+			}
+
+			tableRecordType := FlowType{Kind: FSKindRecord}
+			for _, headerField := range rows[0] {
+				tableRecordType.Fields = append(tableRecordType.Fields, FlowField{
+					Name: headerField,
+					Type: &FlowType{Kind: util.Tern(c.csvNumbers, FSKindFloat64, FSKindBytes)},
+				})
+			}
+
+			// TODO(low): Be resilient against variable numbers of fields per row, potentially
+			var tableRows [][]FlowValueField
+			for _, row := range rows[1:] {
+				if ctx.Err() != nil {
+					res.Err = ctx.Err()
+					return
+				}
+
+				var flowRow []FlowValueField
+				for col, value := range row {
+					floatVal, err := strconv.ParseFloat(value, 64)
+					if err != nil {
+						res.Err = err
+						return
+					}
+					flowRow = append(flowRow, FlowValueField{
+						Name:  rows[0][col],
+						Value: util.Tern(c.csvNumbers, NewFloat64Value(floatVal, 0), NewStringValue(value)),
+					})
+				}
+				tableRows = append(tableRows, flowRow)
+			}
+
+			res = NodeActionResult{
+				Outputs: []FlowValue{{
+					Type: &FlowType{
+						Kind:          FSKindTable,
+						ContainedType: &tableRecordType,
+					},
+					TableValue: tableRows,
+				}},
+			}
+		default:
+			res.Err = fmt.Errorf("unknown format \"%v\"", format)
+		}
+	}()
+
+	return done
+}
+
+// Like os.ReadFile, but reads in chunks so that loading a large file can be
+// canceled partway through.
+func readFileContext(ctx context.Context, path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	chunk := make([]byte, 1<<20)
+	for {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		n, err := f.Read(chunk)
+		buf.Write(chunk[:n])
+		if err == io.EOF {
+			return buf.Bytes(), nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (n *LoadFileAction) Serialize(s *Serializer) bool {
+	SStr(s.Key("path"), &n.Path)
+	SBool(s.Key("csvNumbers"), &n.csvNumbers)
+	SChoice(s.Key("format"), &n.Format, loadFileFormatOptions)
+	return s.Ok()
+}
+
+// The result depends on the file's contents, so the cache key includes its size
+// and modification time.
+func (c *LoadFileAction) CacheKey(n *Node) ([]byte, bool) {
+	info, err := os.Stat(c.Path)
+	if err != nil {
+		return nil, false
+	}
+	return fmt.Appendf(nil, "%d %d", info.Size(), info.ModTime().UnixNano()), true
+}
+
+func (c *LoadFileAction) WatchedPaths(g *Graph, n *Node) []string {
+	return []string{c.Path}
+}
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GEN:NodeAction
+type RunProcessAction struct {
+	CmdString string
+}
+
+func NewRunProcessNode(cmd string) *Node {
+	return &Node{
+		Name: "Run Process",
+
+		InputPorts: nil,
+		OutputPorts: []NodePort{
+			{
+				Name: "Stdout",
+				Type: FlowType{Kind: FSKindBytes},
+			},
+			{
+				Name: "Stderr",
+				Type: FlowType{Kind: FSKindBytes},
+			},
+			{
+				Name: "Combined Stdout/Stderr",
+				Type: FlowType{Kind: FSKindBytes},
+			},
+		},
+
+		Action: &RunProcessAction{
+			CmdString: cmd,
+		},
+	}
+}
+
+var _ NodeAction = &RunProcessAction{}
+var _ CachePolicy = &RunProcessAction{}
+
+// The state of a single run of a command. Each run gets its own, since a
+// canceled run may still be winding down when the next one starts.
+type RunProcessActionRuntimeState struct {
+	cmd *exec.Cmd
+
+	outputStreamMutex sync.Mutex
+
+	stdout   []byte
+	stderr   []byte
+	combined []byte
+
+	err      error
+	exitCode int
+}
+
+func (c *RunProcessAction) UpdateAndValidate(g *Graph, n *Node) {
+	n.Valid = true
+}
+
+func (c *RunProcessAction) Run(ctx context.Context, g *Graph, n *Node) <-chan NodeActionResult {
+	pieces := strings.Split(c.CmdString, " ")
+	cmd := exec.CommandContext(ctx, pieces[0], pieces[1:]...)
+	// Once the process is killed, don't wait forever for any children that
+	// inherited its output pipes; retries wait for this run to finish.
+	cmd.WaitDelay = time.Second
+
+	done := make(chan NodeActionResult)
+
+	state := &RunProcessActionRuntimeState{
+		cmd: cmd,
+	}
+
+	cmd.Stdout = &multiSliceWriter{
+		mu: &state.outputStreamMutex,
+		a:  &state.stdout,
+		b:  &state.combined,
+	}
+	cmd.Stderr = &multiSliceWriter{
+		mu: &state.outputStreamMutex,
+		a:  &state.stderr,
+		b:  &state.combined,
+	}
+
+	go func() {
+		var res NodeActionResult
+		defer func() { done <- res }()
+		defer RecoverPanic(&res)
+
+		state.err = state.cmd.Start()
+		if state.err == nil {
+			g.traceEvent(n, TraceProcessSpawn, cmd.Process.Pid, c.CmdString)
+			state.err = state.cmd.Wait()
+			g.traceEvent(n, TraceProcessExit, cmd.Process.Pid, cmd.ProcessState.String())
+		}
+		if ctx.Err() != nil {
+			// The process was killed because we were canceled; say so instead of
+			// reporting "signal: killed".
+			state.err = ctx.Err()
+		} else if state.err != nil {
+			// TODO: Extract exit code
+		}
+
+		res = NodeActionResult{
+			Err: state.err,
+			Outputs: []FlowValue{
+				{
+					Type:       &FlowType{Kind: FSKindBytes},
+					BytesValue: state.stdout,
+				},
+				{
+					Type:       &FlowType{Kind: FSKindBytes},
+					BytesValue: state.stderr,
+				},
+				{
+					Type:       &FlowType{Kind: FSKindBytes},
+					BytesValue: state.combined,
+				},
+			},
+		}
+	}()
+
+	return done
+}
+
+func (n *RunProcessAction) Serialize(s *Serializer) bool {
+	SStr(s.Key("cmd"), &n.CmdString)
+	return s.Ok()
+}
+
+// Processes can do anything, so they always run.
+func (c *RunProcessAction) CacheKey(n *Node) ([]byte, bool) {
+	return nil, false
+}
@@ -0,0 +1,202 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+)
+
+// GEN:NodeAction
+type SaveFileAction struct {
+	Path   string
+	Format Choice
+}
+
+func NewSaveFileNode(path string) *Node {
+	format := Choice{
+		Options: saveFileFormatOptions,
+	}
+
+	return &Node{
+		Name: "Save File",
+
+		InputPorts: []NodePort{
+			{
+				Name: "Path",
+				Type: FlowType{Kind: FSKindBytes},
+			},
+			{
+				Name: "Data",
+				Type: FlowType{Kind: FSKindAny},
+			},
+		},
+		OutputPorts: []NodePort{{
+			Name: "Data",
+			Type: FlowType{Kind: FSKindAny},
+		}},
+
+		Action: &SaveFileAction{
+			Path:   path,
+			Format: format,
+		},
+	}
+}
+
+var saveFileFormatOptions = []ChoiceOption{
+	{Name: "Raw bytes", Value: "raw"},
+	{Name: "CSV", Value: "csv"},
+	{Name: "JSON", Value: "json"},
+}
+
+var _ NodeAction = &SaveFileAction{}
+var _ CachePolicy = &SaveFileAction{}
+
+func (c *SaveFileAction) UpdateAndValidate(g *Graph, n *Node) {
+	n.Valid = true
+
+	data, dataWired := n.GetInputWire(g, 1)
+	if dataWired {
+		n.OutputPorts[0].Type = data.Type()
+	} else {
+		n.OutputPorts[0].Type = FlowType{Kind: FSKindAny}
+		n.Valid = false
+	}
+}
+
+func (c *SaveFileAction) Run(ctx context.Context, g *Graph, n *Node) <-chan NodeActionResult {
+	done := make(chan NodeActionResult)
+
+	go func() {
+		var res NodeActionResult
+		defer func() { done <- res }()
+		defer RecoverPanic(&res)
+
+		data, ok, err := n.GetInputValue(g, 1)
+		if !ok {
+			panic("should have had input data due to validation")
+		}
+		if err != nil {
+			res.Err = err
+			return
+		}
+
+		primitiveValueToBytes := func(v FlowValue) ([]byte, error) {
+			switch v.Type.Kind {
+			case FSKindBytes:
+				return v.BytesValue, nil
+			case FSKindInt64:
+				return []byte(fmt.Sprintf("%v", v.Int64Value)), nil
+			case FSKindFloat64:
+				return []byte(fmt.Sprintf("%v", v.Float64Value)), nil
+			default:
+				return nil, fmt.Errorf("cannot write type %s as raw bytes - use another format like CSV instead", v.Type)
+			}
+		}
+
+		var outputBytes []byte
+		switch format := c.Format.GetSelectedOption().Value; format {
+		case "raw":
+			var err error
+			outputBytes, err = primitiveValueToBytes(data)
+			if err != nil {
+				res.Err = err
+				return
+			}
+		case "csv":
+			var buf bytes.Buffer
+			w := csv.NewWriter(&buf)
+			switch data.Type.Kind {
+			case FSKindBytes, FSKindInt64, FSKindFloat64:
+				prim, err := primitiveValueToBytes(data)
+				if err != nil {
+					res.Err = err
+					return
+				}
+				w.Write([]string{string(prim)})
+			case FSKindList:
+				// one line per value
+				for _, v := range data.ListValue {
+					prim, err := primitiveValueToBytes(v)
+					if err != nil {
+						res.Err = err
+						return
+					}
+					w.Write([]string{string(prim)})
+				}
+			case FSKindRecord:
+				var headers []string
+				var values []string
+				for _, f := range data.RecordValue {
+					prim, err := primitiveValueToBytes(f.Value)
+					if err != nil {
+						res.Err = err
+						return
+					}
+
+					headers = append(headers, f.Name)
+					values = append(values, string(prim))
+				}
+				w.Write(headers)
+				w.Write(values)
+			case FSKindTable:
+				var headers []string
+				for _, f := range data.Type.ContainedType.Fields {
+					headers = append(headers, f.Name)
+				}
+				w.Write(headers)
+
+				for _, row := range data.TableValue {
+					var values []string
+					for _, v := range row {
+						prim, err := primitiveValueToBytes(v.Value)
+						if err != nil {
+							res.Err = err
+							return
+						}
+						values = append(values, string(prim))
+					}
+					w.Write(values)
+				}
+			default:
+				res.Err = fmt.Errorf("can't convert type %s to CSV", data.Type)
+				return
+			}
+
+			w.Flush()
+			outputBytes = buf.Bytes()
+		default:
+			res.Err = fmt.Errorf("unknown format \"%v\"", format)
+			return
+		}
+
+		if ctx.Err() != nil {
+			res.Err = ctx.Err()
+			return
+		}
+
+		err = os.WriteFile(c.Path, outputBytes, 0666) // TODO: get path from port
+		if err != nil {
+			res.Err = err
+			return
+		}
+
+		res = NodeActionResult{
+			Outputs: []FlowValue{data},
+		}
+	}()
+
+	return done
+}
+
+func (n *SaveFileAction) Serialize(s *Serializer) bool {
+	SStr(s.Key("path"), &n.Path)
+	SChoice(s.Key("format"), &n.Format, saveFileFormatOptions)
+	return s.Ok()
+}
+
+// Saving a file is the whole point, so it always runs.
+func (c *SaveFileAction) CacheKey(n *Node) ([]byte, bool) {
+	return nil, false
+}
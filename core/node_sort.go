@@ -0,0 +1,352 @@
+package core
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Sorts a list, or the rows of a table, by one or more keys. Later keys break
+// ties in earlier ones, and items that tie on every key keep their order.
+//
+// GEN:NodeAction
+type SortAction struct {
+	Keys []SortKey
+
+	// Why the keys don't work with the input, if they don't. Set by
+	// UpdateAndValidate.
+	Err error
+}
+
+type SortKey struct {
+	Column string // The column to sort by, for records
+	Order  Choice
+
+	// The columns to choose from, for the editor. Rebuilt from the input's
+	// type by UpdateAndValidate.
+	Columns Choice
+}
+
+const (
+	SortAscending  = "ascending"
+	SortDescending = "descending"
+)
+
+var sortOrderOptions = []ChoiceOption{
+	{Name: "Ascending", Value: SortAscending},
+	{Name: "Descending", Value: SortDescending},
+}
+
+func NewSortNode() *Node {
+	return &Node{
+		Name: "Sort",
+
+		InputPorts: []NodePort{{
+			Name: "Items",
+			Type: NewListType(FlowType{Kind: FSKindAny}),
+		}},
+		OutputPorts: []NodePort{{
+			Name: "Sorted",
+			Type: NewListType(FlowType{Kind: FSKindAny}),
+		}},
+
+		Action: &SortAction{
+			Keys: []SortKey{newSortKey("")},
+		},
+	}
+}
+
+func newSortKey(column string) SortKey {
+	return SortKey{
+		Column: column,
+		Order:  Choice{Options: sortOrderOptions},
+	}
+}
+
+var _ NodeAction = &SortAction{}
+var _ InputTypeChecker = &SortAction{}
+
+// Adds another key to the end, preferring a column that isn't sorted by yet.
+func (a *SortAction) AddKey(g *Graph, n *Node) {
+	var column string
+	if len(a.Keys) > 0 {
+		for _, opt := range a.Keys[0].Columns.Options {
+			used := slices.ContainsFunc(a.Keys, func(k SortKey) bool { return k.Column == opt.Value })
+			if !used {
+				column = opt.Value.(string)
+				break
+			}
+		}
+	}
+	a.Keys = append(a.Keys, newSortKey(column))
+	n.MarkChanged(g)
+}
+
+// Removes the last key. The node always keeps at least one key.
+func (a *SortAction) RemoveKey(g *Graph, n *Node) {
+	if len(a.Keys) <= 1 {
+		return
+	}
+	a.Keys = a.Keys[:len(a.Keys)-1]
+	n.MarkChanged(g)
+}
+
+func (a *SortAction) UpdateAndValidate(g *Graph, n *Node) {
+	n.Valid = true
+	a.Err = nil
+
+	wire, hasWire := n.GetInputWire(g, 0)
+	if !hasWire {
+		n.InputPorts[0].Type = NewListType(FlowType{Kind: FSKindAny})
+		n.OutputPorts[0].Type = NewListType(FlowType{Kind: FSKindAny})
+		a.updateColumns(FlowType{Kind: FSKindAny})
+		n.Valid = false
+		return
+	}
+
+	// The sorted items have the same type as the input.
+	n.InputPorts[0].Type = wire.Type()
+	n.OutputPorts[0].Type = wire.Type()
+
+	itemType := itemTypeOf(wire.Type())
+	if itemType.Kind == FSKindAny {
+		// Catch it at runtime, but offer the columns of the last result, e.g.
+		// for CSV files, whose columns come from their header.
+		a.updateColumns(lastItemType(wire))
+		return
+	}
+	a.updateColumns(itemType)
+	if _, err := a.keyColumns(itemType); err != nil {
+		a.Err = err
+		n.Valid = false
+	}
+}
+
+func (a *SortAction) CheckInputType(n *Node, port int, t FlowType) error {
+	return checkItemsType(t)
+}
+
+func (a *SortAction) updateColumns(itemType FlowType) {
+	for i := range a.Keys {
+		k := &a.Keys[i]
+		k.Columns = Choice{}
+		if itemType.Kind != FSKindRecord {
+			continue
+		}
+		for _, f := range itemType.Fields {
+			k.Columns.Options = append(k.Columns.Options, ChoiceOption{Name: f.Name, Value: f.Name})
+		}
+		if k.Column == "" && len(itemType.Fields) > 0 {
+			k.Column = itemType.Fields[0].Name
+		}
+		k.Columns.SelectByValue(k.Column)
+	}
+}
+
+// The index of each key's column in records of the given type, or -1 for
+// keys that sort by the item itself.
+func (a *SortAction) keyColumns(itemType FlowType) ([]int, error) {
+	cols := make([]int, len(a.Keys))
+	for i, k := range a.Keys {
+		cols[i] = -1
+		keyType := itemType
+		column := k.Column
+		if itemType.Kind == FSKindRecord {
+			if column == "" && len(itemType.Fields) > 0 {
+				// No column could be chosen before the items' type was known.
+				column = itemType.Fields[0].Name
+			}
+			cols[i] = slices.IndexFunc(itemType.Fields, func(f FlowField) bool { return f.Name == column })
+			if cols[i] < 0 {
+				return nil, fmt.Errorf("no column %q", column)
+			}
+			keyType = *itemType.Fields[cols[i]].Type
+		}
+		if err := checkSortable(keyType); err != nil {
+			if cols[i] >= 0 {
+				return nil, fmt.Errorf("column %q: %w", column, err)
+			}
+			return nil, err
+		}
+	}
+	return cols, nil
+}
+
+// Strings, numbers, timestamps, and bools can be sorted. Any is allowed since
+// it can only be checked once the values are known.
+func checkSortable(t FlowType) error {
+	switch t.Kind {
+	case FSKindBytes, FSKindInt64, FSKindFloat64, FSKindAny:
+		return nil
+	default:
+		return fmt.Errorf("cannot sort by %s", t)
+	}
+}
+
+func (a *SortAction) Run(ctx context.Context, g *Graph, n *Node) <-chan NodeActionResult {
+	done := make(chan NodeActionResult)
+
+	go func() {
+		var res NodeActionResult
+		defer func() { done <- res }()
+		defer RecoverPanic(&res)
+
+		input, ok, err := n.GetInputValue(g, 0)
+		if !ok {
+			res.Err = errors.New("an input node is required")
+			return
+		}
+		if err != nil {
+			res.Err = err
+			return
+		}
+
+		var items []FlowValue
+		switch input.Type.Kind {
+		case FSKindList:
+			items = input.ListValue
+		case FSKindTable:
+			items = make([]FlowValue, len(input.TableValue))
+			for i, row := range input.TableValue {
+				items[i] = FlowValue{Type: input.Type.ContainedType, RecordValue: row}
+			}
+		default:
+			res.Err = fmt.Errorf("can only sort lists or tables, not %s", input.Type)
+			return
+		}
+		cols, err := a.keyColumns(itemTypeOf(*input.Type))
+		if err != nil {
+			res.Err = err
+			return
+		}
+
+		// Gather the keys up front, so that their types are only checked once.
+		keys := make([][]FlowValue, len(items))
+		for i, item := range items {
+			keys[i] = make([]FlowValue, len(cols))
+			for k, col := range cols {
+				v := item
+				if col >= 0 {
+					v = item.RecordValue[col].Value
+				}
+				if err := checkSortable(*v.Type); err != nil {
+					res.Err = fmt.Errorf("item %d: %w", i, err)
+					return
+				}
+				keys[i][k] = v
+			}
+		}
+		descending := make([]bool, len(a.Keys))
+		for k, key := range a.Keys {
+			descending[k] = key.Order.GetSelectedOption().Value == SortDescending
+		}
+
+		order := make([]int, len(items))
+		for i := range order {
+			order[i] = i
+		}
+		slices.SortStableFunc(order, func(i, j int) int {
+			for k := range cols {
+				c := compareSortValues(keys[i][k], keys[j][k])
+				if descending[k] {
+					c = -c
+				}
+				if c != 0 {
+					return c
+				}
+			}
+			return 0
+		})
+		if err := ctx.Err(); err != nil {
+			res.Err = err
+			return
+		}
+
+		sorted := FlowValue{Type: input.Type}
+		for _, i := range order {
+			if input.Type.Kind == FSKindTable {
+				sorted.TableValue = append(sorted.TableValue, input.TableValue[i])
+			} else {
+				sorted.ListValue = append(sorted.ListValue, input.ListValue[i])
+			}
+		}
+		res = NodeActionResult{
+			Outputs: []FlowValue{sorted},
+		}
+	}()
+
+	return done
+}
+
+// Compares two sortable values. Strings sort naturally, and numbers of
+// different kinds are compared by value. Values of different kinds, which
+// only happen in lists of Any, are ordered by kind.
+func compareSortValues(x, y FlowValue) int {
+	switch {
+	case x.Type.Kind == FSKindBytes && y.Type.Kind == FSKindBytes:
+		if c := compareNatural(x.BytesValue, y.BytesValue); c != 0 {
+			return c
+		}
+		// Keep strings that only differ in case or leading zeros in a
+		// consistent order.
+		return bytes.Compare(x.BytesValue, y.BytesValue)
+	case x.Type.Kind == FSKindInt64 && y.Type.Kind == FSKindInt64:
+		return cmp.Compare(x.Int64Value, y.Int64Value)
+	case isExprNumber(*x.Type) && isExprNumber(*y.Type):
+		return cmp.Compare(exprFloat(x), exprFloat(y))
+	default:
+		return cmp.Compare(x.Type.Kind, y.Type.Kind)
+	}
+}
+
+// Compares strings the way people expect, so that "file2" comes before
+// "file10": runs of digits are compared as numbers, and letters are compared
+// without regard to case.
+func compareNatural(a, b []byte) int {
+	for len(a) > 0 && len(b) > 0 {
+		if isExprDigit(a[0]) && isExprDigit(b[0]) {
+			na, nb := digitRun(a), digitRun(b)
+			da, db := bytes.TrimLeft(a[:na], "0"), bytes.TrimLeft(b[:nb], "0")
+			if c := cmp.Compare(len(da), len(db)); c != 0 {
+				return c
+			}
+			if c := bytes.Compare(da, db); c != 0 {
+				return c
+			}
+			a, b = a[na:], b[nb:]
+			continue
+		}
+
+		ra, sa := utf8.DecodeRune(a)
+		rb, sb := utf8.DecodeRune(b)
+		if c := cmp.Compare(unicode.ToLower(ra), unicode.ToLower(rb)); c != 0 {
+			return c
+		}
+		a, b = a[sa:], b[sb:]
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+func digitRun(s []byte) int {
+	n := 0
+	for n < len(s) && isExprDigit(s[n]) {
+		n++
+	}
+	return n
+}
+
+func (a *SortAction) Serialize(s *Serializer) bool {
+	SSlice(s.Key("keys"), &a.Keys)
+	return s.Ok()
+}
+
+func (k *SortKey) Serialize(s *Serializer) bool {
+	SStr(s.Key("column"), &k.Column)
+	SChoice(s.Key("order"), &k.Order, sortOrderOptions)
+	return s.Ok()
+}
@@ -0,0 +1,111 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"github.com/bvisness/flowshell/util"
+)
+
+// GEN:NodeAction
+type TrimSpacesAction struct{}
+
+func NewTrimSpacesNode() *Node {
+	return &Node{
+		Name: "Trim Spaces",
+
+		InputPorts: []NodePort{{
+			Name: "Text",
+			Type: FlowType{Kind: FSKindBytes},
+		}},
+		OutputPorts: []NodePort{{
+			Name: "Trimmed",
+			Type: FlowType{Kind: FSKindBytes},
+		}},
+
+		Action: &TrimSpacesAction{},
+	}
+}
+
+var _ NodeAction = &TrimSpacesAction{}
+var _ InputTypeChecker = &TrimSpacesAction{}
+
+func (c *TrimSpacesAction) UpdateAndValidate(g *Graph, n *Node) {
+	n.Valid = true
+
+	wire, hasWire := n.GetInputWire(g, 0)
+	if hasWire && Typecheck(wire.Type(), NewListType(FlowType{Kind: FSKindBytes})) == nil {
+		n.InputPorts[0] = NodePort{
+			Name: "Text items",
+			Type: NewListType(FlowType{Kind: FSKindBytes}),
+		}
+		n.OutputPorts[0] = NodePort{
+			Name: "Trimmed",
+			Type: NewListType(FlowType{Kind: FSKindBytes}),
+		}
+	} else {
+		n.InputPorts[0] = NodePort{
+			Name: "Text",
+			Type: FlowType{Kind: FSKindBytes},
+		}
+		n.OutputPorts[0] = NodePort{
+			Name: "Trimmed",
+			Type: FlowType{Kind: FSKindBytes},
+		}
+	}
+
+	if !hasWire {
+		n.Valid = false
+	}
+}
+
+// Trims either a single piece of text or a list of them; the ports change type
+// to match.
+func (c *TrimSpacesAction) CheckInputType(n *Node, port int, t FlowType) error {
+	if Typecheck(t, NewListType(FlowType{Kind: FSKindBytes})) == nil {
+		return nil
+	}
+	return checkWireType(t, FlowType{Kind: FSKindBytes})
+}
+
+func (l *TrimSpacesAction) Run(ctx context.Context, g *Graph, n *Node) <-chan NodeActionResult {
+	done := make(chan NodeActionResult)
+
+	go func() {
+		var res NodeActionResult
+		defer func() { done <- res }()
+		defer RecoverPanic(&res)
+
+		input, ok, err := n.GetInputValue(g, 0)
+		if !ok {
+			res.Err = errors.New("an input node is required")
+			return
+		}
+		if err != nil {
+			res.Err = err
+			return
+		}
+
+		if input.Type.Kind == FSKindBytes {
+			res = NodeActionResult{
+				Outputs: []FlowValue{NewBytesValue(bytes.TrimSpace(input.BytesValue))},
+			}
+		} else {
+			res = NodeActionResult{
+				Outputs: []FlowValue{NewListValue(
+					FlowType{Kind: FSKindBytes},
+					util.Map(input.ListValue, func(fv FlowValue) FlowValue {
+						return NewBytesValue(bytes.TrimSpace(fv.BytesValue))
+					}),
+				)},
+			}
+		}
+	}()
+
+	return done
+}
+
+func (n *TrimSpacesAction) Serialize(s *Serializer) bool {
+	return s.Ok()
+}
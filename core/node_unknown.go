@@ -0,0 +1,37 @@
+package core
+
+import (
+	"context"
+	"fmt"
+)
+
+// A node whose type this build of Flowshell doesn't know, e.g. because the
+// file came from a newer version. Its configuration and ports are kept as-is
+// so that saving the graph doesn't lose anything, but it cannot run.
+//
+// This is deliberately not marked for go:generate, since it cannot be created
+// from the UI.
+type UnknownAction struct {
+	tag  string
+	data OpaqueData
+}
+
+var _ NodeAction = &UnknownAction{}
+
+func (a *UnknownAction) Tag() string {
+	return a.tag
+}
+
+func (a *UnknownAction) UpdateAndValidate(g *Graph, n *Node) {
+	n.Valid = false
+}
+
+func (a *UnknownAction) Run(ctx context.Context, g *Graph, n *Node) <-chan NodeActionResult {
+	done := make(chan NodeActionResult, 1)
+	done <- NodeActionResult{Err: fmt.Errorf("cannot run unknown node type \"%s\"; it may be from a newer version of Flowshell", a.tag)}
+	return done
+}
+
+func (a *UnknownAction) Serialize(s *Serializer) bool {
+	return SRest(s, &a.data)
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// How the scheduler runs a node's action. The zero value runs it once, for as
+// long as it takes.
+type RunPolicy struct {
+	Timeout     time.Duration // How long each attempt may take. Zero means no limit.
+	MaxAttempts int           // How many times to try before giving up. Zero means one.
+	Backoff     time.Duration // How long to wait before the first retry. Doubles after each retry.
+}
+
+var _ Serializable = &RunPolicy{}
+
+func (p *RunPolicy) Serialize(s *Serializer) bool {
+	// Durations are stored in milliseconds so that they are readable in the
+	// text format.
+	timeoutMS, backoffMS := p.Timeout.Milliseconds(), p.Backoff.Milliseconds()
+	SInt(s.Key("timeoutMS"), &timeoutMS)
+	SInt(s.Key("maxAttempts"), &p.MaxAttempts)
+	SInt(s.Key("backoffMS"), &backoffMS)
+	if !s.Encode {
+		p.Timeout = time.Duration(timeoutMS) * time.Millisecond
+		p.Backoff = time.Duration(backoffMS) * time.Millisecond
+	}
+	return s.Ok()
+}
+
+// Runs the node's action according to the policy, retrying failed attempts
+// until it succeeds, runs out of attempts, or ctx is canceled.
+func (n *Node) runWithPolicy(ctx context.Context, g *Graph, policy RunPolicy) NodeActionResult {
+	backoff := policy.Backoff
+	for attempt := 1; ; attempt++ {
+		res := n.runAttempt(ctx, g, policy.Timeout)
+		if res.Err == nil || ctx.Err() != nil {
+			return res
+		}
+		if attempt >= policy.attempts() {
+			if attempt > 1 {
+				res.Err = fmt.Errorf("failed after %d attempts: %w", attempt, res.Err)
+			}
+			return res
+		}
+
+		n.Logger().Warn("Attempt failed, retrying", "attempt", attempt, "err", res.Err, "backoff", backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return NodeActionResult{Err: ctx.Err()}
+		}
+		backoff *= 2
+	}
+}
+
+// Runs the node's action once, canceling it after the timeout if there is one.
+func (n *Node) runAttempt(ctx context.Context, g *Graph, timeout time.Duration) NodeActionResult {
+	attemptCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	timedOut := func() bool {
+		return ctx.Err() == nil && attemptCtx.Err() == context.DeadlineExceeded
+	}
+
+	// Even after a timeout, wait for the action to stop (e.g. for Run Process
+	// to kill its process) so that a retry never overlaps the attempt before
+	// it.
+	res := <-n.Action.Run(attemptCtx, g, n)
+	if res.Err != nil {
+		if timedOut() {
+			res.Err = fmt.Errorf("timed out after %v: %w", timeout, context.DeadlineExceeded)
+		} else if ctx.Err() != nil {
+			res.Err = ctx.Err()
+		}
+	}
+	return res
+}
+
+func (p RunPolicy) attempts() int {
+	return max(p.MaxAttempts, 1)
+}
+
+// Describes the policy, e.g. "timeout 30s, 3 attempts, backoff 1s".
+func (p RunPolicy) String() string {
+	var bits []string
+	if p.Timeout > 0 {
+		bits = append(bits, fmt.Sprintf("timeout %v", p.Timeout))
+	}
+	if p.attempts() > 1 {
+		bits = append(bits, fmt.Sprintf("%d attempts", p.attempts()))
+		if p.Backoff > 0 {
+			bits = append(bits, fmt.Sprintf("backoff %v", p.Backoff))
+		}
+	}
+	if len(bits) == 0 {
+		return "no timeout, no retries"
+	}
+	return strings.Join(bits, ", ")
+}
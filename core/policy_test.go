@@ -0,0 +1,133 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// An action that runs until canceled, takes a while to stop, and notices if
+// two of its runs overlap.
+type slowStopAction struct {
+	countingAction
+	running    atomic.Int32
+	overlapped atomic.Bool
+}
+
+func (a *slowStopAction) Run(ctx context.Context, g *Graph, n *Node) <-chan NodeActionResult {
+	done := make(chan NodeActionResult)
+	go func() {
+		a.runs.Add(1)
+		if a.running.Add(1) > 1 {
+			a.overlapped.Store(true)
+		}
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond)
+		a.running.Add(-1)
+		done <- NodeActionResult{Err: ctx.Err()}
+	}()
+	return done
+}
+
+func TestRunPolicy(t *testing.T) {
+	t.Run("timeout", func(t *testing.T) {
+		a := newCountingNode("a", 0)
+		a.Action.(*countingAction).block = true
+		a.Policy = RunPolicy{Timeout: 20 * time.Millisecond}
+		b := newCountingNode("b", 1)
+		g := newTestGraph(t, []*Node{a, b}, []*Wire{{StartNode: a, EndNode: b}})
+
+		<-b.Run(g, false)
+		err := a.State().Result.Err
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.EqualError(t, err, "timed out after 20ms: context deadline exceeded")
+		assert.Equal(t, 0, runs(b), "downstream nodes should not run")
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		a := newCountingNode("a", 0)
+		a.Action.(*countingAction).failFirst = 2
+		a.Policy = RunPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+		g := newTestGraph(t, []*Node{a}, nil)
+
+		<-a.Run(g, false)
+		state := a.State()
+		require.NoError(t, state.Result.Err)
+		assert.Equal(t, []FlowValue{NewInt64Value(3, 0)}, state.Result.Outputs)
+		assert.Equal(t, 3, runs(a))
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		a := newCountingNode("a", 0)
+		a.Action.(*countingAction).err = errors.New("oops")
+		a.Policy = RunPolicy{MaxAttempts: 2}
+		g := newTestGraph(t, []*Node{a}, nil)
+
+		<-a.Run(g, false)
+		assert.EqualError(t, a.State().Result.Err, "failed after 2 attempts: oops")
+		assert.Equal(t, 2, runs(a))
+	})
+
+	t.Run("timeout and retry", func(t *testing.T) {
+		a := newCountingNode("a", 0)
+		a.Action.(*countingAction).block = true
+		a.Policy = RunPolicy{Timeout: 10 * time.Millisecond, MaxAttempts: 2}
+		g := newTestGraph(t, []*Node{a}, nil)
+
+		<-a.Run(g, false)
+		assert.EqualError(t, a.State().Result.Err, "failed after 2 attempts: timed out after 10ms: context deadline exceeded")
+		assert.Equal(t, 2, runs(a))
+	})
+
+	t.Run("retry after slow stop", func(t *testing.T) {
+		action := &slowStopAction{}
+		a := newCountingNode("a", 0)
+		a.Action = action
+		a.Policy = RunPolicy{Timeout: 10 * time.Millisecond, MaxAttempts: 3}
+		g := newTestGraph(t, []*Node{a}, nil)
+
+		<-a.Run(g, false)
+		assert.EqualError(t, a.State().Result.Err, "failed after 3 attempts: timed out after 10ms: context deadline exceeded")
+		assert.Equal(t, int32(3), action.runs.Load())
+		assert.False(t, action.overlapped.Load(), "each attempt should stop before the next one starts")
+	})
+
+	t.Run("stop during backoff", func(t *testing.T) {
+		a := newCountingNode("a", 0)
+		a.Action.(*countingAction).err = errors.New("oops")
+		a.Policy = RunPolicy{MaxAttempts: 2, Backoff: time.Hour}
+		g := newTestGraph(t, []*Node{a}, nil)
+
+		done := a.Run(g, false)
+		require.Eventually(t, func() bool { return runs(a) == 1 }, time.Second, time.Millisecond)
+		a.Stop(g)
+		<-done
+		assert.ErrorIs(t, a.State().Result.Err, context.Canceled)
+		assert.Equal(t, 1, runs(a))
+	})
+
+	t.Run("change while running", func(t *testing.T) {
+		a := newCountingNode("a", 0)
+		a.Action.(*countingAction).failFirst = 1
+		a.Policy = RunPolicy{MaxAttempts: 2}
+		g := newTestGraph(t, []*Node{a}, nil)
+
+		// Either policy retries enough; the race detector checks the rest.
+		done := a.Run(g, false)
+		a.SetPolicy(RunPolicy{MaxAttempts: 3})
+		<-done
+		require.NoError(t, a.State().Result.Err)
+		assert.Equal(t, RunPolicy{MaxAttempts: 3}, a.Policy)
+	})
+}
+
+func TestRunPolicyString(t *testing.T) {
+	assert.Equal(t, "no timeout, no retries", RunPolicy{}.String())
+	assert.Equal(t, "timeout 30s", RunPolicy{Timeout: 30 * time.Second, MaxAttempts: 1, Backoff: time.Second}.String())
+	assert.Equal(t, "timeout 1m0s, 3 attempts, backoff 1s", RunPolicy{Timeout: time.Minute, MaxAttempts: 3, Backoff: time.Second}.String())
+}
@@ -0,0 +1,517 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bvisness/flowshell/util"
+)
+
+// Guards each node's execution state, along with anything the scheduler's
+// goroutines read while the UI may be changing it (Node.Valid, Node.Pinned,
+// Node.NoCache, Node.Policy, and ForEachAction.Concurrency). Actions themselves
+// run outside the lock.
+var schedulerMu sync.Mutex
+
+type CycleError struct {
+	Nodes []*Node
+}
+
+func (e CycleError) Error() string {
+	names := util.Map(e.Nodes, func(n *Node) string { return n.String() })
+	return fmt.Sprintf("graph contains a cycle between nodes %s", strings.Join(names, ", "))
+}
+
+// Toposort orders the given nodes so that every node comes after all the
+// nodes wired into it. Wires to nodes outside of the set are ignored. Ties are
+// broken by the original order of the nodes, so the result is stable from
+// frame to frame.
+func (g *Graph) Toposort(nodes []*Node) ([]*Node, error) {
+	inDegree := make(map[*Node]int, len(nodes))
+	for _, n := range nodes {
+		inDegree[n] = 0
+	}
+
+	dependents := make(map[*Node][]*Node)
+	g.mu.RLock()
+	for _, n := range nodes {
+		for _, wire := range g.outputs[n] {
+			if _, ok := inDegree[wire.EndNode]; !ok {
+				continue
+			}
+			if slices.Contains(dependents[n], wire.EndNode) {
+				// Multiple wires between the same two nodes only count once.
+				continue
+			}
+			dependents[n] = append(dependents[n], wire.EndNode)
+			inDegree[wire.EndNode]++
+		}
+	}
+	g.mu.RUnlock()
+
+	var ready []*Node
+	for _, n := range nodes {
+		if inDegree[n] == 0 {
+			ready = append(ready, n)
+		}
+	}
+
+	res := make([]*Node, 0, len(nodes))
+	for len(ready) > 0 {
+		n := ready[0]
+		ready = ready[1:]
+		res = append(res, n)
+
+		for _, dependent := range dependents[n] {
+			inDegree[dependent]--
+			if inDegree[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	if len(res) != len(nodes) {
+		var cycle []*Node
+		for _, n := range nodes {
+			if inDegree[n] > 0 {
+				cycle = append(cycle, n)
+			}
+		}
+		return res, CycleError{Nodes: cycle}
+	}
+
+	return res, nil
+}
+
+// Sweep the graph, validating all nodes. Nodes are visited in topological
+// order so that each node sees its inputs' up-to-date port types.
+func (g *Graph) Validate() {
+	for _, node := range g.validationOrder() {
+		schedulerMu.Lock()
+		node.Action.UpdateAndValidate(g, node)
+		schedulerMu.Unlock()
+	}
+}
+
+// Like Validate, but for use with schedulerMu held, e.g. by actions that
+// validate graphs of their own.
+func (g *Graph) validateLocked() {
+	for _, node := range g.validationOrder() {
+		node.Action.UpdateAndValidate(g, node)
+	}
+}
+
+func (g *Graph) validationOrder() []*Node {
+	nodes := g.Nodes()
+	sorted, err := g.Toposort(nodes)
+	if err != nil {
+		// Cycles should have been refused when wiring, but validate everything
+		// anyway so the UI stays usable.
+		return nodes
+	}
+	return sorted
+}
+
+// WouldCreateCycle reports whether adding a wire from one node to another
+// would make the graph cyclic, i.e. whether the start node is already
+// reachable from the end node (or they are the same node).
+func (g *Graph) WouldCreateCycle(start, end *Node) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.wouldCreateCycle(start, end)
+}
+
+func (g *Graph) wouldCreateCycle(start, end *Node) bool {
+	visited := make(map[*Node]bool)
+	stack := []*Node{end}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if n == start {
+			return true
+		}
+		if visited[n] {
+			continue
+		}
+		visited[n] = true
+
+		for _, wire := range g.outputs[n] {
+			stack = append(stack, wire.EndNode)
+		}
+	}
+	return false
+}
+
+// Run the node, along with any of its inputs that need to be run first. If
+// rerunInputs is set, all unpinned inputs are re-run; otherwise only inputs
+// that are stale, failed, or have no results are run.
+//
+// The returned channel is closed when the node has finished running.
+// Independent inputs run concurrently. Each call is recorded in the graph's
+// run history.
+func (n *Node) Run(g *Graph, rerunInputs bool) <-chan struct{} {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+
+	run := g.newRunRecord(n)
+	if n.state.Running {
+		n.addToRun(run)
+		return n.done
+	}
+
+	// Find every node that needs to run in order to run this one. Nodes that
+	// are already running will be waited on but not restarted, and we don't
+	// look past nodes whose existing results will be reused.
+	needed := []*Node{n}
+	var reused []*Node
+	for i := 0; i < len(needed); i++ {
+		if needed[i].state.Running {
+			continue
+		}
+		for _, input := range g.Inputs(needed[i]) {
+			if slices.Contains(needed, input) || slices.Contains(reused, input) {
+				continue
+			}
+			rerunThisNode := (rerunInputs || input.state.Stale) && !input.Pinned
+			// A failure may have been temporary, e.g. a file that didn't exist
+			// yet, so it's worth trying again.
+			failed := input.state.Result.Err != nil
+			if input.state.Running || rerunThisNode || !input.state.ResultAvailable || failed {
+				needed = append(needed, input)
+			} else {
+				reused = append(reused, input)
+			}
+		}
+	}
+
+	plan, err := g.Toposort(needed)
+	if err != nil {
+		n.state.Result = NodeActionResult{Err: err}
+		n.state.ResultAvailable = true
+		run.addNode(n, NodeRunSkipped)
+		run.checkDone()
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+
+	for _, node := range reused {
+		run.addNode(node, NodeRunReused)
+	}
+
+	dones := make(map[*Node]<-chan struct{}, len(plan))
+	for _, node := range plan {
+		node.addToRun(run)
+		if node.state.Running {
+			dones[node] = node.done
+			continue
+		}
+
+		var inputDones []<-chan struct{}
+		for _, input := range g.Inputs(node) {
+			if done, ok := dones[input]; ok {
+				inputDones = append(inputDones, done)
+			}
+		}
+		dones[node] = node.start(g, inputDones)
+	}
+
+	return dones[n]
+}
+
+// Adds the node to the run's history as pending. The entry is filled in when
+// the node's current or upcoming run finishes. Must be called with schedulerMu
+// held.
+func (n *Node) addToRun(run *RunRecord) {
+	ref := run.addNode(n, NodeRunPending)
+	run.Nodes[ref.i].Start = n.actionStart
+	n.records = append(n.records, ref)
+}
+
+// Starts running the node's action once all the given input runs are done.
+// Must be called with schedulerMu held.
+func (n *Node) start(g *Graph, inputs []<-chan struct{}) <-chan struct{} {
+	n.Logger().Debug("Scheduling node")
+	ctx, cancel := context.WithCancel(context.Background())
+	cache := ResultCache
+	done := make(chan struct{})
+	n.state.Running = true
+	n.state.ResultAvailable = false
+	n.done = done
+	n.cancel = cancel
+
+	finish := func(status NodeRunStatus, res *NodeActionResult) {
+		schedulerMu.Lock()
+		for _, ref := range n.records {
+			ref.finishNode(status, res)
+		}
+		n.records = nil
+		n.actionStart = time.Time{}
+		n.inputTypes = nil
+
+		var autoRun []*Node
+		if res != nil {
+			changed := res.Err != nil || n.state.Result.Err != nil || !reflect.DeepEqual(res.Outputs, n.state.Result.Outputs)
+			n.state.Result = *res
+			n.state.ResultAvailable = true
+			if changed {
+				autoRun = n.markDownstreamStale(g)
+			}
+			if res.Err != nil {
+				autoRun = nil // they would just fail
+			}
+		}
+		n.state.Running = false
+		n.done = nil
+		n.cancel = nil
+		schedulerMu.Unlock()
+		cancel()
+		close(done)
+
+		for _, node := range autoRun {
+			node.Run(g, false)
+		}
+	}
+
+	go func() {
+		if len(inputs) > 0 {
+			g.traceEvent(n, TraceWaitStart, 0, "")
+		}
+		for _, input := range inputs {
+			select {
+			case <-input:
+			case <-ctx.Done():
+				g.traceEvent(n, TraceWaitEnd, 0, "")
+				finish(NodeRunSkipped, &NodeActionResult{Err: ctx.Err()})
+				return
+			}
+		}
+		if len(inputs) > 0 {
+			g.traceEvent(n, TraceWaitEnd, 0, "")
+		}
+
+		// If any inputs have errors, stop.
+		for _, inputNode := range g.Inputs(n) {
+			if state := inputNode.State(); !state.ResultAvailable || state.Result.Err != nil {
+				finish(NodeRunSkipped, nil)
+				return
+			}
+		}
+
+		// From here on, the run reflects the node's current inputs and
+		// configuration. (If they change while the action is running, the
+		// result will be stale again.)
+		schedulerMu.Lock()
+		n.state.Stale = false
+		outputTypes := util.Map(n.OutputPorts, func(port NodePort) FlowType { return port.Type })
+		n.inputTypes = util.Map(n.InputPorts, func(port NodePort) FlowType { return port.Type })
+		policy := n.Policy
+		n.actionStart = time.Now()
+		for _, ref := range n.records {
+			ref.run.Nodes[ref.i].Start = n.actionStart
+		}
+		schedulerMu.Unlock()
+
+		g.traceEvent(n, TraceNodeStart, 0, "")
+		res, cached := n.runAction(ctx, g, cache, outputTypes, policy)
+		status := util.Tern(cached, NodeRunCached, NodeRunExecuted)
+		if res.Err != nil {
+			g.traceEvent(n, TraceNodeFinish, 0, fmt.Sprintf("error: %v", res.Err))
+		} else {
+			g.traceEvent(n, TraceNodeFinish, 0, strings.ToLower(status.String()))
+		}
+		finish(status, &res)
+	}()
+
+	return done
+}
+
+// Runs the node's action according to its policy, or reuses a cached result,
+// once its inputs are ready. Panics and results that don't match the node's
+// output port types become errors. (The types and policy are passed in because
+// they may be edited while the action runs.)
+func (n *Node) runAction(ctx context.Context, g *Graph, cache *Cache, outputTypes []FlowType, policy RunPolicy) (res NodeActionResult, cached bool) {
+	defer RecoverPanic(&res)
+
+	var cacheKey string
+	cacheable := false
+	if cache != nil {
+		cacheKey, cacheable = CacheKey(g, n)
+	}
+
+	if cacheable {
+		res.Outputs, cached = cache.Get(cacheKey)
+	}
+	if cached {
+		n.Logger().Debug("Using cached result")
+	} else {
+		n.Logger().Debug("Running node")
+		res = n.runWithPolicy(ctx, g, policy)
+	}
+	if res.Err != nil {
+		return res, cached
+	}
+
+	if len(res.Outputs) != len(outputTypes) {
+		return NodeActionResult{Err: fmt.Errorf("bad num outputs for %s: got %d, expected %d", n, len(res.Outputs), len(outputTypes))}, cached
+	}
+	for i, output := range res.Outputs {
+		if output.Type == nil {
+			return NodeActionResult{Err: fmt.Errorf("output port %d of %s has no type", i, n)}, cached
+		}
+		if err := Typecheck(*output.Type, outputTypes[i]); err != nil {
+			return NodeActionResult{Err: fmt.Errorf("bad value type for %s output port %d: %v", n, i, err)}, cached
+		}
+	}
+	if cacheable && !cached {
+		if err := cache.Put(cacheKey, res.Outputs); err != nil {
+			n.Logger().Warn("Failed to cache result", "err", err)
+		}
+	}
+	return res, cached
+}
+
+// Gives the node a result without running its action, as if it had just run,
+// e.g. to feed values into a graph from outside it. Everything downstream goes
+// stale if the result changed.
+func (n *Node) setResult(g *Graph, res NodeActionResult) {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+
+	changed := !n.state.ResultAvailable || !reflect.DeepEqual(res, n.state.Result)
+	n.state.Result = res
+	n.state.ResultAvailable = true
+	n.state.Stale = false
+	if changed {
+		n.markDownstreamStale(g)
+	}
+}
+
+// If set, nodes are re-run automatically when their results go stale, unless
+// they are pinned. Guarded by schedulerMu; use AutoRun and SetAutoRun.
+var autoRunEnabled bool
+
+// Reports whether auto-run is on.
+func AutoRun() bool {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+	return autoRunEnabled
+}
+
+// Turns auto-run on or off.
+func SetAutoRun(on bool) {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+	autoRunEnabled = on
+}
+
+// Marks the node's result as out of date, along with everything downstream of
+// it. Call this while the node's configuration is being edited.
+func (n *Node) MarkStale(g *Graph) {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+	n.state.Stale = true
+	n.markDownstreamStale(g)
+}
+
+// Call this when the node's configuration or inputs have changed. Marks the
+// node stale, and re-runs it if auto-run is on.
+func (n *Node) MarkChanged(g *Graph) {
+	schedulerMu.Lock()
+	n.state.Stale = true
+	n.markDownstreamStale(g)
+	autoRun := autoRunEnabled && n.canAutoRun()
+	schedulerMu.Unlock()
+
+	if autoRun {
+		n.Run(g, false)
+	}
+}
+
+// Marks everything downstream of the node as stale, stopping at pinned nodes
+// since their results won't change. Returns the nodes directly downstream that
+// should be re-run automatically. Must be called with schedulerMu held.
+func (n *Node) markDownstreamStale(g *Graph) []*Node {
+	var autoRun []*Node
+	if autoRunEnabled {
+		for _, output := range g.Outputs(n) {
+			if output.canAutoRun() {
+				autoRun = append(autoRun, output)
+			}
+		}
+	}
+
+	visited := []*Node{n}
+	for i := 0; i < len(visited); i++ {
+		for _, output := range g.Outputs(visited[i]) {
+			if slices.Contains(visited, output) {
+				continue
+			}
+			output.state.Stale = true
+			if !output.Pinned {
+				visited = append(visited, output)
+			}
+		}
+	}
+	return autoRun
+}
+
+// Only nodes that are already showing a result are re-run automatically, so
+// that e.g. a half-configured Run Process node doesn't start by surprise.
+func (n *Node) canAutoRun() bool {
+	return !n.Pinned && n.Valid && n.state.ResultAvailable && !n.state.Running
+}
+
+// Pins or unpins the node. Pinned nodes are not re-run automatically, and
+// their results are reused when running the nodes downstream of them.
+func (n *Node) SetPinned(pinned bool) {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+	n.Pinned = pinned
+}
+
+// Changes the node's timeout and retries. Runs that have already started keep
+// the old policy.
+func (n *Node) SetPolicy(policy RunPolicy) {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+	n.Policy = policy
+}
+
+// Turns result caching off or on for the node.
+func (n *Node) SetNoCache(noCache bool) {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+	n.NoCache = noCache
+}
+
+func (n *Node) cachingDisabled() bool {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+	return n.NoCache
+}
+
+// Stop cancels the node's current run, along with any downstream nodes that
+// are running or waiting on it.
+func (n *Node) Stop(g *Graph) {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+
+	toStop := []*Node{n}
+	for i := 0; i < len(toStop); i++ {
+		if toStop[i].cancel != nil {
+			toStop[i].cancel()
+		}
+		for _, output := range g.Outputs(toStop[i]) {
+			if !slices.Contains(toStop, output) {
+				toStop = append(toStop, output)
+			}
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// An action that outputs a single Int64 and counts how many times it ran.
+type countingAction struct {
+	runs      atomic.Int32
+	err       error
+	failFirst int32 // fail this many runs before succeeding
+	block     bool  // run until canceled
+}
+
+func (a *countingAction) UpdateAndValidate(g *Graph, n *Node) { n.Valid = true }
+func (a *countingAction) Tag() string                         { return "countingAction" }
+func (a *countingAction) Serialize(s *Serializer) bool {
+	return s.Ok()
+}
+
+func (a *countingAction) Run(ctx context.Context, g *Graph, n *Node) <-chan NodeActionResult {
+	done := make(chan NodeActionResult)
+	go func() {
+		runs := a.runs.Add(1)
+		if a.block {
+			<-ctx.Done()
+			done <- NodeActionResult{Err: ctx.Err()}
+			return
+		}
+		if a.err != nil {
+			done <- NodeActionResult{Err: a.err}
+		} else if runs <= a.failFirst {
+			done <- NodeActionResult{Err: fmt.Errorf("failed run %d", runs)}
+		} else {
+			done <- NodeActionResult{Outputs: []FlowValue{NewInt64Value(int64(runs), 0)}}
+		}
+	}()
+	return done
+}
+
+func newCountingNode(name string, numInputs int) *Node {
+	n := &Node{
+		Name:        name,
+		OutputPorts: []NodePort{{Name: "Out", Type: FlowType{Kind: FSKindInt64}}},
+		Action:      &countingAction{},
+	}
+	for range numInputs {
+		n.InputPorts = append(n.InputPorts, NodePort{Name: "In", Type: FlowType{Kind: FSKindInt64}})
+	}
+	return n
+}
+
+func runs(n *Node) int {
+	return int(n.Action.(*countingAction).runs.Load())
+}
+
+// Builds a graph from the given nodes and wires.
+func newTestGraph(t *testing.T, ns []*Node, ws []*Wire) *Graph {
+	t.Helper()
+	g := NewGraph()
+	for _, n := range ns {
+		g.AddNode(n)
+	}
+	for _, w := range ws {
+		_, err := g.Connect(w.StartNode, w.StartPort, w.EndNode, w.EndPort)
+		require.NoError(t, err)
+	}
+	return g
+}
+
+func TestToposort(t *testing.T) {
+	a := newCountingNode("a", 0)
+	b := newCountingNode("b", 1)
+	c := newCountingNode("c", 1)
+	d := newCountingNode("d", 2)
+	g := newTestGraph(t, []*Node{d, c, b, a}, []*Wire{
+		{StartNode: c, EndNode: d, EndPort: 1},
+		{StartNode: b, EndNode: d, EndPort: 0},
+		{StartNode: a, EndNode: c},
+		{StartNode: a, EndNode: b},
+	})
+
+	sorted, err := g.Toposort(g.Nodes())
+	assert.NoError(t, err)
+	assert.Equal(t, []*Node{a, c, b, d}, sorted)
+
+	t.Run("cycle", func(t *testing.T) {
+		assert.True(t, g.WouldCreateCycle(d, a))
+		assert.True(t, g.WouldCreateCycle(a, a))
+		assert.False(t, g.WouldCreateCycle(b, c))
+
+		// Connect refuses cycles, so sneak one in.
+		g.addWire(&Wire{StartNode: d, EndNode: a})
+		_, err := g.Toposort([]*Node{a, b, c, d})
+		var cycleErr CycleError
+		assert.True(t, errors.As(err, &cycleErr))
+		assert.ElementsMatch(t, []*Node{a, b, c, d}, cycleErr.Nodes)
+	})
+}
+
+func TestRunDiamond(t *testing.T) {
+	a := newCountingNode("a", 0)
+	b := newCountingNode("b", 1)
+	c := newCountingNode("c", 1)
+	d := newCountingNode("d", 2)
+	g := newTestGraph(t, []*Node{a, b, c, d}, []*Wire{
+		{StartNode: a, EndNode: b},
+		{StartNode: a, EndNode: c},
+		{StartNode: b, EndNode: d, EndPort: 0},
+		{StartNode: c, EndNode: d, EndPort: 1},
+	})
+
+	<-d.Run(g, false)
+	for _, n := range []*Node{a, b, c, d} {
+		assert.Equal(t, 1, runs(n), "%s should have run once", n)
+		assert.True(t, n.State().ResultAvailable)
+		assert.False(t, n.State().Running)
+	}
+
+	// Without rerunning inputs, only d runs again.
+	<-d.Run(g, false)
+	assert.Equal(t, []int{1, 1, 1, 2}, []int{runs(a), runs(b), runs(c), runs(d)})
+
+	// Pinned nodes are not rerun.
+	b.Pinned = true
+	<-d.Run(g, true)
+	assert.Equal(t, []int{2, 1, 2, 3}, []int{runs(a), runs(b), runs(c), runs(d)})
+}
+
+func TestRunInputError(t *testing.T) {
+	a := newCountingNode("a", 0)
+	a.Action.(*countingAction).err = errors.New("oh no")
+	b := newCountingNode("b", 1)
+	g := newTestGraph(t, []*Node{a, b}, []*Wire{{StartNode: a, EndNode: b}})
+
+	<-b.Run(g, false)
+	assert.Equal(t, 1, runs(a))
+	assert.Equal(t, 0, runs(b))
+	assert.False(t, b.State().ResultAvailable)
+}
+
+func TestStop(t *testing.T) {
+	a := newCountingNode("a", 0)
+	a.Action.(*countingAction).block = true
+	b := newCountingNode("b", 1)
+	g := newTestGraph(t, []*Node{a, b}, []*Wire{{StartNode: a, EndNode: b}})
+
+	bDone := b.Run(g, false)
+	aDone := a.Run(g, false) // already running, so this just waits on the existing run
+	for runs(a) == 0 {
+		runtime.Gosched()
+	}
+	a.Stop(g)
+	<-aDone
+	<-bDone
+
+	assert.ErrorIs(t, a.State().Result.Err, context.Canceled)
+	assert.Equal(t, 0, runs(b))
+	assert.False(t, a.State().Running)
+	assert.False(t, b.State().Running)
+}
+
+func TestStale(t *testing.T) {
+	a := newCountingNode("a", 0)
+	b := newCountingNode("b", 1)
+	c := newCountingNode("c", 1)
+	g := newTestGraph(t, []*Node{a, b, c}, []*Wire{
+		{StartNode: a, EndNode: b},
+		{StartNode: b, EndNode: c},
+	})
+	g.Validate()
+
+	<-c.Run(g, false)
+	assert.Equal(t, []bool{false, false, false}, []bool{a.State().Stale, b.State().Stale, c.State().Stale})
+
+	// Editing a node marks it and everything downstream stale, and running
+	// anything downstream reruns the stale nodes.
+	a.MarkStale(g)
+	assert.Equal(t, []bool{true, true, true}, []bool{a.State().Stale, b.State().Stale, c.State().Stale})
+	<-c.Run(g, false)
+	assert.Equal(t, []int{2, 2, 2}, []int{runs(a), runs(b), runs(c)})
+	assert.Equal(t, []bool{false, false, false}, []bool{a.State().Stale, b.State().Stale, c.State().Stale})
+
+	// A new result also makes everything downstream stale.
+	<-a.Run(g, false)
+	assert.Equal(t, []bool{false, true, true}, []bool{a.State().Stale, b.State().Stale, c.State().Stale})
+	<-c.Run(g, false)
+
+	// Pinned nodes keep their results, so staleness stops there.
+	b.Pinned = true
+	a.MarkStale(g)
+	assert.Equal(t, []bool{true, true, false}, []bool{a.State().Stale, b.State().Stale, c.State().Stale})
+	<-c.Run(g, false)
+	assert.Equal(t, []int{3, 3, 4}, []int{runs(a), runs(b), runs(c)}, "only c itself should have run")
+}
+
+func TestAutoRun(t *testing.T) {
+	SetAutoRun(true)
+	t.Cleanup(func() { SetAutoRun(false) })
+
+	a := newCountingNode("a", 0)
+	b := newCountingNode("b", 1)
+	c := newCountingNode("c", 1)
+	d := newCountingNode("d", 0) // never run, so never run automatically
+	g := newTestGraph(t, []*Node{a, b, c, d}, []*Wire{
+		{StartNode: a, EndNode: b},
+		{StartNode: b, EndNode: c},
+	})
+	g.Validate()
+	<-c.Run(g, false)
+
+	idle := func() bool {
+		return !a.State().Running && !b.State().Running && !c.State().Running
+	}
+
+	a.MarkChanged(g)
+	require.Eventually(t, func() bool { return runs(c) == 2 && idle() }, time.Second, time.Millisecond)
+	assert.Equal(t, []int{2, 2, 2}, []int{runs(a), runs(b), runs(c)})
+	assert.Equal(t, []bool{false, false, false}, []bool{a.State().Stale, b.State().Stale, c.State().Stale})
+
+	d.MarkChanged(g)
+	assert.Equal(t, 0, runs(d))
+
+	// Pinned nodes are not rerun, and so neither is anything after them.
+	b.Pinned = true
+	a.MarkChanged(g)
+	require.Eventually(t, func() bool { return runs(a) == 3 && idle() }, time.Second, time.Millisecond)
+	assert.Equal(t, []int{3, 2, 2}, []int{runs(a), runs(b), runs(c)})
+	assert.True(t, b.State().Stale)
+}
+
+func TestRunPanic(t *testing.T) {
+	// Validation would normally stop this from running without inputs.
+	n := NewConcatTablesNode()
+	g := newTestGraph(t, []*Node{n}, nil)
+
+	<-n.Run(g, false)
+	var panicErr PanicError
+	require.ErrorAs(t, n.State().Result.Err, &panicErr)
+	assert.Equal(t, "panic: first input was not wired (validation should have caught this)", panicErr.Error())
+	require.NotEmpty(t, panicErr.Stack)
+	assert.Contains(t, panicErr.Stack[0].Function, "(*ConcatTablesAction).Run")
+	assert.False(t, n.State().Running)
+}
+
+func TestRunBadOutputs(t *testing.T) {
+	n := newCountingNode("a", 0)
+	n.OutputPorts = append(n.OutputPorts, NodePort{Name: "Extra", Type: FlowType{Kind: FSKindInt64}})
+	g := newTestGraph(t, []*Node{n}, nil)
+
+	<-n.Run(g, false)
+	assert.EqualError(t, n.State().Result.Err, fmt.Sprintf("bad num outputs for %s: got 1, expected 2", n))
+
+	n.OutputPorts = []NodePort{{Name: "Out", Type: FlowType{Kind: FSKindBytes}}}
+	<-n.Run(g, false)
+	assert.ErrorContains(t, n.State().Result.Err, "expected type Bytes, but got Int64")
+}
+
+// Runs, stops, and edits a graph from several goroutines while reading its
+// state the way the UI does every frame. This is mostly useful under -race.
+func TestConcurrentRuns(t *testing.T) {
+	SetAutoRun(true)
+	t.Cleanup(func() { SetAutoRun(false) })
+
+	// Trim Spaces rewrites its ports whenever it is validated, so validation
+	// races with its runs unless they are careful.
+	path := filepath.Join(t.TempDir(), "in.txt")
+	require.NoError(t, os.WriteFile(path, []byte("  hello  "), 0666))
+	a := NewLoadFileNode(path)
+	b := NewTrimSpacesNode()
+	c := NewTrimSpacesNode()
+	g := newTestGraph(t, []*Node{a, b, c}, []*Wire{
+		{StartNode: a, EndNode: b},
+		{StartNode: a, EndNode: c},
+	})
+	g.Validate()
+	<-b.Run(g, false)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; ; j++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				switch (i + j) % 4 {
+				case 0:
+					<-b.Run(g, true)
+				case 1:
+					a.MarkChanged(g)
+				case 2:
+					c.Stop(g)
+				case 3:
+					<-c.Run(g, false)
+				}
+			}
+		}()
+	}
+
+	// Meanwhile, the "frame loop" validates the graph and reads everything.
+	for deadline := time.Now().Add(200 * time.Millisecond); time.Now().Before(deadline); {
+		g.Validate()
+		for _, n := range g.Nodes() {
+			if state := n.State(); state.ResultAvailable && state.Result.Err == nil {
+				assert.Len(t, state.Result.Outputs, 1)
+			}
+		}
+		b.SetPinned(!b.Pinned)
+	}
+	close(stop)
+	wg.Wait()
+
+	// Once things settle down, the graph still runs normally.
+	b.SetPinned(false)
+	idle := func() bool {
+		return !a.State().Running && !b.State().Running && !c.State().Running
+	}
+	require.Eventually(t, idle, time.Second, time.Millisecond)
+	<-b.Run(g, true)
+	require.NoError(t, b.State().Result.Err)
+	assert.Equal(t, "hello", string(b.State().Result.Outputs[0].BytesValue))
+}
+
+// A canceled process may still be exiting when the node runs again, so the
+// two runs must not share state.
+func TestRunProcessRestart(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sleep")
+	}
+
+	n := NewRunProcessNode("sleep 0.1")
+	g := newTestGraph(t, []*Node{n}, nil)
+	g.Validate()
+
+	first := n.Run(g, false)
+	n.Stop(g)
+	<-first
+	assert.ErrorIs(t, n.State().Result.Err, context.Canceled)
+
+	<-n.Run(g, false)
+	state := n.State()
+	assert.NoError(t, state.Result.Err)
+	assert.Len(t, state.Result.Outputs, 3)
+}
@@ -0,0 +1,591 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/bvisness/flowshell/trace"
+	"github.com/bvisness/flowshell/util"
+)
+
+type Serializer struct {
+	Buf     *bytes.Buffer
+	Encode  bool
+	Version int
+	Errs    []error
+
+	depth int // of nested objects, to stop malicious files from overflowing the stack
+
+	// Set for the JSON text format. See serialize_text.go.
+	Text      bool
+	textRoot  *textValue
+	textStack []*textValue
+	textKey   string
+}
+
+type Serializable interface {
+	Serialize(s *Serializer) bool
+}
+
+func NewEncoder(version int) *Serializer {
+	s := Serializer{
+		Buf:     &bytes.Buffer{},
+		Encode:  true,
+		Version: version,
+	}
+	SInt(&s, &s.Version)
+	return &s
+}
+
+func NewDecoder(buf []byte) *Serializer {
+	s := Serializer{
+		Buf:    bytes.NewBuffer(buf),
+		Encode: false,
+	}
+	SInt(&s, &s.Version)
+	return &s
+}
+
+func (s *Serializer) Bytes() []byte {
+	if !s.Encode {
+		panic("cannot call Serializer.Bytes() unless in Encode mode")
+	}
+	if s.Text {
+		var b bytes.Buffer
+		s.textRoot.write(&b, "")
+		b.WriteString("\n")
+		return b.Bytes()
+	}
+	return s.Buf.Bytes()
+}
+
+func (s *Serializer) Ok() bool {
+	return len(s.Errs) == 0
+}
+
+func (s *Serializer) Error(err error) bool {
+	s.Errs = append(s.Errs, SerializeError{
+		Err:   err,
+		Stack: trace.Trace()[1:],
+	})
+	return false
+}
+
+func SBool(s *Serializer, b *bool) bool {
+	if !s.Ok() {
+		return false
+	}
+
+	if s.Text {
+		if s.Encode {
+			return textPut(s, *b)
+		}
+		return textGet(s, b)
+	}
+
+	if s.Encode {
+		if err := s.Buf.WriteByte(util.Tern[byte](*b, 0x01, 0x00)); err != nil {
+			return s.Error(err)
+		}
+	} else {
+		x, err := s.Buf.ReadByte()
+		if err != nil {
+			return s.Error(err)
+		}
+		*b = x > 0
+	}
+	return true
+}
+
+func SInt[T ~int | ~int32 | ~int64](s *Serializer, n *T) bool {
+	if !s.Ok() {
+		return false
+	}
+
+	if s.Text {
+		if s.Encode {
+			return textPut(s, int64(*n))
+		}
+		var x int64
+		if !textGet(s, &x) {
+			return false
+		}
+		*n = T(x)
+		return true
+	}
+
+	if s.Encode {
+		// Why couldn't they just have binary.WriteVarint again...?
+		// https://github.com/golang/go/issues/29010
+		var b [binary.MaxVarintLen64]byte
+		nBytes := binary.PutVarint(b[:], int64(*n))
+		if _, err := s.Buf.Write(b[:nBytes]); err != nil {
+			return s.Error(err)
+		}
+	} else {
+		x, err := binary.ReadVarint(s.Buf)
+		if err != nil {
+			return s.Error(err)
+		}
+		*n = T(x)
+	}
+	return true
+}
+
+func SUint[T ~uint | ~uint32 | ~uint64](s *Serializer, n *T) bool {
+	if !s.Ok() {
+		return false
+	}
+
+	if s.Text {
+		if s.Encode {
+			return textPut(s, uint64(*n))
+		}
+		var x uint64
+		if !textGet(s, &x) {
+			return false
+		}
+		*n = T(x)
+		return true
+	}
+
+	if s.Encode {
+		var b [binary.MaxVarintLen64]byte
+		nBytes := binary.PutUvarint(b[:], uint64(*n))
+		if _, err := s.Buf.Write(b[:nBytes]); err != nil {
+			return s.Error(err)
+		}
+	} else {
+		x, err := binary.ReadUvarint(s.Buf)
+		if err != nil {
+			return s.Error(err)
+		}
+		*n = T(x)
+	}
+	return true
+}
+
+func SFloat[T ~float32 | ~float64](s *Serializer, n *T) bool {
+	if !s.Ok() {
+		return false
+	}
+
+	if s.Text {
+		if s.Encode {
+			return textPut(s, *n)
+		}
+		return textGet(s, n)
+	}
+
+	if s.Encode {
+		err := binary.Write(s.Buf, binary.LittleEndian, *n)
+		if err != nil {
+			return s.Error(err)
+		}
+	} else {
+		err := binary.Read(s.Buf, binary.LittleEndian, n)
+		if err != nil {
+			return s.Error(err)
+		}
+	}
+	return true
+}
+
+func SStr[T ~string](s *Serializer, str *T) bool {
+	if !s.Ok() {
+		return false
+	}
+
+	if s.Text {
+		if s.Encode {
+			return textPut(s, string(*str))
+		}
+		var x string
+		if !textGet(s, &x) {
+			return false
+		}
+		*str = T(x)
+		return true
+	}
+
+	strlen := len(*str)
+	if ok := SInt(s, &strlen); !ok {
+		return false
+	}
+	if !s.Encode && !s.checkLen(strlen, "string") {
+		return false
+	}
+
+	if s.Encode {
+		if _, err := s.Buf.Write([]byte(*str)); err != nil {
+			return s.Error(err)
+		}
+	} else {
+		res := make([]byte, strlen)
+		if nRead, err := s.Buf.Read(res[:]); err != nil {
+			return s.Error(err)
+		} else if nRead < strlen {
+			return s.Error(io.EOF)
+		}
+		*str = T(res)
+	}
+	return true
+}
+
+func SBytes(s *Serializer, b *[]byte) bool {
+	if !s.Ok() {
+		return false
+	}
+
+	if s.Text {
+		// encoding/json stores byte slices as base64.
+		if s.Encode {
+			return textPut(s, *b)
+		}
+		return textGet(s, b)
+	}
+
+	n := len(*b)
+	if ok := SInt(s, &n); !ok {
+		return false
+	}
+	if !s.Encode && !s.checkLen(n, "byte string") {
+		return false
+	}
+
+	if s.Encode {
+		if _, err := s.Buf.Write(*b); err != nil {
+			return s.Error(err)
+		}
+	} else {
+		res := make([]byte, n)
+		if nRead, err := s.Buf.Read(res); err != nil && n > 0 {
+			return s.Error(err)
+		} else if nRead < n {
+			return s.Error(io.EOF)
+		}
+		*b = res
+	}
+	return true
+}
+
+func (s *Serializer) ReadStr() (string, bool) {
+	if s.Encode {
+		return "", s.Error(errors.New("cannot call Serializer.ReadStr() in Encode mode"))
+	}
+	var res string
+	if ok := SStr(s, &res); !ok {
+		return "", false
+	}
+	return res, true
+}
+
+func (s *Serializer) WriteStr(str string) bool {
+	if !s.Encode {
+		return s.Error(errors.New("cannot call Serializer.WriteStr() unless in Encode mode"))
+	}
+	return SStr(s, &str)
+}
+
+func SThing[T any, PT PSerializable[T]](s *Serializer, v PT) bool {
+	return SNested(s, v)
+}
+
+// Like SThing, but for values that are only known by interface, such as node
+// actions. In the text format, the value's fields are nested in an object.
+func SNested(s *Serializer, v Serializable) bool {
+	return SObject(s, func() bool { return v.Serialize(s) })
+}
+
+// Serializes v so that readers who don't know how to decode it can skip it, or
+// preserve it with SRest. In the binary format (since version 3) this prefixes
+// v with its length; in the text format it is the same as SNested.
+func SOpaque(s *Serializer, v Serializable) bool {
+	if !s.Ok() {
+		return false
+	}
+	if s.Text || s.Version < 3 {
+		return SNested(s, v)
+	}
+
+	sub := Serializer{Buf: &bytes.Buffer{}, Encode: s.Encode, Version: s.Version, depth: s.depth}
+	var buf []byte
+	if s.Encode {
+		ok := v.Serialize(&sub)
+		s.Errs = append(s.Errs, sub.Errs...)
+		if !ok {
+			return false
+		}
+		buf = sub.Buf.Bytes()
+		return SBytes(s, &buf)
+	}
+
+	if !SBytes(s, &buf) {
+		return false
+	}
+	sub.Buf = bytes.NewBuffer(buf)
+	ok := v.Serialize(&sub)
+	s.Errs = append(s.Errs, sub.Errs...)
+	return ok && s.Ok()
+}
+
+// Data that could not be decoded, kept so that it can be written back out
+// unchanged. See SRest.
+type OpaqueData struct {
+	bin  []byte
+	text *textValue
+}
+
+// Reads everything remaining in the current value, which must have been
+// started by SOpaque, or writes it back out again. Data cannot be converted
+// between the binary and text formats this way, since we don't know what it
+// means.
+func SRest(s *Serializer, d *OpaqueData) bool {
+	if !s.Ok() {
+		return false
+	}
+
+	if s.Text {
+		top := s.textTop()
+		if s.Encode {
+			if d.text == nil {
+				return s.Error(fmt.Errorf("%s: cannot convert data from a binary file to text", s.textPath()))
+			}
+			top.Kind = d.text.Kind
+			top.Keys = append(top.Keys, d.text.Keys...)
+			top.Items = append(top.Items, d.text.Items...)
+		} else {
+			d.text = &textValue{
+				Kind:  top.Kind,
+				Keys:  slices.Clone(top.Keys),
+				Items: slices.Clone(top.Items),
+			}
+			top.next = len(top.Items)
+		}
+		return true
+	}
+
+	if s.Encode {
+		if d.text != nil {
+			return s.Error(errors.New("cannot convert data from a text file to binary"))
+		}
+		if _, err := s.Buf.Write(d.bin); err != nil {
+			return s.Error(err)
+		}
+	} else {
+		d.bin = bytes.Clone(s.Buf.Bytes())
+		s.Buf.Reset()
+	}
+	return true
+}
+
+// Groups the values serialized by f. In the text format they are nested in an
+// object; in the binary format this makes no difference.
+func SObject(s *Serializer, f func() bool) bool {
+	if !s.Ok() {
+		return false
+	}
+
+	if s.depth >= maxSerializeDepth {
+		return s.Error(fmt.Errorf("values nested more than %d deep", maxSerializeDepth))
+	}
+	s.depth++
+	defer func() { s.depth-- }()
+
+	if s.Text {
+		return s.textNest(false, f)
+	}
+	return f()
+}
+
+const maxSerializeDepth = 1000
+
+// When decoding, checks a length read from the file before we allocate
+// anything based on it. Every byte, string element, and slice element takes
+// at least one byte, so a length longer than the rest of the buffer must be
+// garbage.
+func (s *Serializer) checkLen(n int, what string) bool {
+	if n < 0 || n > s.Buf.Len() {
+		return s.Error(fmt.Errorf("invalid %s length %d (%d bytes remaining)", what, n, s.Buf.Len()))
+	}
+	return true
+}
+
+func SMaybeThing[T any, PT PSerializable[T]](s *Serializer, v **T) bool {
+	if !s.Ok() {
+		return false
+	}
+
+	exists, ok := sExists(s, *v != nil)
+	if !ok {
+		return false
+	}
+	if exists {
+		if s.Encode {
+			return SThing(s, PT(*v))
+		}
+
+		var newThing T
+		if ok := SThing(s, PT(&newThing)); !ok {
+			return false
+		}
+		*v = &newThing
+	}
+	return true
+}
+
+func SFixed[T any](s *Serializer, v *T) bool {
+	if !s.Ok() {
+		return false
+	}
+
+	if s.Text {
+		if s.Encode {
+			return textPut(s, *v)
+		}
+		return textGet(s, v)
+	}
+
+	if s.Encode {
+		if err := binary.Write(s.Buf, binary.LittleEndian, *v); err != nil {
+			return s.Error(err)
+		}
+	} else {
+		if err := binary.Read(s.Buf, binary.LittleEndian, v); err != nil {
+			return s.Error(err)
+		}
+	}
+	return true
+}
+
+func SMaybeFixed[T any](s *Serializer, v **T) bool {
+	if !s.Ok() {
+		return false
+	}
+
+	exists, ok := sExists(s, *v != nil)
+	if !ok {
+		return false
+	}
+	if exists {
+		if !s.Encode {
+			*v = new(T)
+		}
+		return SFixed(s, *v)
+	}
+	return true
+}
+
+func SSlice[T any, PT PSerializable[T]](s *Serializer, slice *[]T) bool {
+	return SSeq(s, len(*slice), func(n int) {
+		*slice = util.Tern(n == 0, nil, make([]T, n))
+	}, func(i int) bool {
+		return SThing(s, PT(&(*slice)[i]))
+	})
+}
+
+// Like SSlice, but for slices of pointers. Each element is freshly allocated
+// when decoding.
+func SPtrSlice[T any, PT PSerializable[T]](s *Serializer, slice *[]*T) bool {
+	return SSeq(s, len(*slice), func(n int) {
+		*slice = util.Tern(n == 0, nil, make([]*T, n))
+		for i := range *slice {
+			(*slice)[i] = new(T)
+		}
+	}, func(i int) bool {
+		return SThing(s, PT((*slice)[i]))
+	})
+}
+
+// Serializes a sequence of n items by calling item for each index. When
+// decoding, n comes from the file instead, and alloc is called with it first
+// to make room. This is for sequences SSlice can't handle, like slices of
+// slices.
+func SSeq(s *Serializer, n int, alloc func(n int), item func(i int) bool) bool {
+	if !s.Ok() {
+		return false
+	}
+
+	items := func() bool {
+		if !s.Encode {
+			alloc(n)
+		}
+		for i := range n {
+			if ok := item(i); !ok {
+				return false
+			}
+		}
+		return true
+	}
+
+	if s.Text {
+		return s.textNest(true, func() bool {
+			if !s.Encode {
+				n = len(s.textTop().Items)
+			}
+			return items()
+		})
+	}
+
+	if ok := SInt(s, &n); !ok {
+		return false
+	}
+	if !s.Encode && !s.checkLen(n, "slice") {
+		return false
+	}
+	return items()
+}
+
+// Serializes whether an optional value is present. The binary format uses a
+// bool; the text format uses null for missing values.
+func sExists(s *Serializer, exists bool) (bool, bool) {
+	if !s.Text {
+		return exists, SBool(s, &exists)
+	}
+	if s.Encode {
+		if !exists {
+			return false, textPut[any](s, nil)
+		}
+		return true, true
+	}
+	isNull, ok := s.textPeekNull()
+	if !ok {
+		return false, false
+	}
+	if isNull {
+		s.textTake(false)
+	}
+	return !isNull, true
+}
+
+// ------------------------------------
+// Errors
+
+type SerializeError struct {
+	Err   error
+	Stack trace.CallStack
+}
+
+func (e SerializeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e SerializeError) Unwrap() error {
+	return e.Err
+}
+
+// --------------------------------------
+// Type utilities
+
+type PSerializable[T any] interface {
+	*T
+	Serializable
+}
+
+type PP[T any] interface {
+	**T
+}
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeBadLengths(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		buf  []byte
+	}{
+		{"huge string", []byte{6, 0xfe, 0xff, 0xff, 0xff, 0x0f}},
+		{"negative string", []byte{6, 0x01}},
+		{"truncated string", []byte{6, 0x10, 'h', 'i'}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewDecoder(tc.buf)
+			var str string
+			assert.False(t, SStr(s, &str))
+			requireSerializeErrors(t, s)
+		})
+	}
+
+	t.Run("huge slice", func(t *testing.T) {
+		s := NewDecoder([]byte{6, 0xfe, 0xff, 0xff, 0xff, 0x0f})
+		var ports []NodePort
+		assert.False(t, SSlice(s, &ports))
+		requireSerializeErrors(t, s)
+	})
+
+	t.Run("deep nesting", func(t *testing.T) {
+		// A FlowType containing a FlowType containing a FlowType...
+		var buf []byte
+		buf = append(buf, 6)
+		for range maxSerializeDepth + 1 {
+			buf = append(buf, 0 /* kind */, 1 /* has contained type */)
+		}
+		s := NewDecoder(buf)
+		var ft FlowType
+		assert.False(t, SThing(s, &ft))
+		requireSerializeErrors(t, s)
+	})
+}
+
+// Every decoding failure should be reported as a SerializeError with a stack
+// trace, not a panic.
+func requireSerializeErrors(t *testing.T, s *Serializer) {
+	t.Helper()
+	require.NotEmpty(t, s.Errs)
+	for _, err := range s.Errs {
+		var serr SerializeError
+		require.True(t, errors.As(err, &serr), "%v is not a SerializeError", err)
+		require.NotEmpty(t, serr.Stack, "%v has no stack trace", err)
+	}
+}
+
+// Seeds the fuzzer with every node from the fixture graph, plus the fixture
+// files themselves.
+func addFuzzSeeds(f *testing.F, graphs bool) {
+	for _, n := range fixtureGraph().Nodes {
+		s := NewEncoder(GraphFileVersion)
+		require.True(f, n.Serialize(s))
+		f.Add(s.Bytes())
+
+		s = NewTextEncoder(GraphFileVersion)
+		require.True(f, n.Serialize(s))
+		f.Add(s.Bytes())
+	}
+
+	if graphs {
+		paths, err := filepath.Glob(filepath.Join("testdata", "graph_v*.flow*"))
+		require.NoError(f, err)
+		for _, path := range paths {
+			buf, err := os.ReadFile(path)
+			require.NoError(f, err)
+			f.Add(buf)
+		}
+	}
+}
+
+func FuzzDecodeNode(f *testing.F) {
+	addFuzzSeeds(f, false)
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		for _, s := range []*Serializer{NewDecoder(buf), NewTextDecoder(buf)} {
+			var n Node
+			if !n.Serialize(s) {
+				requireSerializeErrors(t, s)
+			}
+		}
+	})
+}
+
+func FuzzDecodeGraph(f *testing.F) {
+	addFuzzSeeds(f, true)
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		DecodeGraph(buf)
+	})
+}
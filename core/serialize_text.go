@@ -0,0 +1,344 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/bvisness/flowshell/util"
+)
+
+// The text format is JSON, produced by the same Serialize methods as the
+// binary format. Values that were given a name with Serializer.Key become
+// object fields, in the order they were serialized, so the output is stable
+// and diffs nicely. Unnamed values become array elements.
+//
+// When decoding, named values are looked up by name, so fields can be
+// reordered by hand without breaking anything.
+
+func NewTextEncoder(version int) *Serializer {
+	s := Serializer{
+		Encode:  true,
+		Version: version,
+		Text:    true,
+	}
+	s.textRoot = &textValue{Kind: textObject}
+	s.textStack = []*textValue{s.textRoot}
+	SInt(s.Key("version"), &s.Version)
+	return &s
+}
+
+func NewTextDecoder(buf []byte) *Serializer {
+	s := Serializer{
+		Encode: false,
+		Text:   true,
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	root, err := parseTextValue(dec, 0)
+	if err == nil && root.Kind != textObject {
+		err = errors.New("expected a JSON object")
+	}
+	if err == nil {
+		if _, err2 := dec.Token(); err2 != io.EOF {
+			err = errors.New("unexpected data after JSON object")
+		}
+	}
+	if err != nil {
+		s.Error(fmt.Errorf("invalid JSON: %w", err))
+		return &s
+	}
+
+	s.textRoot = root
+	s.textStack = []*textValue{root}
+	SInt(s.Key("version"), &s.Version)
+	return &s
+}
+
+// Reports whether buf looks like a file in the text format (rather than the
+// binary format, which can never start with a brace).
+func IsTextFormat(buf []byte) bool {
+	trimmed := bytes.TrimLeft(buf, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+type textKind int
+
+const (
+	textScalar textKind = iota
+	textObject
+	textArray
+)
+
+type textValue struct {
+	Kind  textKind
+	Raw   json.RawMessage // for scalars
+	Keys  []string        // for objects, parallel to Items
+	Items []*textValue    // for objects and arrays
+
+	next int // for reading array items in order
+	name string
+}
+
+// Names the next value serialized. This only matters for the text format;
+// the binary format stores values purely by position.
+func (s *Serializer) Key(name string) *Serializer {
+	s.textKey = name
+	return s
+}
+
+func (s *Serializer) textTop() *textValue {
+	return s.textStack[len(s.textStack)-1]
+}
+
+// Describes where in the document we are, for error messages.
+func (s *Serializer) textPath() string {
+	var b strings.Builder
+	for _, v := range s.textStack[1:] {
+		b.WriteString(v.name)
+	}
+	if s.textKey != "" {
+		b.WriteString("." + s.textKey)
+	}
+	if b.Len() == 0 {
+		return "top level"
+	}
+	return strings.TrimPrefix(b.String(), ".")
+}
+
+// Adds a value to the current object or array, consuming the pending key.
+func (s *Serializer) textAdd(v *textValue) bool {
+	top := s.textTop()
+	key := s.textKey
+	s.textKey = ""
+
+	if key != "" {
+		if top.Kind != textObject || (len(top.Items) > 0 && len(top.Keys) == 0) {
+			return s.Error(fmt.Errorf("%s: named value %q cannot be mixed with unnamed values", s.textPath(), key))
+		}
+		top.Keys = append(top.Keys, key)
+		v.name = "." + key
+	} else {
+		if len(top.Keys) > 0 {
+			return s.Error(fmt.Errorf("%s: unnamed value cannot be mixed with named values", s.textPath()))
+		}
+		if top.Kind == textObject && len(top.Items) == 0 {
+			// Objects without any named values are written as arrays.
+			top.Kind = textArray
+		}
+		v.name = fmt.Sprintf("[%d]", len(top.Items))
+	}
+	top.Items = append(top.Items, v)
+	return true
+}
+
+// Gets the next value from the current object or array, consuming the pending
+// key. If peek is set, array items are not consumed.
+func (s *Serializer) textTake(peek bool) (*textValue, bool) {
+	top := s.textTop()
+	key := s.textKey
+	path := s.textPath()
+	if !peek {
+		s.textKey = ""
+	}
+
+	if key != "" {
+		if top.Kind != textObject {
+			return nil, s.Error(fmt.Errorf("%s: expected an object", path))
+		}
+		for i, k := range top.Keys {
+			if k == key {
+				top.Items[i].name = "." + key
+				return top.Items[i], true
+			}
+		}
+		return nil, s.Error(fmt.Errorf("%s: missing field", path))
+	}
+
+	if top.Kind == textScalar || top.next >= len(top.Items) {
+		return nil, s.Error(fmt.Errorf("%s: not enough values", path))
+	}
+	v := top.Items[top.next]
+	v.name = fmt.Sprintf("[%d]", top.next)
+	if !peek {
+		top.next++
+	}
+	return v, true
+}
+
+func textPut[T any](s *Serializer, v T) bool {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return s.Error(fmt.Errorf("%s: %w", s.textPath(), err))
+	}
+	return s.textAdd(&textValue{Kind: textScalar, Raw: raw})
+}
+
+func textGet[T any](s *Serializer, v *T) bool {
+	path := s.textPath()
+	tv, ok := s.textTake(false)
+	if !ok {
+		return false
+	}
+	if tv.Kind != textScalar {
+		return s.Error(fmt.Errorf("%s: expected a single value, not an object or array", path))
+	}
+	if err := json.Unmarshal(tv.Raw, v); err != nil {
+		return s.Error(fmt.Errorf("%s: %w", path, err))
+	}
+	return true
+}
+
+// Reports whether the next value is null, without consuming it.
+func (s *Serializer) textPeekNull() (bool, bool) {
+	tv, ok := s.textTake(true)
+	if !ok {
+		return false, false
+	}
+	return tv.Kind == textScalar && string(tv.Raw) == "null", true
+}
+
+// Serializes the contents of f as a nested object (or array, if isArray).
+func (s *Serializer) textNest(isArray bool, f func() bool) bool {
+	if s.Encode {
+		v := &textValue{Kind: util.Tern(isArray, textArray, textObject)}
+		if !s.textAdd(v) {
+			return false
+		}
+		s.textStack = append(s.textStack, v)
+	} else {
+		path := s.textPath()
+		v, ok := s.textTake(false)
+		if !ok {
+			return false
+		}
+		if isArray && v.Kind != textArray {
+			return s.Error(fmt.Errorf("%s: expected an array", path))
+		} else if !isArray && v.Kind == textScalar {
+			return s.Error(fmt.Errorf("%s: expected an object or array", path))
+		}
+		v.next = 0
+		s.textStack = append(s.textStack, v)
+	}
+
+	ok := f()
+	s.textStack = s.textStack[:len(s.textStack)-1]
+	return ok && s.Ok()
+}
+
+func parseTextValue(dec *json.Decoder, depth int) (*textValue, error) {
+	if depth > maxSerializeDepth {
+		return nil, fmt.Errorf("values nested more than %d deep", maxSerializeDepth)
+	}
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok := tok.(type) {
+	case json.Delim:
+		switch tok {
+		case '{':
+			v := &textValue{Kind: textObject}
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				item, err := parseTextValue(dec, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				v.Keys = append(v.Keys, keyTok.(string))
+				v.Items = append(v.Items, item)
+			}
+			_, err := dec.Token() // }
+			return v, err
+		case '[':
+			v := &textValue{Kind: textArray}
+			for dec.More() {
+				item, err := parseTextValue(dec, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				v.Items = append(v.Items, item)
+			}
+			_, err := dec.Token() // ]
+			return v, err
+		default:
+			return nil, fmt.Errorf("unexpected %v", tok)
+		}
+	default:
+		raw, err := json.Marshal(tok)
+		if err != nil {
+			return nil, err
+		}
+		return &textValue{Kind: textScalar, Raw: raw}, nil
+	}
+}
+
+// Writes the value as indented JSON. Short objects and arrays that contain no
+// other non-empty objects or arrays are kept on one line.
+func (v *textValue) write(b *bytes.Buffer, indent string) {
+	if v.Kind == textScalar {
+		b.Write(v.Raw)
+		return
+	}
+
+	open, close := "[", "]"
+	if v.Kind == textObject {
+		open, close = "{", "}"
+	}
+	if len(v.Items) == 0 {
+		b.WriteString(open + close)
+		return
+	}
+
+	var inline bytes.Buffer
+	if v.writeInline(&inline) && inline.Len() <= 80 {
+		b.Write(inline.Bytes())
+		return
+	}
+
+	b.WriteString(open + "\n")
+	for i, item := range v.Items {
+		b.WriteString(indent + "  ")
+		if v.Kind == textObject {
+			b.WriteString(strconv.Quote(v.Keys[i]) + ": ")
+		}
+		item.write(b, indent+"  ")
+		if i < len(v.Items)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(indent + close)
+}
+
+func (v *textValue) writeInline(b *bytes.Buffer) bool {
+	open, close := "[", "]"
+	if v.Kind == textObject {
+		open, close = "{", "}"
+	}
+	b.WriteString(open)
+	for i, item := range v.Items {
+		if item.Kind != textScalar && len(item.Items) > 0 {
+			return false
+		}
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if v.Kind == textObject {
+			b.WriteString(strconv.Quote(v.Keys[i]) + ": ")
+		}
+		item.write(b, "")
+	}
+	b.WriteString(close)
+	return true
+}
@@ -0,0 +1,229 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bvisness/flowshell/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareNatural(t *testing.T) {
+	for _, test := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"file2", "file10", -1},
+		{"file10", "file2", 1},
+		{"file10b", "file10a", 1},
+		{"x007", "x7", 0},
+		{"x7", "x08", -1},
+		{"apple", "Banana", -1},
+		{"Apple", "apple", 0},
+		{"", "a", -1},
+		{"abc", "ab", 1},
+		{"2024-1-9", "2024-1-10", -1},
+		{"99999999999999999999999", "100000000000000000000000", -1},
+		{"été", "Étage", 1},
+	} {
+		t.Run(test.a+" vs "+test.b, func(t *testing.T) {
+			assert.Equal(t, test.expected, compareNatural([]byte(test.a), []byte(test.b)))
+		})
+	}
+}
+
+func TestSortList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lines.txt")
+	require.NoError(t, os.WriteFile(path, []byte("item10\nItem2\nitem1\nitem2\nitem01"), 0666))
+
+	load := NewLoadFileNode(path)
+	lines := NewLinesNode()
+	sort := NewSortNode()
+	g := newTestGraph(t, []*Node{load, lines, sort}, []*Wire{
+		{StartNode: load, EndNode: lines},
+		{StartNode: lines, EndNode: sort},
+	})
+	a := sort.Action.(*SortAction)
+	sorted := func() []string {
+		res, err := g.Run(t.Context(), sort)
+		require.NoError(t, err)
+		assert.Equal(t, sort.OutputPorts[0].Type, *res[0].Type)
+		return util.Map(res[0].ListValue, func(v FlowValue) string { return string(v.BytesValue) })
+	}
+
+	g.Validate()
+	assert.True(t, sort.Valid)
+	assert.Equal(t, lines.OutputPorts[0].Type, sort.OutputPorts[0].Type)
+	assert.Empty(t, a.Keys[0].Columns.Options)
+	assert.Equal(t, []string{"item01", "item1", "Item2", "item2", "item10"}, sorted())
+
+	t.Run("descending", func(t *testing.T) {
+		a.Keys[0].Order.SelectByValue(SortDescending)
+		defer a.Keys[0].Order.SelectByValue(SortAscending)
+		sort.MarkChanged(g)
+
+		assert.Equal(t, []string{"item10", "item2", "Item2", "item1", "item01"}, sorted())
+	})
+}
+
+func TestSortTable(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, file := range []struct {
+		name string
+		size int
+	}{
+		{"b10.txt", 2000},
+		{"a.txt", 10},
+		{"b9.txt", 2000},
+		{"c.txt", 500},
+	} {
+		path := filepath.Join(dir, file.name)
+		require.NoError(t, os.WriteFile(path, make([]byte, file.size), 0666))
+		modified := base.Add(time.Duration(i) * time.Hour)
+		require.NoError(t, os.Chtimes(path, modified, modified))
+	}
+
+	listFiles := NewListFilesNode(dir)
+	sort := NewSortNode()
+	g := newTestGraph(t, []*Node{listFiles, sort}, []*Wire{
+		{StartNode: listFiles, EndNode: sort},
+	})
+	a := sort.Action.(*SortAction)
+	sortedNames := func(g *Graph, sort *Node) []string {
+		res, err := g.Run(t.Context(), sort)
+		require.NoError(t, err)
+		return util.Map(res[0].ColumnValues(0), func(v FlowValue) string { return string(v.BytesValue) })
+	}
+
+	g.Validate()
+	require.True(t, sort.Valid, "%v", a.Err)
+	assert.Equal(t, listFiles.OutputPorts[0].Type, sort.OutputPorts[0].Type)
+	assert.Equal(t, "name", a.Keys[0].Column)
+	assert.Equal(t, []string{"a.txt", "b9.txt", "b10.txt", "c.txt"}, sortedNames(g, sort))
+
+	for _, test := range []struct {
+		name     string
+		keys     []SortKey
+		expected []string
+	}{
+		{
+			name:     "timestamp",
+			keys:     []SortKey{{Column: "modified", Order: Choice{Selected: 1}}},
+			expected: []string{"c.txt", "b9.txt", "a.txt", "b10.txt"},
+		},
+		{
+			// Ties keep the order from the directory listing, which is by name.
+			name:     "stable",
+			keys:     []SortKey{{Column: "size", Order: Choice{Selected: 1}}},
+			expected: []string{"b10.txt", "b9.txt", "c.txt", "a.txt"},
+		},
+		{
+			name: "two keys",
+			keys: []SortKey{
+				{Column: "size", Order: Choice{Selected: 1}},
+				{Column: "name"},
+			},
+			expected: []string{"b9.txt", "b10.txt", "c.txt", "a.txt"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			for i := range test.keys {
+				test.keys[i].Order.Options = sortOrderOptions
+			}
+			a.Keys = test.keys
+			sort.MarkChanged(g)
+
+			g.Validate()
+			require.True(t, sort.Valid, "%v", a.Err)
+			assert.Equal(t, test.expected, sortedNames(g, sort))
+		})
+	}
+
+	t.Run("add and remove keys", func(t *testing.T) {
+		a.Keys = []SortKey{newSortKey("name")}
+		g.Validate()
+
+		a.AddKey(g, sort)
+		a.AddKey(g, sort)
+		g.Validate()
+		assert.Equal(t, []string{"name", "type", "size"}, util.Map(a.Keys, func(k SortKey) string { return k.Column }))
+
+		for range 3 {
+			a.RemoveKey(g, sort)
+		}
+		assert.Len(t, a.Keys, 1)
+	})
+
+	t.Run("missing column", func(t *testing.T) {
+		a.Keys = []SortKey{newSortKey("nope")}
+		defer func() { a.Keys = []SortKey{newSortKey("name")} }()
+		g.Validate()
+		assert.False(t, sort.Valid)
+		assert.EqualError(t, a.Err, `no column "nope"`)
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		a.Keys = []SortKey{newSortKey("size"), newSortKey("name")}
+		a.Keys[0].Order.SelectByValue(SortDescending)
+
+		buf, err := EncodeGraphText(g.File())
+		require.NoError(t, err)
+		assert.Contains(t, string(buf), SortDescending)
+		f, err := DecodeGraph(buf)
+		require.NoError(t, err)
+		loaded := NewGraphFromFile(f)
+
+		assert.Equal(t, []string{"b9.txt", "b10.txt", "c.txt", "a.txt"}, sortedNames(loaded, loaded.Nodes()[1]))
+	})
+}
+
+// A CSV file's columns aren't known until it loads.
+func TestSortCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.csv")
+	require.NoError(t, os.WriteFile(path, []byte("a,b\n3,10\n1,30\n2,20\n"), 0666))
+
+	load := NewLoadFileNode(path)
+	sort := NewSortNode()
+	g := newTestGraph(t, []*Node{load, sort}, nil)
+	g.Validate() // so that Load File outputs a table
+	_, err := g.Connect(load, 0, sort, 0)
+	require.NoError(t, err)
+	a := sort.Action.(*SortAction)
+
+	g.Validate()
+	assert.True(t, sort.Valid)
+	assert.Empty(t, a.Keys[0].Columns.Options)
+
+	// Without a column chosen, the first one is the key.
+	res, err := g.Run(t.Context(), sort)
+	require.NoError(t, err)
+	assert.Equal(t, []FlowValue{NewFloat64Value(1, 0), NewFloat64Value(2, 0), NewFloat64Value(3, 0)}, res[0].ColumnValues(0))
+
+	// Once the file has loaded, its columns are offered.
+	g.Validate()
+	assert.Equal(t, []string{"a", "b"}, util.Map(a.Keys[0].Columns.Options, func(o ChoiceOption) string { return o.Name }))
+	assert.Equal(t, "a", a.Keys[0].Column)
+
+	a.Keys[0].Column = "b"
+	a.Keys[0].Order.SelectByValue(SortDescending)
+	sort.MarkChanged(g)
+	res, err = g.Run(t.Context(), sort)
+	require.NoError(t, err)
+	assert.Equal(t, []FlowValue{NewFloat64Value(30, 0), NewFloat64Value(20, 0), NewFloat64Value(10, 0)}, res[0].ColumnValues(1))
+}
+
+func TestSortUnsortable(t *testing.T) {
+	a := NewSortNode().Action.(*SortAction)
+	lines := NewListType(FlowType{Kind: FSKindBytes})
+
+	_, err := a.keyColumns(lines)
+	assert.EqualError(t, err, "cannot sort by List[Bytes]")
+
+	a.Keys[0].Column = "lines"
+	_, err = a.keyColumns(FlowType{Kind: FSKindRecord, Fields: []FlowField{{Name: "lines", Type: &lines}}})
+	assert.EqualError(t, err, `column "lines": cannot sort by List[Bytes]`)
+}
@@ -0,0 +1,267 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/bvisness/flowshell/util"
+)
+
+// How many execution events each graph remembers. Older events are dropped.
+const MaxTraceEvents = 100_000
+
+type TraceEventKind int
+
+const (
+	TraceWaitStart    TraceEventKind = iota // The node started waiting on its inputs
+	TraceWaitEnd                            // The node's inputs are done (or the run was stopped)
+	TraceNodeStart                          // The node's action started (or its result was looked up in the cache)
+	TraceNodeFinish                         // The node's action finished
+	TraceProcessSpawn                       // A node started a process
+	TraceProcessExit                        // A process started by a node exited
+)
+
+// Something that happened while running a graph, for diagnosing slow flows.
+// See WriteChromeTrace.
+type TraceEvent struct {
+	Kind     TraceEventKind
+	Time     time.Time
+	NodeID   int
+	NodeName string
+
+	// Details for some kinds of events. Processes are identified by their
+	// PID.
+	PID    int
+	Detail string // The command for spawns, the status or error for finishes and exits
+
+	// The composite or For Each nodes the node is inside, outermost first,
+	// e.g. "Compose (#3) / For Each (#5)". Empty for nodes in the root graph.
+	Scope string
+}
+
+// Records an event for the node. Safe to call from any goroutine.
+func (g *Graph) traceEvent(n *Node, kind TraceEventKind, pid int, detail string) {
+	g.recordTraceEvent(TraceEvent{
+		Kind:     kind,
+		Time:     time.Now(),
+		NodeID:   n.ID,
+		NodeName: n.Name,
+		PID:      pid,
+		Detail:   detail,
+	})
+}
+
+func (g *Graph) recordTraceEvent(e TraceEvent) {
+	g.traceMu.Lock()
+	if parent := g.traceParent; parent != nil {
+		e.Scope = util.Tern(e.Scope == "", g.traceScope, g.traceScope+" / "+e.Scope)
+		g.traceMu.Unlock()
+		parent.recordTraceEvent(e)
+		return
+	}
+	defer g.traceMu.Unlock()
+
+	if len(g.traceEvents) >= MaxTraceEvents {
+		g.traceEvents = dropOldestSpans(g.traceEvents, MaxTraceEvents/2)
+	}
+	g.traceEvents = append(g.traceEvents, e)
+}
+
+// Sends the graph's events to parent instead of keeping them, labeled with
+// scope. Subgraphs use this so that the root graph's trace shows what
+// happened inside them.
+func (g *Graph) forwardTraceEvents(parent *Graph, scope string) {
+	g.traceMu.Lock()
+	defer g.traceMu.Unlock()
+	g.traceParent = parent
+	g.traceScope = scope
+}
+
+// Drops the spans that started in the first n events, along with their ends.
+// Spans that haven't ended yet are kept, so that every end stays matched with
+// its start.
+func dropOldestSpans(events []TraceEvent, n int) []TraceEvent {
+	type span struct {
+		Scope  string
+		NodeID int
+		Start  TraceEventKind
+		PID    int // For processes
+	}
+	starts := make(map[span][]int) // Indexes of spans that haven't ended, innermost last
+	drop := make([]bool, len(events))
+	for i, e := range events {
+		s := span{Scope: e.Scope, NodeID: e.NodeID, Start: e.Kind}
+		switch e.Kind {
+		case TraceWaitEnd:
+			s.Start = TraceWaitStart
+		case TraceNodeFinish:
+			s.Start = TraceNodeStart
+		case TraceProcessExit:
+			s.Start = TraceProcessSpawn
+		}
+		if s.Start == TraceProcessSpawn {
+			s.PID = e.PID
+		}
+
+		if s.Start == e.Kind {
+			starts[s] = append(starts[s], i)
+			continue
+		}
+		open := starts[s]
+		if len(open) == 0 {
+			drop[i] = true // Its start is already gone
+			continue
+		}
+		start := open[len(open)-1]
+		starts[s] = open[:len(open)-1]
+		if start < n {
+			drop[start], drop[i] = true, true
+		}
+	}
+
+	kept := events[:0]
+	for i, e := range events {
+		if !drop[i] {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// Returns a copy of the graph's recorded execution events, oldest first.
+func (g *Graph) TraceEvents() []TraceEvent {
+	g.traceMu.Lock()
+	defer g.traceMu.Unlock()
+	return slices.Clone(g.traceEvents)
+}
+
+// Forgets the graph's recorded execution events.
+func (g *Graph) ClearTraceEvents() {
+	g.traceMu.Lock()
+	defer g.traceMu.Unlock()
+	g.traceEvents = nil
+}
+
+// An event in the Chrome Trace Event format. See
+// https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+type chromeTraceEvent struct {
+	Name  string         `json:"name"`
+	Cat   string         `json:"cat,omitempty"`
+	Phase string         `json:"ph"`
+	TS    float64        `json:"ts"` // microseconds
+	PID   int            `json:"pid"`
+	TID   int            `json:"tid"`
+	ID    string         `json:"id,omitempty"`
+	Args  map[string]any `json:"args,omitempty"`
+}
+
+// Writes events as Chrome Trace Event JSON, which can be opened in Perfetto
+// (https://ui.perfetto.dev) or chrome://tracing. Each node gets its own track,
+// showing when it waited on its inputs, when it ran, and any processes it
+// started. Nodes inside subgraphs get tracks after those of the root graph's
+// nodes.
+func WriteChromeTrace(w io.Writer, events []TraceEvent) error {
+	var out []chromeTraceEvent
+	out = append(out, chromeTraceEvent{
+		Name:  "process_name",
+		Phase: "M",
+		PID:   1,
+		Args:  map[string]any{"name": "Flowshell"},
+	})
+
+	var start time.Time
+	if len(events) > 0 {
+		start = events[0].Time
+	}
+	type track struct {
+		Scope  string
+		NodeID int
+	}
+	// Root nodes' tracks are numbered by node ID, so subgraph tracks are
+	// numbered after the highest one.
+	tids := make(map[track]int)
+	nextTID := 1
+	for _, e := range events {
+		nextTID = max(nextTID, e.NodeID+1)
+	}
+	for _, e := range events {
+		key := track{e.Scope, e.NodeID}
+		tid, named := tids[key]
+		if !named {
+			tid = e.NodeID
+			if e.Scope != "" {
+				tid = nextTID
+				nextTID++
+			}
+			tids[key] = tid
+			name := fmt.Sprintf("%s (#%d)", e.NodeName, e.NodeID)
+			if e.Scope != "" {
+				name = e.Scope + " / " + name
+			}
+			out = append(out, chromeTraceEvent{
+				Name:  "thread_name",
+				Phase: "M",
+				PID:   1,
+				TID:   tid,
+				Args:  map[string]any{"name": name},
+			})
+		}
+
+		ce := chromeTraceEvent{
+			PID: 1,
+			TID: tid,
+			TS:  float64(e.Time.Sub(start).Nanoseconds()) / 1000,
+		}
+		switch e.Kind {
+		case TraceWaitStart, TraceWaitEnd:
+			ce.Name = "Waiting on inputs"
+			ce.Cat = "scheduler"
+			ce.Phase = util.Tern(e.Kind == TraceWaitStart, "B", "E")
+		case TraceNodeStart, TraceNodeFinish:
+			ce.Name = e.NodeName
+			ce.Cat = "node"
+			ce.Phase = util.Tern(e.Kind == TraceNodeStart, "B", "E")
+			if e.Kind == TraceNodeFinish {
+				ce.Args = map[string]any{"status": e.Detail}
+			}
+		case TraceProcessSpawn, TraceProcessExit:
+			// Processes may outlive a canceled run, so they are async events
+			// rather than being nested inside the node's run.
+			ce.Name = "Process"
+			ce.Cat = "process"
+			ce.ID = fmt.Sprint(e.PID)
+			if e.Kind == TraceProcessSpawn {
+				ce.Phase = "b"
+				ce.Args = map[string]any{"command": e.Detail, "pid": e.PID}
+			} else {
+				ce.Phase = "e"
+				ce.Args = map[string]any{"status": e.Detail}
+			}
+		default:
+			return fmt.Errorf("unknown trace event kind %d", e.Kind)
+		}
+		out = append(out, ce)
+	}
+
+	enc := json.NewEncoder(w)
+	return enc.Encode(struct {
+		TraceEvents     []chromeTraceEvent `json:"traceEvents"`
+		DisplayTimeUnit string             `json:"displayTimeUnit"`
+	}{out, "ms"})
+}
+
+func WriteChromeTraceFile(path string, events []TraceEvent) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteChromeTrace(f, events); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,119 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/bvisness/flowshell/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceEvents(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses echo")
+	}
+
+	process := NewRunProcessNode("echo hi")
+	trim := NewTrimSpacesNode()
+	g := newTestGraph(t, []*Node{process, trim}, []*Wire{
+		{StartNode: process, StartPort: 0, EndNode: trim, EndPort: 0},
+	})
+	g.Validate()
+	<-trim.Run(g, false)
+	require.NoError(t, trim.State().Result.Err)
+
+	kinds := func(n *Node) []TraceEventKind {
+		var res []TraceEventKind
+		for _, e := range g.TraceEvents() {
+			if e.NodeID == n.ID {
+				res = append(res, e.Kind)
+			}
+		}
+		return res
+	}
+	assert.Equal(t, []TraceEventKind{TraceNodeStart, TraceProcessSpawn, TraceProcessExit, TraceNodeFinish}, kinds(process))
+	assert.Equal(t, []TraceEventKind{TraceWaitStart, TraceWaitEnd, TraceNodeStart, TraceNodeFinish}, kinds(trim))
+
+	events := g.TraceEvents()
+	for i := 1; i < len(events); i++ {
+		assert.False(t, events[i].Time.Before(events[i-1].Time), "events should be in order")
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteChromeTrace(&buf, events))
+	var trace struct {
+		TraceEvents []struct {
+			Name  string         `json:"name"`
+			Phase string         `json:"ph"`
+			TS    float64        `json:"ts"`
+			TID   int            `json:"tid"`
+			Args  map[string]any `json:"args"`
+		} `json:"traceEvents"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &trace))
+
+	threadNames := make(map[int]any)
+	phases := make(map[string]int)
+	for _, e := range trace.TraceEvents {
+		phases[e.Phase]++
+		if e.Name == "thread_name" {
+			threadNames[e.TID] = e.Args["name"]
+		}
+		if e.Phase == "b" {
+			assert.Equal(t, "echo hi", e.Args["command"])
+		}
+		assert.GreaterOrEqual(t, e.TS, 0.0)
+	}
+	assert.Equal(t, map[int]any{
+		process.ID: fmt.Sprintf("Run Process (#%d)", process.ID),
+		trim.ID:    fmt.Sprintf("Trim Spaces (#%d)", trim.ID),
+	}, threadNames)
+	assert.Equal(t, map[string]int{"M": 3, "B": 3, "E": 3, "b": 1, "e": 1}, phases)
+
+	g.ClearTraceEvents()
+	assert.Empty(t, g.TraceEvents())
+}
+
+func TestRunHeadlessTrace(t *testing.T) {
+	dir := t.TempDir()
+	inPath := filepath.Join(dir, "in.txt")
+	tracePath := filepath.Join(dir, "run.trace.json")
+	require.NoError(t, os.WriteFile(inPath, []byte("  hello  \n"), 0666))
+
+	graphPath := writeTrimGraph(t, inPath, filepath.Join(dir, "out.txt"))
+	assert.Equal(t, 0, RunHeadless([]string{"-no-cache", "-trace", tracePath, graphPath}))
+	assert.FileExists(t, tracePath)
+}
+
+func TestTraceEventsLimit(t *testing.T) {
+	a := newCountingNode("a", 0)
+	b := newCountingNode("b", 0)
+	g := newTestGraph(t, []*Node{a, b}, nil)
+
+	// b waits the whole time, while a runs over and over. The first half of
+	// the events ends partway through one of a's runs.
+	g.traceEvent(b, TraceWaitStart, 0, "")
+	g.traceEvent(a, TraceWaitStart, 0, "")
+	g.traceEvent(a, TraceWaitEnd, 0, "")
+	for range MaxTraceEvents / 2 {
+		g.traceEvent(a, TraceNodeStart, 0, "")
+		g.traceEvent(a, TraceNodeFinish, 0, "")
+	}
+	g.traceEvent(b, TraceWaitEnd, 0, "")
+
+	events := g.TraceEvents()
+	assert.Less(t, len(events), MaxTraceEvents)
+	assert.Equal(t, TraceWaitStart, events[0].Kind, "b's wait was still going")
+	assert.Equal(t, b.ID, events[0].NodeID)
+	assert.Equal(t, TraceWaitEnd, events[len(events)-1].Kind)
+	for i, e := range events[1 : len(events)-1] {
+		assert.Equal(t, a.ID, e.NodeID)
+		require.Equal(t, util.Tern(i%2 == 0, TraceNodeStart, TraceNodeFinish), e.Kind, "event %d", i+1)
+	}
+}
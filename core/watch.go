@@ -0,0 +1,187 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// How often watched files are checked for changes.
+const WatchInterval = time.Second
+
+// Actions that read files implement this so they can be re-run when the files
+// change.
+type WatchedAction interface {
+	// Returns the files or directories the node reads. For directories, any
+	// change to the files directly inside them counts.
+	WatchedPaths(g *Graph, n *Node) []string
+}
+
+// Polls the files that nodes read and reports when they change. Polling is
+// less efficient than OS file notifications, but works the same everywhere,
+// including on network drives.
+type Watcher struct {
+	fingerprints map[*Node]string
+
+	// State for Poll.
+	lastCheck time.Time
+	results   chan []watchResult
+}
+
+// The paths a single node reads. Collecting these reads the node's
+// configuration, so it should happen on the UI thread; fingerprinting the
+// paths can happen anywhere.
+type watchRequest struct {
+	Node  *Node
+	Paths []string
+}
+
+type watchResult struct {
+	Node        *Node
+	Fingerprint string
+}
+
+func watchRequests(g *Graph) []watchRequest {
+	var reqs []watchRequest
+	for _, n := range g.Nodes() {
+		if watched, ok := n.Action.(WatchedAction); ok && !n.Pinned {
+			reqs = append(reqs, watchRequest{Node: n, Paths: watched.WatchedPaths(g, n)})
+		}
+	}
+	return reqs
+}
+
+func fingerprintAll(reqs []watchRequest) []watchResult {
+	res := make([]watchResult, len(reqs))
+	for i, req := range reqs {
+		var b strings.Builder
+		for _, path := range req.Paths {
+			fingerprintPath(&b, path)
+		}
+		res[i] = watchResult{Node: req.Node, Fingerprint: b.String()}
+	}
+	return res
+}
+
+// Describes the state of a file, or of the files in a directory, in enough
+// detail to tell if they changed.
+func fingerprintPath(b *strings.Builder, path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		fmt.Fprintf(b, "%s: %v\n", path, err)
+		return
+	}
+	fmt.Fprintf(b, "%s: %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			fmt.Fprintf(b, "%s: %v\n", path, err)
+			return
+		}
+		for _, entry := range entries {
+			if info, err := entry.Info(); err == nil {
+				fmt.Fprintf(b, "%s: %d %d\n", filepath.Join(path, entry.Name()), info.Size(), info.ModTime().UnixNano())
+			}
+		}
+	}
+}
+
+// Records the latest fingerprints and returns the nodes whose files changed
+// since the last update. Nodes seen for the first time are not reported.
+func (w *Watcher) update(results []watchResult) []*Node {
+	if w.fingerprints == nil {
+		w.fingerprints = make(map[*Node]string)
+	}
+
+	var changed []*Node
+	seen := make(map[*Node]bool, len(results))
+	for _, res := range results {
+		seen[res.Node] = true
+		if old, ok := w.fingerprints[res.Node]; ok && old != res.Fingerprint {
+			changed = append(changed, res.Node)
+		}
+		w.fingerprints[res.Node] = res.Fingerprint
+	}
+
+	// Forget deleted nodes.
+	for n := range w.fingerprints {
+		if !seen[n] {
+			delete(w.fingerprints, n)
+		}
+	}
+	return changed
+}
+
+// Checks the files read by the graph's nodes, returning the nodes whose files
+// changed since the last check.
+func (w *Watcher) Check(g *Graph) []*Node {
+	return w.update(fingerprintAll(watchRequests(g)))
+}
+
+// Re-runs the given nodes and everything downstream of them, stopping at
+// pinned nodes. Returns the affected nodes in topological order, and channels
+// that close when each run is done.
+func RerunAffected(g *Graph, changed []*Node) ([]*Node, []<-chan struct{}) {
+	var affected []*Node
+	for _, n := range changed {
+		if !n.Pinned && !slices.Contains(affected, n) {
+			affected = append(affected, n)
+		}
+	}
+	for i := 0; i < len(affected); i++ {
+		for _, output := range g.Outputs(affected[i]) {
+			if !output.Pinned && !slices.Contains(affected, output) {
+				affected = append(affected, output)
+			}
+		}
+	}
+
+	sorted, err := g.Toposort(affected)
+	if err != nil {
+		return nil, nil
+	}
+
+	var dones []<-chan struct{}
+	for _, n := range changed {
+		n.MarkStale(g)
+	}
+	for _, n := range sorted {
+		// In topological order, each node waits on the runs already started
+		// for its inputs, so every node runs once, after its inputs.
+		if n.Valid {
+			dones = append(dones, n.Run(g, false))
+		}
+	}
+	return sorted, dones
+}
+
+// Like Check, but fingerprints the files in the background so that slow disks
+// don't block the caller. Call this regularly, e.g. once per frame; it checks
+// at most once per WatchInterval and returns the changed nodes once a check
+// finishes.
+func (w *Watcher) Poll(g *Graph) []*Node {
+	if w.results != nil {
+		select {
+		case results := <-w.results:
+			w.results = nil
+			return w.update(results)
+		default:
+			return nil
+		}
+	}
+
+	if time.Since(w.lastCheck) < WatchInterval {
+		return nil
+	}
+	w.lastCheck = time.Now()
+
+	reqs := watchRequests(g)
+	results := make(chan []watchResult, 1)
+	w.results = results
+	go func() { results <- fingerprintAll(reqs) }()
+	return nil
+}
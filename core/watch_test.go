@@ -0,0 +1,150 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A countingAction that reads a file.
+type watchedCountingAction struct {
+	countingAction
+	path string
+}
+
+func (a *watchedCountingAction) WatchedPaths(g *Graph, n *Node) []string {
+	return []string{a.path}
+}
+
+func newWatchedNode(name, path string) *Node {
+	n := newCountingNode(name, 0)
+	n.Action = &watchedCountingAction{path: path}
+	return n
+}
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "in.txt")
+	require.NoError(t, os.WriteFile(path, []byte("a"), 0666))
+
+	file := NewLoadFileNode(path)
+	list := NewListFilesNode(dir)
+	g := newTestGraph(t, []*Node{file, list}, nil)
+
+	var w Watcher
+	assert.Empty(t, w.Check(g), "nodes seen for the first time are not reported")
+	assert.Empty(t, w.Check(g))
+
+	require.NoError(t, os.WriteFile(path, []byte("ab"), 0666))
+	assert.ElementsMatch(t, []*Node{file, list}, w.Check(g))
+	assert.Empty(t, w.Check(g))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "new.txt"), nil, 0666))
+	assert.Equal(t, []*Node{list}, w.Check(g))
+
+	// Pinned nodes are not watched.
+	list.Pinned = true
+	require.NoError(t, os.Remove(filepath.Join(dir, "new.txt")))
+	assert.Empty(t, w.Check(g))
+}
+
+func TestRerunAffected(t *testing.T) {
+	//   a -> b -> c
+	//   d (pinned) -> e
+	a := newWatchedNode("a", "")
+	b := newCountingNode("b", 1)
+	c := newCountingNode("c", 1)
+	d := newCountingNode("d", 1)
+	e := newCountingNode("e", 1)
+	other := newCountingNode("other", 0)
+	d.Pinned = true
+	g := newTestGraph(t, []*Node{a, b, c, d, e, other}, []*Wire{
+		{StartNode: a, EndNode: b},
+		{StartNode: b, EndNode: c},
+		{StartNode: a, EndNode: d},
+		{StartNode: d, EndNode: e},
+	})
+	g.Validate()
+	d.state.ResultAvailable = true
+	d.state.Result = NodeActionResult{Outputs: []FlowValue{NewInt64Value(0, 0)}}
+
+	affected, dones := RerunAffected(g, []*Node{a})
+	for _, done := range dones {
+		<-done
+	}
+	assert.Equal(t, []*Node{a, b, c}, affected)
+	assert.Equal(t, []int{1, 1, 1, 0, 0, 0},
+		[]int{int(a.Action.(*watchedCountingAction).runs.Load()), runs(b), runs(c), runs(d), runs(e), runs(other)})
+}
+
+func TestRunHeadlessWatch(t *testing.T) {
+	dir := t.TempDir()
+	inPath := filepath.Join(dir, "in.txt")
+	outPath := filepath.Join(dir, "out.txt")
+	require.NoError(t, os.WriteFile(inPath, []byte("  hello  "), 0666))
+
+	oldCache := ResultCache
+	t.Cleanup(func() { ResultCache = oldCache })
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	exited := make(chan int)
+	go func() {
+		exited <- runHeadless(ctx, []string{"-no-cache", "-watch", writeTrimGraph(t, inPath, outPath)})
+	}()
+
+	waitForOutput := func(expected string) {
+		t.Helper()
+		assert.EventuallyWithT(t, func(c *assert.CollectT) {
+			out, err := os.ReadFile(outPath)
+			assert.NoError(c, err)
+			assert.Equal(c, expected, string(out))
+		}, 10*time.Second, 50*time.Millisecond)
+	}
+	waitForOutput("hello")
+
+	require.NoError(t, os.WriteFile(inPath, []byte("  goodbye world  "), 0666))
+	waitForOutput("goodbye world")
+
+	cancel()
+	assert.Equal(t, 0, <-exited)
+}
+
+func TestRunHeadlessWatchExitStatus(t *testing.T) {
+	dir := t.TempDir()
+	inPath := filepath.Join(dir, "in.txt")
+	outPath := filepath.Join(dir, "out.txt")
+	graphPath := writeTrimGraph(t, inPath, outPath)
+
+	oldCache := ResultCache
+	t.Cleanup(func() { ResultCache = oldCache })
+
+	t.Run("initial run failed", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(t.Context(), 200*time.Millisecond)
+		defer cancel()
+		assert.Equal(t, 1, runHeadless(ctx, []string{"-no-cache", "-watch", graphPath}))
+	})
+
+	t.Run("fixed by a later run", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+		exited := make(chan int)
+		go func() {
+			exited <- runHeadless(ctx, []string{"-no-cache", "-watch", graphPath})
+		}()
+
+		require.NoError(t, os.WriteFile(inPath, []byte("  hello  "), 0666))
+		assert.EventuallyWithT(t, func(c *assert.CollectT) {
+			out, err := os.ReadFile(outPath)
+			assert.NoError(c, err)
+			assert.Equal(c, "hello", string(out))
+		}, 10*time.Second, 50*time.Millisecond)
+
+		cancel()
+		assert.Equal(t, 0, <-exited)
+	})
+}
@@ -0,0 +1,11 @@
+//go:build !headless
+
+package main
+
+import "github.com/bvisness/flowshell/app"
+
+// The GUI lives behind a build tag so that `go build -tags headless` produces
+// a binary that only supports `flowshell run`, without raylib or cgo.
+func runGUI() {
+	app.Main()
+}
@@ -0,0 +1,13 @@
+//go:build headless
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func runGUI() {
+	fmt.Fprintln(os.Stderr, "This build of flowshell has no GUI. Usage: flowshell run [flags] <graph file>")
+	os.Exit(2)
+}
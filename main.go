@@ -1,9 +1,16 @@
 package main
 
 import (
-	"github.com/bvisness/flowshell/app"
+	"os"
+
+	"github.com/bvisness/flowshell/core"
 )
 
 func main() {
-	app.Main()
+	if len(os.Args) > 1 && os.Args[1] == "run" {
+		// Headless mode; must not touch raylib.
+		os.Exit(core.RunHeadless(os.Args[2:]))
+	}
+
+	runGUI()
 }
@@ -1,6 +1,11 @@
 package trace
 
-import "github.com/go-stack/stack"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-stack/stack"
+)
 
 type CallStack []StackFrame
 type StackFrame struct {
@@ -10,7 +15,29 @@ type StackFrame struct {
 }
 
 func Trace() CallStack {
+	return frames(stack.Trace().TrimRuntime()[1:])
+}
+
+// PanicTrace returns the stack of the code that panicked. Call it from a
+// deferred function that recovers the panic; the frames of the deferred
+// function and the runtime's panic machinery are left out.
+func PanicTrace() CallStack {
 	trace := stack.Trace().TrimRuntime()[1:]
+	for i, call := range trace {
+		if call.Frame().Function == "runtime.gopanic" {
+			trace = trace[i+1:]
+			// Runtime errors like nil dereferences go through a few more runtime
+			// functions before panicking.
+			for len(trace) > 0 && strings.HasPrefix(trace[0].Frame().Function, "runtime.") {
+				trace = trace[1:]
+			}
+			break
+		}
+	}
+	return frames(trace)
+}
+
+func frames(trace stack.CallStack) CallStack {
 	frames := make(CallStack, len(trace))
 	for i, call := range trace {
 		callFrame := call.Frame()
@@ -23,3 +50,17 @@ func Trace() CallStack {
 
 	return frames
 }
+
+func (f StackFrame) String() string {
+	return fmt.Sprintf("%s\n\t%s:%d", f.Function, f.File, f.Line)
+}
+
+// Formats the stack like a Go panic does, one function and location per frame.
+func (cs CallStack) String() string {
+	var b strings.Builder
+	for _, f := range cs {
+		b.WriteString(f.String())
+		b.WriteString("\n")
+	}
+	return b.String()
+}